@@ -2,20 +2,41 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"copilot-api-proxy/internal/server"
+	"copilot-api-proxy/pkg/apikeys"
 	"copilot-api-proxy/pkg/config"
 	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/models"
+	"copilot-api-proxy/pkg/premium"
+	"copilot-api-proxy/pkg/ratelimit"
+	"copilot-api-proxy/pkg/recording"
+	"copilot-api-proxy/pkg/tracing"
+	"copilot-api-proxy/pkg/usage"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// logLevel is the level of the process logger. It can be changed by a
+// configuration reload.
+var logLevel = new(slog.LevelVar)
+
 func main() {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
 
 	if err := config.EnsurePaths(); err != nil {
 		logger.Error("Failed to ensure paths", "error", err)
@@ -31,9 +52,17 @@ func main() {
 
 	switch command {
 	case "auth":
-		runAuth(logger)
+		runAuth(logger, os.Args[2:])
 	case "server":
-		runServer(logger)
+		runServer(logger, os.Args[2:])
+	case "keys":
+		runKeys(logger, os.Args[2:])
+	case "usage":
+		runUsage(logger, os.Args[2:])
+	case "quota":
+		runQuota(logger, os.Args[2:])
+	case "mock-upstream":
+		runMockUpstream(logger, os.Args[2:])
 	default:
 		logger.Error("Unknown command", "command", command)
 		printUsage(logger)
@@ -44,13 +73,41 @@ func main() {
 func printUsage(logger *slog.Logger) {
 	fmt.Println("Usage: go run cmd/copilot-api-proxy/main.go [command]")
 	fmt.Println("Commands:")
-	fmt.Println("  auth    - Exchange a GitHub token for a Copilot token and print it.")
-	fmt.Println("  server  - Run the Copilot proxy server.")
+	fmt.Println("  auth    - Exchange a GitHub token for a Copilot token and print it (--config <file>, --account <name>, --host <ghes-host>).")
+	fmt.Println("  server  - Run the Copilot proxy server (--config <file>, --port <port>, --log-level <level>, --no-auth).")
+	fmt.Println("  keys    - Manage proxy API keys (create <name>, list, revoke <id|name>).")
+	fmt.Println("  usage   - Report token usage by day or month (--period <day|month>, --from <date>, --to <date>, --client <name>, --model <id>, --json).")
+	fmt.Println("  quota   - Show the Copilot plan and remaining quotas of each account (--config <file>, --account <name>, --json).")
+	fmt.Println("  mock-upstream - Serve a fake GitHub and Copilot API for development (--port <port>, --behavior <spec>).")
 }
 
-func runAuth(logger *slog.Logger) {
-	logger.Info("Starting GitHub device authentication flow.")
-	deviceCode, err := copilot.GetDeviceCode(context.Background())
+func runAuth(logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("auth", flag.ExitOnError)
+	var overrides config.Overrides
+	flags.StringVar(&overrides.ConfigPath, "config", "", "path to the configuration file (default $XDG_CONFIG_HOME/copilot-api-proxy/config.toml)")
+	account := flags.String("account", config.DefaultAccount, "name of the account to store the token under")
+	hostFlag := flags.String("host", "", "GitHub Enterprise Server hostname or URL (default upstream.github_url, or github.com)")
+	flags.Parse(args)
+
+	cfg, err := config.LoadSettings(overrides)
+	if err != nil {
+		logger.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	host, err := cfg.GitHubHost(config.Account{Name: *account, Host: *hostFlag})
+	if err != nil {
+		logger.Error("Invalid GitHub host", "error", err)
+		os.Exit(1)
+	}
+
+	tokenPath, err := config.GetAccountTokenPath(*account)
+	if err != nil {
+		logger.Error("Failed to get token path", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("Starting GitHub device authentication flow.", "account", *account, "host", host)
+	deviceCode, err := copilot.GetDeviceCode(context.Background(), host)
 	if err != nil {
 		logger.Error("Failed to get device code", "error", err)
 		os.Exit(1)
@@ -58,7 +115,7 @@ func runAuth(logger *slog.Logger) {
 
 	fmt.Printf("Please enter the code \"%s\" in %s\n", deviceCode.UserCode, deviceCode.VerificationURI)
 
-	accessToken, err := copilot.PollAccessToken(context.Background(), deviceCode)
+	accessToken, err := copilot.PollAccessToken(context.Background(), host, deviceCode)
 	if err != nil {
 		logger.Error("Failed to get access token", "error", err)
 		os.Exit(1)
@@ -67,9 +124,8 @@ func runAuth(logger *slog.Logger) {
 	logger.Info("Successfully authenticated with GitHub.")
 
 	// Save the token
-	tokenPath, err := config.GetGitHubTokenPath()
-	if err != nil {
-		logger.Error("Failed to get token path", "error", err)
+	if err := os.MkdirAll(filepath.Dir(tokenPath), 0o700); err != nil {
+		logger.Error("Failed to create account directory", "error", err)
 		os.Exit(1)
 	}
 	if err := os.WriteFile(tokenPath, []byte(accessToken), 0o600); err != nil {
@@ -78,8 +134,22 @@ func runAuth(logger *slog.Logger) {
 	}
 	logger.Info("GitHub token saved", "path", tokenPath)
 
+	// Remember which GitHub instance the token belongs to. Without --host
+	// the account follows the configured default.
+	hostPath, err := config.GetAccountHostPath(*account)
+	if err != nil {
+		logger.Error("Failed to get host path", "error", err)
+		os.Exit(1)
+	}
+	if *hostFlag == "" || host == copilot.DefaultGitHubHost {
+		os.Remove(hostPath)
+	} else if err := os.WriteFile(hostPath, []byte(host.WebURL), 0o600); err != nil {
+		logger.Error("Failed to write GitHub host to file", "error", err)
+		os.Exit(1)
+	}
+
 	// Now, exchange the GitHub token for a Copilot token
-	tokenResponse, err := copilot.ExchangeGitHubToken(context.Background(), accessToken)
+	tokenResponse, err := copilot.ExchangeGitHubToken(context.Background(), host, accessToken)
 	if err != nil {
 		logger.Error("Failed to exchange GitHub token for Copilot token", "error", err)
 		os.Exit(1)
@@ -88,28 +158,205 @@ func runAuth(logger *slog.Logger) {
 	fmt.Print(tokenResponse.Token)
 }
 
-func runServer(logger *slog.Logger) {
-	// Load configuration from environment variables
-	cfg, err := config.Load()
+func runServer(logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	var overrides config.Overrides
+	flags.StringVar(&overrides.ConfigPath, "config", "", "path to the configuration file (default $XDG_CONFIG_HOME/copilot-api-proxy/config.toml)")
+	flags.StringVar(&overrides.Port, "port", "", "port to listen on")
+	flags.StringVar(&overrides.LogLevel, "log-level", "", "log level (debug, info, warn or error)")
+	flags.BoolVar(&overrides.NoAuth, "no-auth", false, "accept requests without an API key")
+	flags.Parse(args)
+
+	// Load configuration from the config file, environment and flags
+	cfg, err := config.Load(overrides)
 	if err != nil {
 		logger.Error("Failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	logLevel.Set(cfg.LogLevel)
+	if cfg.ConfigPath != "" {
+		logger.Info("Loaded configuration file", "path", cfg.ConfigPath)
+	}
+
+	// Set up tracing before anything that records spans
+	tracer, err := newTracer(cfg, logger)
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	if tracer != nil {
+		tracing.SetDefault(tracer)
+		defer tracer.Shutdown()
+		logger.Info("Tracing enabled", "exporter", cfg.TracingExporter, "service", cfg.TracingServiceName)
+	}
+
+	// Create a token manager per account for handling Copilot token lifecycle.
+	// Accounts that fail their initial exchange are skipped.
+	// Replayed responses need no real token, so replay skips the exchanges.
+	var accounts []*copilot.Account
+	githubAccounts := cfg.Accounts
+	if cfg.RecordingMode == config.RecordingReplay {
+		accounts = append(accounts, &copilot.Account{Name: "replay", TokenManager: copilot.NewStaticTokenManager("replay", "replay", logger)})
+		githubAccounts = nil
+	}
+	for _, account := range githubAccounts {
+		accountLogger := logger.With("account", account.Name)
+		host, err := cfg.GitHubHost(account)
+		if err != nil {
+			accountLogger.Error("Invalid GitHub host", "error", err)
+			continue
+		}
+		cachePath, err := config.GetAccountCopilotTokenPath(account.Name)
+		if err != nil {
+			accountLogger.Error("Failed to get token cache path", "error", err)
+			continue
+		}
+		tm, err := copilot.NewTokenManager(context.Background(), account.Name, account.GitHubToken, host, cachePath, accountLogger)
+		if err != nil {
+			accountLogger.Error("Failed to create token manager", "error", err)
+			continue
+		}
+		accounts = append(accounts, &copilot.Account{Name: account.Name, TokenManager: tm})
+	}
+
+	strategy, err := copilot.ParseStrategy(cfg.AccountStrategy)
+	if err != nil {
+		logger.Error("Invalid account strategy", "error", err)
+		os.Exit(1)
+	}
+	pool, err := copilot.NewPool(accounts, strategy, cfg.AccountCooldown, logger)
+	if err != nil {
+		logger.Error("No usable Copilot account", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+	logger.Info("Copilot account pool ready", "accounts", len(accounts), "strategy", strategy)
 
-	// Create the token manager for handling Copilot token lifecycle
-	tm, err := copilot.NewTokenManager(context.Background(), cfg.GitHubToken, logger)
+	// Count premium requests against the monthly budget
+	premiumStatePath, err := config.GetPremiumStatePath()
+	if err != nil {
+		logger.Error("Failed to get premium request state path", "error", err)
+		os.Exit(1)
+	}
+	budget, err := premium.New(cfg.Premium, premiumStatePath, logger)
 	if err != nil {
-		logger.Error("Failed to create token manager", "error", err)
+		logger.Error("Failed to create premium request budget", "error", err)
 		os.Exit(1)
 	}
-	defer tm.Close()
+	defer budget.Close()
+	if cfg.Premium.MonthlyBudget > 0 {
+		logger.Info("Premium request budget enabled", "monthly_budget", cfg.Premium.MonthlyBudget, "used", budget.Status().Used)
+	}
+
+	// Poll the Copilot quotas of every account. Replayed traffic has no
+	// GitHub account to ask.
+	var quotaMonitor *copilot.QuotaMonitor
+	if cfg.RecordingMode != config.RecordingReplay {
+		quotaMonitor = copilot.NewQuotaMonitor(pool, cfg.QuotaPollInterval, logger)
+		defer quotaMonitor.Close()
+	}
 
-	// Create an instance of the Copilot API client
+	// Create an instance of the Copilot API client, recording or replaying
+	// its traffic if configured
+	clientOpts := []copilot.ClientOption{copilot.WithPremiumBudget(budget)}
+	if quotaMonitor != nil {
+		clientOpts = append(clientOpts, copilot.WithQuotaMonitor(quotaMonitor))
+	}
+	if cfg.CopilotAPIURL != "" {
+		clientOpts = append(clientOpts, copilot.WithAPIURL(cfg.CopilotAPIURL))
+		logger.Info("Using Copilot API URL from configuration", "url", cfg.CopilotAPIURL)
+	}
+	var recorder *recording.Recorder
+	switch cfg.RecordingMode {
+	case config.RecordingRecord:
+		recorder, err = recording.NewRecorder(cfg.RecordingPath, int64(cfg.RecordingMaxFileMB)<<20, cfg.RecordingMaxFiles, logger)
+		if err != nil {
+			logger.Error("Failed to start traffic recording", "error", err)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+		clientOpts = append(clientOpts, copilot.WithTransport(&recording.Transport{Base: http.DefaultTransport, Recorder: recorder, Logger: logger}))
+		logger.Warn("Recording client and upstream traffic, including request bodies", "path", cfg.RecordingPath)
+	case config.RecordingReplay:
+		player, err := recording.LoadPlayer(cfg.RecordingPath, cfg.ReplayTiming)
+		if err != nil {
+			logger.Error("Failed to load recordings", "error", err)
+			os.Exit(1)
+		}
+		clientOpts = append(clientOpts, copilot.WithTransport(player))
+		logger.Info("Replaying recorded traffic instead of calling Copilot", "path", cfg.RecordingPath)
+	}
+	copilotClient := copilot.NewClient(pool, cfg.UpstreamTimeouts, logger, clientOpts...)
+	copilotClient.SetInitiatorPolicy(cfg.Initiator)
 
-	copilotClient := copilot.NewClient(tm, 30*time.Second)
+	// Load the inbound API keys; without any, every request is rejected
+	// unless authentication is disabled
+	keysPath, err := config.GetAPIKeysPath()
+	if err != nil {
+		logger.Error("Failed to get API keys path", "error", err)
+		os.Exit(1)
+	}
+	keyStore, err := apikeys.Load(keysPath)
+	if err != nil {
+		logger.Error("Failed to load API keys", "error", err)
+		os.Exit(1)
+	}
+	opts := []server.Option{server.WithAPIKeys(keyStore), server.WithVersion(version)}
+	if recorder != nil {
+		opts = append(opts, server.WithRecording(recorder))
+	}
+	switch {
+	case cfg.AuthDisabled:
+		logger.Warn("Authentication disabled; the proxy accepts unauthenticated requests")
+		opts = append(opts, server.WithAuthDisabled())
+	case !keyStore.Enabled():
+		logger.Warn("No API keys configured; requests are rejected until one is created with the keys command", "keys_path", keysPath)
+	}
+
+	// Set up rate limiting. The limiter is always created so that limits can
+	// be enabled by a configuration reload.
+	statePath, err := config.GetRateLimitStatePath()
+	if err != nil {
+		logger.Error("Failed to get rate limit state path", "error", err)
+		os.Exit(1)
+	}
+	limiter, err := ratelimit.New(cfg.ClientLimits, cfg.GlobalLimits, statePath, logger)
+	if err != nil {
+		logger.Error("Failed to create rate limiter", "error", err)
+		os.Exit(1)
+	}
+	defer limiter.Close()
+	if cfg.ClientLimits.Enabled() || cfg.GlobalLimits.Enabled() {
+		logger.Info("Rate limiting enabled", "client_limits", cfg.ClientLimits, "global_limits", cfg.GlobalLimits)
+	}
+	opts = append(opts, server.WithRateLimiter(limiter))
+
+	// Meter token usage per request
+	ledgerPath, err := config.GetUsageLedgerPath()
+	if err != nil {
+		logger.Error("Failed to get usage ledger path", "error", err)
+		os.Exit(1)
+	}
+	ledger, err := usage.Open(ledgerPath)
+	if err != nil {
+		logger.Error("Failed to open usage ledger", "error", err)
+		os.Exit(1)
+	}
+	defer ledger.Close()
+	opts = append(opts, server.WithUsageLedger(ledger))
+
+	// Model aliases and virtual models
+	modelTable := models.NewTable(cfg.ModelAliases, cfg.ModelPresets)
+	if len(cfg.ModelAliases) > 0 || len(cfg.ModelPresets) > 0 {
+		logger.Info("Model mapping configured", "aliases", len(cfg.ModelAliases), "presets", len(cfg.ModelPresets))
+	}
+	opts = append(opts, server.WithModelTable(modelTable))
+	modelRegistry := models.NewRegistry(copilotClient, cfg.ModelsCacheTTL, logger)
+	validator := models.NewValidator(modelRegistry, cfg.ModelValidation)
+	opts = append(opts, server.WithModelRegistry(modelRegistry), server.WithValidator(validator))
 
 	// Create a new server instance
-	srv := server.New(cfg.Port, logger, copilotClient)
+	srv := server.New(cfg.Port, logger, copilotClient, opts...)
 
 	// Set up graceful shutdown
 
@@ -125,6 +372,21 @@ func runServer(logger *slog.Logger) {
 		cancel()
 	}()
 
+	// Reload the hot-reloadable settings on SIGHUP or when the file changes
+	reloader := &reloader{
+		overrides: overrides,
+		current:   cfg,
+		logger:    logger,
+		limiter:   limiter,
+		keys:      keyStore,
+		models:    modelTable,
+		validator: validator,
+		client:    copilotClient,
+		budget:    budget,
+		quota:     quotaMonitor,
+	}
+	go reloader.run(ctx)
+
 	// Start the server
 	logger.Info("Starting Copilot Proxy server")
 	if err := srv.Start(ctx); err != nil {
@@ -132,3 +394,193 @@ func runServer(logger *slog.Logger) {
 		os.Exit(1)
 	}
 }
+
+// newTracer creates the tracer selected by the configuration, or nil when
+// tracing is off.
+func newTracer(cfg *config.Config, logger *slog.Logger) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.TracingExporter {
+	case config.TracingOTLP:
+		url := cfg.TracingTracesEndpoint
+		if url == "" {
+			url = tracing.TracesURL(cfg.TracingEndpoint)
+		}
+		exporter = tracing.NewOTLPExporter(url, cfg.TracingHeaders)
+	case config.TracingStdout:
+		exporter = tracing.NewStdoutExporter()
+	case config.TracingFile:
+		fileExporter, err := tracing.NewFileExporter(cfg.TracingFile)
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	default:
+		return nil, nil
+	}
+	return tracing.NewTracer(exporter, cfg.TracingServiceName, logger), nil
+}
+
+func runKeys(logger *slog.Logger, args []string) {
+	keysPath, err := config.GetAPIKeysPath()
+	if err != nil {
+		logger.Error("Failed to get API keys path", "error", err)
+		os.Exit(1)
+	}
+	store, err := apikeys.Load(keysPath)
+	if err != nil {
+		logger.Error("Failed to load API keys", "error", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		fmt.Println("Usage: copilot-api-proxy keys [create <name> | list | revoke <id|name>]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) < 2 {
+			logger.Error("Missing key name")
+			os.Exit(1)
+		}
+		secret, key, err := store.Create(args[1])
+		if err != nil {
+			logger.Error("Failed to create API key", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("API key created", "id", key.ID, "name", key.Name, "path", keysPath)
+		fmt.Println("Store this key now, it will not be shown again:")
+		fmt.Println(secret)
+	case "list":
+		for _, key := range store.List() {
+			status := "active"
+			if key.Revoked() {
+				status = "revoked " + key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s...\t%s\t%s\n", key.ID, key.Name, key.Prefix, key.CreatedAt.Format(time.RFC3339), status)
+		}
+	case "revoke":
+		if len(args) < 2 {
+			logger.Error("Missing key id or name")
+			os.Exit(1)
+		}
+		key, err := store.Revoke(args[1])
+		if err != nil {
+			logger.Error("Failed to revoke API key", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("API key revoked", "id", key.ID, "name", key.Name)
+	default:
+		logger.Error("Unknown keys command", "command", args[0])
+		os.Exit(1)
+	}
+}
+
+func runUsage(logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("usage", flag.ExitOnError)
+	period := flags.String("period", usage.PeriodDay, "roll usage up by day or month")
+	from := flags.String("from", "", "first date to include (YYYY-MM-DD)")
+	to := flags.String("to", "", "last date to include (YYYY-MM-DD)")
+	client := flags.String("client", "", "only include requests made with this API key name")
+	model := flags.String("model", "", "only include requests for this model")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	q, err := usage.ParseQuery(*period, *from, *to, *client, *model)
+	if err != nil {
+		logger.Error("Invalid usage query", "error", err)
+		os.Exit(1)
+	}
+	ledgerPath, err := config.GetUsageLedgerPath()
+	if err != nil {
+		logger.Error("Failed to get usage ledger path", "error", err)
+		os.Exit(1)
+	}
+	report, err := usage.ReadReport(ledgerPath, q)
+	if err != nil {
+		logger.Error("Failed to read usage ledger", "error", err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PERIOD\tCLIENT\tMODEL\tREQUESTS\tPROMPT\tCOMPLETION\tREASONING\tCACHED\tTOTAL\t")
+	printRow := func(period, client, model string, t usage.Totals) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n", period, client, model,
+			t.Requests, t.PromptTokens, t.CompletionTokens, t.ReasoningTokens, t.CachedTokens, t.TotalTokens)
+	}
+	for _, row := range report.Rows {
+		printRow(row.Period, row.Client, row.Model, row.Totals)
+	}
+	printRow("total", "", "", report.Total)
+	tw.Flush()
+}
+
+func runQuota(logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("quota", flag.ExitOnError)
+	var overrides config.Overrides
+	flags.StringVar(&overrides.ConfigPath, "config", "", "path to the configuration file (default $XDG_CONFIG_HOME/copilot-api-proxy/config.toml)")
+	account := flags.String("account", "", "only show this account")
+	asJSON := flags.Bool("json", false, "print the quotas as JSON")
+	flags.Parse(args)
+
+	cfg, err := config.Load(overrides)
+	if err != nil {
+		logger.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	var quotas []copilot.AccountQuota
+	failed := false
+	for _, acct := range cfg.Accounts {
+		if *account != "" && acct.Name != *account {
+			continue
+		}
+		host, err := cfg.GitHubHost(acct)
+		if err != nil {
+			logger.Error("Invalid GitHub host", "account", acct.Name, "error", err)
+			failed = true
+			continue
+		}
+		user, err := copilot.GetCopilotUser(context.Background(), host, acct.GitHubToken)
+		if err != nil {
+			logger.Error("Failed to fetch Copilot quotas", "account", acct.Name, "error", err)
+			failed = true
+			continue
+		}
+		quotas = append(quotas, copilot.NewAccountQuota(acct.Name, user, time.Now()))
+	}
+	if len(quotas) == 0 && !failed {
+		logger.Error("No matching account", "account", *account)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(quotas)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACCOUNT\tPLAN\tQUOTA\tREMAINING\tENTITLEMENT\tPERCENT\tRESETS\t")
+		for _, q := range quotas {
+			for _, id := range slices.Sorted(maps.Keys(q.Quotas)) {
+				quota := q.Quotas[id]
+				if quota.Unlimited {
+					fmt.Fprintf(tw, "%s\t%s\t%s\tunlimited\t\t\t%s\t\n", q.Account, q.Plan, id, q.ResetDate)
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%g\t%g\t%.1f%%\t%s\t\n", q.Account, q.Plan, id,
+					quota.Remaining, quota.Entitlement, quota.PercentRemaining, q.ResetDate)
+			}
+		}
+		tw.Flush()
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"copilot-api-proxy/pkg/mockupstream"
+)
+
+// runMockUpstream serves a fake GitHub and Copilot API for local
+// development and CI.
+func runMockUpstream(logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("mock-upstream", flag.ExitOnError)
+	port := flags.String("port", "9872", "port to listen on")
+	tokenTTL := flags.Duration("token-ttl", 30*time.Minute, "lifetime of issued Copilot tokens")
+	pendingPolls := flags.Int("pending-polls", 0, "access token polls answered with authorization_pending before the token is issued")
+	behavior := flags.String("behavior", "", "default behavior for chat completions, e.g. \"delay=500ms,chunk_delay=50ms\"")
+	flags.Parse(args)
+
+	defaultBehavior, err := mockupstream.ParseBehavior(*behavior)
+	if err != nil {
+		logger.Error("Invalid --behavior", "error", err)
+		os.Exit(1)
+	}
+
+	baseURL := "http://localhost:" + *port
+	mock := mockupstream.New(mockupstream.Options{
+		BaseURL:      baseURL,
+		TokenTTL:     *tokenTTL,
+		PendingPolls: *pendingPolls,
+		Default:      defaultBehavior,
+	}, logger)
+	httpServer := &http.Server{Addr: ":" + *port, Handler: mock}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Mock upstream listening", "url", baseURL)
+	fmt.Printf("Point the proxy at it with:\n  GITHUB_URL=%s COPILOT_API_URL=%s GITHUB_TOKEN=%s copilot-api-proxy server\n", baseURL, baseURL, mockupstream.GitHubToken)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Mock upstream failed", "error", err)
+		os.Exit(1)
+	}
+}
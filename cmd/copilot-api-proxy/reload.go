@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"copilot-api-proxy/pkg/apikeys"
+	"copilot-api-proxy/pkg/config"
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/models"
+	"copilot-api-proxy/pkg/premium"
+	"copilot-api-proxy/pkg/ratelimit"
+)
+
+// reloadPollInterval is how often the configuration and keys files are
+// checked for changes.
+const reloadPollInterval = 2 * time.Second
+
+// reloader re-reads the configuration on SIGHUP or when the configuration
+// file changes, and applies the sections that can change at runtime. A
+// configuration that fails to load or validate is rejected and the running
+// state is left untouched. The API keys are reloaded on their own, so a
+// revoked key stops working even while the configuration file is invalid.
+type reloader struct {
+	overrides config.Overrides
+	current   *config.Config
+	logger    *slog.Logger
+	limiter   *ratelimit.Limiter
+	keys      *apikeys.Store
+	models    *models.Table
+	validator *models.Validator
+	client    *copilot.Client
+	budget    *premium.Budget
+	quota     *copilot.QuotaMonitor
+}
+
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(reloadPollInterval)
+	defer ticker.Stop()
+	lastMod := modTime(r.configPath())
+	lastKeysMod := modTime(r.keys.Path())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("Received SIGHUP, reloading configuration")
+			lastMod = modTime(r.configPath())
+			lastKeysMod = modTime(r.keys.Path())
+			r.reloadKeys()
+			r.reload()
+		case <-ticker.C:
+			if mod := modTime(r.keys.Path()); !mod.Equal(lastKeysMod) {
+				lastKeysMod = mod
+				r.logger.Info("API keys file changed, reloading")
+				r.reloadKeys()
+			}
+			if mod := modTime(r.configPath()); !mod.Equal(lastMod) {
+				lastMod = mod
+				r.logger.Info("Configuration file changed, reloading")
+				r.reload()
+			}
+		}
+	}
+}
+
+// modTime returns the modification time of the file at path, or the zero
+// time if it does not exist.
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (r *reloader) configPath() string {
+	if r.overrides.ConfigPath != "" {
+		return r.overrides.ConfigPath
+	}
+	if path := os.Getenv("COPILOT_PROXY_CONFIG"); path != "" {
+		return path
+	}
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// reloadKeys re-reads the API keys file. A file that cannot be read or
+// parsed leaves the loaded keys in place.
+func (r *reloader) reloadKeys() {
+	if err := r.keys.Reload(); err != nil {
+		r.logger.Error("API keys reload rejected, keeping the loaded keys", "error", err)
+		return
+	}
+	r.logger.Info("API keys reloaded", "keys", len(r.keys.List()))
+}
+
+func (r *reloader) reload() {
+	next, err := config.Load(r.overrides)
+	if err != nil {
+		r.logger.Error("Configuration reload rejected, keeping the running configuration", "error", err)
+		return
+	}
+
+	prev := r.current
+	logLevel.Set(next.LogLevel)
+	r.limiter.SetLimits(next.ClientLimits, next.GlobalLimits)
+	r.models.Set(next.ModelAliases, next.ModelPresets)
+	r.validator.SetMode(next.ModelValidation)
+	r.client.SetTimeouts(next.UpstreamTimeouts)
+	r.client.SetInitiatorPolicy(next.Initiator)
+	r.budget.SetPolicy(next.Premium)
+	if r.quota != nil {
+		r.quota.SetInterval(next.QuotaPollInterval)
+	}
+
+	if next.Port != prev.Port {
+		r.logger.Warn("Port change requires a restart", "running", prev.Port, "configured", next.Port)
+	}
+	if next.AuthDisabled != prev.AuthDisabled {
+		r.logger.Warn("Enabling or disabling authentication requires a restart", "running_disabled", prev.AuthDisabled, "configured_disabled", next.AuthDisabled)
+	}
+	if next.AccountStrategy != prev.AccountStrategy || next.AccountCooldown != prev.AccountCooldown || len(next.Accounts) != len(prev.Accounts) {
+		r.logger.Warn("Account changes require a restart")
+	}
+
+	r.current = next
+	r.logger.Info("Configuration reloaded",
+		"log_level", next.LogLevel,
+		"client_limits", next.ClientLimits,
+		"global_limits", next.GlobalLimits,
+		"model_aliases", len(next.ModelAliases),
+		"model_presets", len(next.ModelPresets),
+		"model_validation", next.ModelValidation,
+		"upstream_timeouts", next.UpstreamTimeouts.Default,
+		"initiator_mode", next.Initiator.Mode,
+		"premium_budget", next.Premium.MonthlyBudget,
+		"quota_poll_interval", next.QuotaPollInterval)
+}
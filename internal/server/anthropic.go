@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"copilot-api-proxy/pkg/anthropic"
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/httpstreaming"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// anthropicMessagesHandler serves the Anthropic Messages API by translating
+// requests onto Copilot chat completions and translating the responses back.
+func (s *Server) anthropicMessagesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		s.logger.Info("Incoming Anthropic messages request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
+
+		if r.Method != http.MethodPost {
+			writeAnthropicError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+
+		_, parseSpan := tracing.Start(r.Context(), "parse request", tracing.KindInternal)
+		bodyBytes, err := io.ReadAll(r.Body)
+		if err != nil {
+			parseSpan.SetError(err)
+			parseSpan.End()
+			s.logger.Error("Failed to read request body", "error", err)
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
+			return
+		}
+
+		msgReq, err := anthropic.DecodeRequest(bodyBytes)
+		parseSpan.SetError(err)
+		parseSpan.End()
+		if err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		s.logger.Info("Request model", "model", msgReq.Model, "stream", msgReq.Stream)
+		s.setMetricsModel(r, msgReq.Model)
+
+		chatReq, err := anthropic.ToChatCompletion(msgReq)
+		if err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		chatBody, err := json.Marshal(chatReq)
+		if err != nil {
+			s.logger.Error("Failed to marshal translated request", "error", err)
+			writeAnthropicError(w, http.StatusInternalServerError, "api_error", "Failed to translate request")
+			return
+		}
+
+		chatBody, issue := s.prepareChatRequest(r.Context(), chatBody)
+		if issue != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", issue.Message)
+			return
+		}
+
+		upstreamResp, err := s.copilotClient.ChatCompletion(r.Context(), chatBody)
+		upstreamTime := time.Since(startTime)
+		if err != nil {
+			s.logger.Error("Upstream request failed", "error", err, "upstream_duration_ms", upstreamTime.Milliseconds())
+			status, message := upstreamFailure(err)
+			writeAnthropicError(w, status, anthropic.ErrorTypeForStatus(status), message)
+			return
+		}
+		defer upstreamResp.Body.Close()
+		copilot.CopyQuotaHeaders(w.Header(), upstreamResp.Header)
+
+		if upstreamResp.StatusCode != http.StatusOK {
+			errBody, _ := io.ReadAll(upstreamResp.Body)
+			s.logger.Error("Upstream request returned non-OK status",
+				"status", upstreamResp.Status,
+				"upstream_duration_ms", upstreamTime.Milliseconds(),
+				"body", string(errBody))
+			writeAnthropicError(w, upstreamResp.StatusCode,
+				anthropic.ErrorTypeForStatus(upstreamResp.StatusCode), upstreamErrorMessage(errBody, upstreamResp.Status))
+			return
+		}
+
+		if msgReq.Stream {
+			sw, done := httpstreaming.TrackStream(r.Context(), w)
+			u := s.streamAnthropicResponse(sw, upstreamResp.Body, msgReq.Model)
+			done()
+			s.recordUsage(r, chatBody, true, u)
+		} else {
+			var chatResp openai.ChatCompletionResponse
+			if err := json.NewDecoder(upstreamResp.Body).Decode(&chatResp); err != nil {
+				s.logger.Error("Failed to decode upstream response", "error", err)
+				writeAnthropicError(w, http.StatusBadGateway, "api_error", "Failed to decode upstream response")
+				return
+			}
+			writeJSON(w, http.StatusOK, anthropic.FromChatCompletion(&chatResp, msgReq.Model))
+			s.recordUsage(r, chatBody, false, chatResp.Usage)
+		}
+
+		s.logger.Info("Request completed",
+			"upstream_duration_ms", upstreamTime.Milliseconds(),
+			"total_duration_ms", time.Since(startTime).Milliseconds())
+	}
+}
+
+// streamAnthropicResponse translates an upstream chat completions SSE stream
+// into Anthropic streaming events. It returns the usage the stream reported.
+func (s *Server) streamAnthropicResponse(w http.ResponseWriter, body io.Reader, model string) *openai.Usage {
+	httpstreaming.PrepareStream(w)
+	translator := anthropic.NewStreamTranslator(model)
+
+	writeEvents := func(events []anthropic.Event) error {
+		for _, event := range events {
+			if err := httpstreaming.WriteEvent(w, event.Name, event.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	stream := httpstreaming.NewStream(body)
+	err := stream.Each(func(data []byte) error {
+		var chunk openai.ChatCompletionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			s.logger.Warn("Skipping malformed upstream chunk", "error", err)
+			return nil
+		}
+		return writeEvents(translator.HandleChunk(&chunk))
+	})
+	if err != nil {
+		s.logger.Error("Anthropic stream interrupted", "error", err)
+		writeEvents([]anthropic.Event{anthropic.ErrorEvent("api_error", streamInterruption(err))})
+		return stream.Stats().Usage
+	}
+
+	if err := writeEvents(translator.Finish()); err != nil {
+		s.logger.Error("Failed to write final events to client", "error", err)
+	}
+	return stream.Stats().Usage
+}
+
+func writeAnthropicError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, anthropic.NewError(errType, message))
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"copilot-api-proxy/pkg/apikeys"
+)
+
+// requireAPIKey rejects requests without a valid proxy-issued API key and
+// attaches the key to the request context. Until a key has been issued every
+// request is rejected, unless authentication was explicitly disabled.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authDisabled {
+			next(w, r)
+			return
+		}
+
+		secret := extractAPIKey(r)
+		if secret == "" {
+			s.logger.Warn("Rejected request without API key", "method", r.Method, "path", r.URL.Path)
+			writeOpenAIErrorCode(w, http.StatusUnauthorized, "invalid_request_error", nil,
+				"You didn't provide an API key. You need to provide your API key in an Authorization header using Bearer auth (i.e. Authorization: Bearer YOUR_KEY), or as an x-api-key header.")
+			return
+		}
+
+		var key *apikeys.Key
+		err := apikeys.ErrUnknownKey
+		if s.apiKeys != nil {
+			key, err = s.apiKeys.Authenticate(secret)
+		}
+		if err != nil {
+			s.logger.Warn("Rejected request with invalid API key", "method", r.Method, "path", r.URL.Path, "error", err)
+			message := "Incorrect API key provided: " + redactKey(secret) + "."
+			if errors.Is(err, apikeys.ErrRevokedKey) {
+				message = "The API key " + redactKey(secret) + " has been revoked."
+			}
+			writeOpenAIErrorCode(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", message)
+			return
+		}
+
+		next(w, r.WithContext(apikeys.WithKey(r.Context(), key)))
+	}
+}
+
+// extractAPIKey returns the key from a Bearer Authorization header or an
+// x-api-key header.
+func extractAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("x-api-key"))
+}
+
+// redactKey keeps only the start and end of a key for error messages.
+func redactKey(secret string) string {
+	if len(secret) <= 12 {
+		return "****"
+	}
+	return secret[:8] + "****" + secret[len(secret)-4:]
+}
+
+// clientName returns the name of the API key that authenticated r, for logging.
+func clientName(r *http.Request) string {
+	if key, ok := apikeys.FromContext(r.Context()); ok {
+		return key.Name
+	}
+	return "anonymous"
+}
+
+// clientID identifies the caller for per-client limits and account
+// stickiness: the API key when authenticated, otherwise the remote address.
+func clientID(r *http.Request) string {
+	if key, ok := apikeys.FromContext(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
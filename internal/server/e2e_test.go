@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"copilot-api-proxy/pkg/config"
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/mockupstream"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/recording"
+)
+
+// startProxy runs the proxy against a mock upstream, configured the way a
+// user would: GITHUB_URL points the account at the mock, and the token
+// exchange advertises the mock as the Copilot API endpoint.
+func startProxy(t *testing.T, clientOpts []copilot.ClientOption, opts ...Option) *httptest.Server {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var mock *mockupstream.Server
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	mock = mockupstream.New(mockupstream.Options{BaseURL: upstream.URL}, logger)
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("COPILOT_PROXY_CONFIG", "")
+	t.Setenv("GITHUB_TOKEN", mockupstream.GitHubToken)
+	t.Setenv("GITHUB_HOST", "")
+	t.Setenv("GITHUB_URL", upstream.URL)
+	cfg, err := config.Load(config.Overrides{})
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	host, err := cfg.GitHubHost(cfg.Accounts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.WebURL != upstream.URL {
+		t.Fatalf("account host = %+v, want the mock upstream", host)
+	}
+
+	tm, err := copilot.NewTokenManager(context.Background(), cfg.Accounts[0].Name, cfg.Accounts[0].GitHubToken, host,
+		filepath.Join(t.TempDir(), "copilot_token.json"), logger)
+	if err != nil {
+		t.Fatalf("token exchange with the mock: %v", err)
+	}
+	t.Cleanup(tm.Close)
+	pool, err := copilot.NewPool([]*copilot.Account{{Name: cfg.Accounts[0].Name, TokenManager: tm}},
+		copilot.StrategyRoundRobin, cfg.AccountCooldown, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, copilot.NewClient(pool, cfg.UpstreamTimeouts, logger, clientOpts...), opts...)
+}
+
+// serve runs the proxy routes with client, without authentication.
+func serve(t *testing.T, client *copilot.Client, opts ...Option) *httptest.Server {
+	t.Helper()
+	router := http.NewServeMux()
+	New("0", slog.New(slog.NewTextHandler(io.Discard, nil)), client, append(opts, WithAuthDisabled())...).registerRoutes(router)
+	proxy := httptest.NewServer(router)
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// serveUpstream runs the proxy routes against a scripted upstream that
+// answers both the token-less Copilot API calls and chat completions.
+func serveUpstream(t *testing.T, upstream http.Handler, opts ...Option) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pool, err := copilot.NewPool([]*copilot.Account{{Name: "test", TokenManager: copilot.NewStaticTokenManager("test", "token", logger)}},
+		copilot.StrategyRoundRobin, time.Minute, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, copilot.NewClient(pool, copilot.TimeoutPolicy{Default: copilot.DefaultTimeouts}, logger, copilot.WithAPIURL(srv.URL)), opts...)
+}
+
+func postChat(t *testing.T, proxy *httptest.Server, stream bool) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{
+		"model":    "gpt-4.1",
+		"stream":   stream,
+		"messages": []map[string]string{{"role": "user", "content": "hello proxy"}},
+	})
+	return post(t, proxy, "/v1/chat/completions", string(body))
+}
+
+func post(t *testing.T, proxy *httptest.Server, path, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(proxy.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status %d: %s", resp.StatusCode, data)
+	}
+	return resp
+}
+
+func TestEndToEndAgainstMockUpstream(t *testing.T) {
+	proxy := startProxy(t, nil)
+
+	t.Run("models", func(t *testing.T) {
+		resp, err := http.Get(proxy.URL + "/v1/models")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var list openai.ModelList
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Data) == 0 || list.Data[0].ID != "gpt-4.1" {
+			t.Fatalf("models = %+v, want the mock's models", list.Data)
+		}
+	})
+
+	t.Run("chat completion", func(t *testing.T) {
+		var completion openai.ChatCompletionResponse
+		if err := json.NewDecoder(postChat(t, proxy, false).Body).Decode(&completion); err != nil {
+			t.Fatal(err)
+		}
+		if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Mock reply to: hello proxy" {
+			t.Fatalf("completion = %+v, want the mock's echo", completion)
+		}
+	})
+
+	t.Run("streamed chat completion", func(t *testing.T) {
+		resp := postChat(t, proxy, true)
+		var reply strings.Builder
+		done := false
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			if data == "[DONE]" {
+				done = true
+				break
+			}
+			var chunk openai.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				t.Fatalf("chunk %s: %v", data, err)
+			}
+			for _, choice := range chunk.Choices {
+				reply.WriteString(choice.Delta.Content)
+			}
+		}
+		if !done || reply.String() != "Mock reply to: hello proxy" {
+			t.Fatalf("streamed %q (done: %v), want the mock's echo", reply.String(), done)
+		}
+	})
+}
+
+func TestRecordThenReplayThroughProxy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	recorder, err := recording.NewRecorder(dir, 1<<20, 2, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := startProxy(t, []copilot.ClientOption{copilot.WithTransport(&recording.Transport{Recorder: recorder, Logger: logger})},
+		WithRecording(recorder))
+
+	const messages = `{"model":"claude-sonnet-4","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hello proxy"}]}`
+	readBody := func(resp *http.Response) string {
+		t.Helper()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	recordedChat := readBody(postChat(t, proxy, false))
+	recordedMessages := readBody(post(t, proxy, "/v1/messages", messages))
+	proxy.Close()
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recording holds both boundaries, linked by request ID.
+	data, err := os.ReadFile(filepath.Join(dir, "traffic.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := map[string][]string{}
+	for line := range strings.Lines(string(data)) {
+		var e recording.Exchange
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		requests[e.Request] = append(requests[e.Request], e.Boundary+" "+e.Path)
+	}
+	for id, exchanges := range requests {
+		if id == "" {
+			// Model list fetches are not made for a client request.
+			continue
+		}
+		last := exchanges[len(exchanges)-1]
+		if len(exchanges) < 2 || !strings.HasPrefix(last, recording.BoundaryClient+" ") {
+			t.Errorf("request %s recorded as %q, want upstream exchanges then the client one", id, exchanges)
+		}
+	}
+
+	player, err := recording.LoadPlayer(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := copilot.NewPool([]*copilot.Account{{Name: "replay", TokenManager: copilot.NewStaticTokenManager("replay", "replay", logger)}},
+		copilot.StrategyRoundRobin, copilot.DefaultTimeouts.Total, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := serve(t, copilot.NewClient(pool, copilot.TimeoutPolicy{Default: copilot.DefaultTimeouts}, logger, copilot.WithTransport(player)))
+
+	if got := readBody(postChat(t, replay, false)); got != recordedChat {
+		t.Errorf("replayed chat completion %q, recorded %q", got, recordedChat)
+	}
+	if got := readBody(post(t, replay, "/v1/messages", messages)); got != recordedMessages {
+		t.Errorf("replayed messages stream %q, recorded %q", got, recordedMessages)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/premium"
+)
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeOpenAIError writes an OpenAI-style error envelope.
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	writeOpenAIErrorCode(w, status, errType, nil, message)
+}
+
+// writeOpenAIErrorCode writes an OpenAI-style error envelope with an error code.
+func writeOpenAIErrorCode(w http.ResponseWriter, status int, errType string, code any, message string) {
+	writeJSON(w, status, openai.ErrorResponse{Error: openai.Error{Message: message, Type: errType, Code: code}})
+}
+
+// openAIErrorType maps an HTTP status code to the OpenAI error type clients
+// expect for it.
+func openAIErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusRequestEntityTooLarge:
+		return "invalid_request_error"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "authentication_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	default:
+		return "server_error"
+	}
+}
+
+// upstreamErrorMessage extracts a human readable message from an upstream
+// error body, falling back to the HTTP status.
+func upstreamErrorMessage(body []byte, status string) string {
+	var envelope struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		if envelope.Error.Message != "" {
+			return envelope.Error.Message
+		}
+		if envelope.Message != "" {
+			return envelope.Message
+		}
+	}
+	if len(body) > 0 {
+		return string(body)
+	}
+	return "Upstream request failed with status " + status
+}
+
+// upstreamFailure maps an error from the Copilot client to the status and
+// message returned to the client: 504 if an upstream timeout fired, 429 if
+// the premium request budget is exhausted, 502 otherwise.
+func upstreamFailure(err error) (int, string) {
+	var timeout *copilot.TimeoutError
+	if errors.As(err, &timeout) {
+		return http.StatusGatewayTimeout, "Upstream request timed out: " + timeout.Error()
+	}
+	if errors.Is(err, premium.ErrBudgetExhausted) {
+		return http.StatusTooManyRequests, "Monthly " + err.Error()
+	}
+	return http.StatusBadGateway, "Failed to proxy request"
+}
+
+// streamInterruption describes why an upstream stream ended early, for the
+// error event sent in its place.
+func streamInterruption(err error) string {
+	var timeout *copilot.TimeoutError
+	if errors.As(err, &timeout) {
+		return "Upstream stream timed out: " + timeout.Error()
+	}
+	return "Upstream stream interrupted"
+}
@@ -7,52 +7,61 @@ import (
 	"net/http"
 	"time"
 
+	"copilot-api-proxy/pkg/copilot"
 	"copilot-api-proxy/pkg/httpstreaming"
+	"copilot-api-proxy/pkg/metrics"
+	"copilot-api-proxy/pkg/models"
+	"copilot-api-proxy/pkg/tracing"
+	"copilot-api-proxy/pkg/usage"
 )
 
 // registerRoutes sets up the routing for the server.
 func (s *Server) registerRoutes(router *http.ServeMux) {
-	router.HandleFunc("/v1/models", s.modelsHandler())
-	router.HandleFunc("/models", s.modelsHandler())
-	router.HandleFunc("/", s.proxyHandler())
+	router.HandleFunc("/v1/models", s.api(s.modelsHandler()))
+	router.HandleFunc("/models", s.api(s.modelsHandler()))
+	router.HandleFunc("/v1/models/capabilities", s.api(s.modelCapabilitiesHandler()))
+	router.HandleFunc("/v1/models/", s.api(s.modelByIDHandler()))
+	router.HandleFunc("/v1/messages", s.api(s.anthropicMessagesHandler()))
+	router.HandleFunc("/v1/responses", s.api(s.responsesHandler()))
+	router.HandleFunc("/v1/responses/", s.api(s.responseByIDHandler()))
+	router.HandleFunc("/v1/accounts", s.api(s.accountsHandler()))
+	router.HandleFunc("/v1/usage", s.api(s.usageHandler()))
+	router.HandleFunc("/v1/quota", s.api(s.quotaHandler()))
+	router.HandleFunc("/metrics", s.requireAPIKey(metrics.Default.Handler()))
+	router.HandleFunc("/healthz", s.healthzHandler())
+	router.HandleFunc("/readyz", s.readyzHandler())
+	router.HandleFunc("/status", s.requireAPIKey(s.statusHandler()))
+	s.registerOllamaRoutes(router)
+	router.HandleFunc("/", s.api(s.proxyHandler()))
 }
 
-// modelsHandler forwards models requests to Copilot API
-func (s *Server) modelsHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		s.logger.Info("Models request", "method", r.Method, "path", r.URL.Path)
-
-		r.URL.Path = "/models"
-
-		// Forward the request to the Copilot client
-		upstreamResp, err := s.copilotClient.ForwardRequest(r.Context(), r)
-		if err != nil {
-			s.logger.Error("Models request failed", "error", err)
-			http.Error(w, "Failed to proxy models request", http.StatusBadGateway)
-			return
-		}
-		defer upstreamResp.Body.Close()
-
-		if upstreamResp.StatusCode != http.StatusOK {
-			bodyBytes, err := io.ReadAll(upstreamResp.Body)
-			if err != nil {
-				s.logger.Error("Failed to read models upstream error response body", "error", err)
-				http.Error(w, "Failed to read upstream error response", http.StatusBadGateway)
-				return
-			}
-
-			s.logger.Error("Models upstream request returned non-OK status",
-				"status", upstreamResp.Status,
-				"body", string(bodyBytes))
+// api wraps a handler that serves proxied API traffic with metrics,
+// authentication and rate limiting, and recording if enabled. Only
+// authenticated exchanges are recorded.
+func (s *Server) api(next http.HandlerFunc) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		metrics.RequestInfoFrom(r.Context()).Client = clientName(r)
+		s.rateLimit(func(w http.ResponseWriter, r *http.Request) {
+			next(w, r.WithContext(copilot.WithClientID(r.Context(), clientID(r))))
+		})(w, r)
+	}
+	if s.recording != nil {
+		handler = s.recording.Wrap(http.HandlerFunc(handler)).ServeHTTP
+	}
+	return s.instrument(s.requireAPIKey(handler))
+}
 
-			// Forward the response to the client
-			w.WriteHeader(upstreamResp.StatusCode)
-			w.Write(bodyBytes)
+// accountsHandler reports the health of the Copilot account pool.
+func (s *Server) accountsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
 			return
 		}
-
-		// Stream the response back to the original client
-		httpstreaming.StreamResponse(w, upstreamResp, s.logger)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"object": "list",
+			"data":   s.copilotClient.Pool().Status(),
+		})
 	}
 }
 
@@ -60,10 +69,14 @@ func (s *Server) modelsHandler() http.HandlerFunc {
 func (s *Server) proxyHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
-		s.logger.Info("Incoming request", "method", r.Method, "path", r.URL.Path)
+		s.logger.Info("Incoming request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
 
 		// Read the body to log the model
+		_, parseSpan := tracing.Start(r.Context(), "parse request", tracing.KindInternal)
 		bodyBytes, err := io.ReadAll(r.Body)
+		parseSpan.SetAttributes(tracing.Int("request.body_bytes", len(bodyBytes)))
+		parseSpan.SetError(err)
+		parseSpan.End()
 		if err != nil {
 			s.logger.Error("Failed to read request body", "error", err)
 			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
@@ -72,14 +85,30 @@ func (s *Server) proxyHandler() http.HandlerFunc {
 		// Restore the body so it can be read again
 		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-		// Log the model
-		if r.URL.Path == "/v1/chat/completions" {
+		// Log the model and apply aliases and presets
+		var transforms []httpstreaming.Transform
+		if r.URL.Path == "/v1/chat/completions" || r.URL.Path == "/chat/completions" {
 			var chatReq struct {
 				Model string `json:"model"`
 			}
 			if err := json.Unmarshal(bodyBytes, &chatReq); err == nil {
 				s.logger.Info("Request model", "model", chatReq.Model)
+				s.setMetricsModel(r, chatReq.Model)
+			}
+			var issue *models.Issue
+			if bodyBytes, issue = s.prepareChatRequest(r.Context(), bodyBytes); issue != nil {
+				writeValidationError(w, issue)
+				return
+			}
+			// Ask for usage on streams to meter them, hiding it again from
+			// clients that did not ask for it.
+			if s.usageLedger != nil {
+				var injected bool
+				if bodyBytes, injected = usage.IncludeStreamUsage(bodyBytes); injected {
+					transforms = append(transforms, usage.StripUsage)
+				}
 			}
+			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 		}
 
 		// Forward the request to the Copilot client
@@ -87,7 +116,8 @@ func (s *Server) proxyHandler() http.HandlerFunc {
 		upstreamTime := time.Since(startTime)
 		if err != nil {
 			s.logger.Error("Upstream request failed", "error", err, "upstream_duration_ms", upstreamTime.Milliseconds())
-			http.Error(w, "Failed to proxy request", http.StatusBadGateway)
+			status, message := upstreamFailure(err)
+			http.Error(w, message, status)
 			return
 		}
 		defer upstreamResp.Body.Close()
@@ -107,16 +137,26 @@ func (s *Server) proxyHandler() http.HandlerFunc {
 				"body", string(bodyBytes))
 
 			// We still want to forward the response to the client
+			copilot.CopyQuotaHeaders(w.Header(), upstreamResp.Header)
 			w.WriteHeader(upstreamResp.StatusCode)
 			w.Write(bodyBytes)
 			return
 		}
 
 		// Stream the response back to the original client
-		httpstreaming.StreamResponse(w, upstreamResp, s.logger)
+		stats := httpstreaming.StreamResponse(w, upstreamResp, s.logger, transforms...)
+		s.recordUsage(r, bodyBytes, stats.Chunks > 0, stats.Usage)
 		totalTime := time.Since(startTime)
-		s.logger.Info("Request completed",
+		attrs := []any{
 			"upstream_duration_ms", upstreamTime.Milliseconds(),
-			"total_duration_ms", totalTime.Milliseconds())
+			"total_duration_ms", totalTime.Milliseconds(),
+		}
+		if stats.Chunks > 0 {
+			attrs = append(attrs,
+				"chunks", stats.Chunks,
+				"first_token_ms", stats.FirstToken.Milliseconds(),
+				"finish_reason", stats.FinishReason)
+		}
+		s.logger.Info("Request completed", attrs...)
 	}
 }
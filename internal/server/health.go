@@ -0,0 +1,131 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/premium"
+)
+
+// upstreamErrorWindow is how long a failed connection to Copilot keeps an
+// account from counting as ready, unless Copilot answers in between.
+const upstreamErrorWindow = 2 * time.Minute
+
+// accountReadiness is the readiness of one account.
+type accountReadiness struct {
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// readiness checks every account. The proxy is ready while at least one
+// account has a valid token whose last refresh succeeded, is not cooling
+// down, and has not recently failed to reach Copilot.
+func readiness(statuses []copilot.AccountStatus, now time.Time) (bool, []accountReadiness) {
+	ready := false
+	accounts := make([]accountReadiness, 0, len(statuses))
+	for _, status := range statuses {
+		reason := notReadyReason(status, now)
+		accounts = append(accounts, accountReadiness{Name: status.Name, Ready: reason == "", Reason: reason})
+		if reason == "" {
+			ready = true
+		}
+	}
+	return ready, accounts
+}
+
+// notReadyReason explains why an account cannot serve requests, or returns
+// "" if it can.
+func notReadyReason(status copilot.AccountStatus, now time.Time) string {
+	token := status.Token
+	switch {
+	case token.State == copilot.TokenExpired:
+		return "Copilot token expired"
+	case token.ConsecutiveFailures > 0:
+		return "last token refresh failed: " + token.LastError
+	case !status.Healthy:
+		return "cooling down after " + status.LastError
+	}
+	if at := status.LastErrorAt; at != nil && now.Sub(*at) < upstreamErrorWindow &&
+		(status.LastResponseAt == nil || status.LastResponseAt.Before(*at)) {
+		return "Copilot unreachable: " + status.LastError
+	}
+	return ""
+}
+
+// healthzHandler reports that the process is up. It does not look at the
+// accounts; use /readyz for that.
+func (s *Server) healthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// readyzHandler reports whether the proxy can serve requests, with 503 and
+// the reason per account when it cannot.
+func (s *Server) readyzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ready, accounts := readiness(s.copilotClient.Pool().Status(), time.Now())
+		if !ready {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not_ready", "accounts": accounts})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "accounts": accounts})
+	}
+}
+
+// upstreamError is the most recent error from Copilot across accounts.
+type upstreamError struct {
+	Account string    `json:"account"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// serverStatus is the body of /status.
+type serverStatus struct {
+	Version           string                  `json:"version"`
+	StartedAt         time.Time               `json:"started_at"`
+	UptimeSeconds     int64                   `json:"uptime_seconds"`
+	Ready             bool                    `json:"ready"`
+	InFlightRequests  int64                   `json:"in_flight_requests"`
+	LastUpstreamError *upstreamError          `json:"last_upstream_error,omitempty"`
+	PremiumRequests   *premium.Status         `json:"premium_requests,omitempty"`
+	Accounts          []copilot.AccountStatus `json:"accounts"`
+}
+
+// statusHandler reports the version, uptime and the state of every account,
+// including its plan, token expiry and last upstream error.
+func (s *Server) statusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+
+		now := time.Now()
+		accounts := s.copilotClient.Pool().Status()
+		ready, _ := readiness(accounts, now)
+		status := serverStatus{
+			Version:          s.version,
+			StartedAt:        s.startedAt,
+			UptimeSeconds:    int64(now.Sub(s.startedAt).Seconds()),
+			Ready:            ready,
+			InFlightRequests: s.inFlight.Load(),
+			Accounts:         accounts,
+		}
+		if budget := s.copilotClient.PremiumBudget(); budget != nil {
+			premiumStatus := budget.Status()
+			status.PremiumRequests = &premiumStatus
+		}
+		for _, account := range accounts {
+			if account.LastErrorAt == nil {
+				continue
+			}
+			if last := status.LastUpstreamError; last == nil || account.LastErrorAt.After(last.At) {
+				status.LastUpstreamError = &upstreamError{Account: account.Name, Error: account.LastError, At: *account.LastErrorAt}
+			}
+		}
+		writeJSON(w, http.StatusOK, status)
+	}
+}
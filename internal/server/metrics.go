@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"copilot-api-proxy/pkg/metrics"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// knownRoutes are the paths served by the catch-all proxy handler that get
+// their own route label; everything else is counted as "other".
+var knownRoutes = map[string]bool{
+	"/v1/chat/completions": true,
+	"/chat/completions":    true,
+	"/v1/embeddings":       true,
+	"/embeddings":          true,
+}
+
+// routeLabel returns a bounded route label for r.
+func routeLabel(r *http.Request) string {
+	if r.Pattern != "" && r.Pattern != "/" {
+		return r.Pattern
+	}
+	if knownRoutes[r.URL.Path] {
+		return r.URL.Path
+	}
+	return "other"
+}
+
+// instrument records request metrics and the inbound request span for next,
+// continuing the caller's trace if it sent a traceparent header. The request
+// info it attaches to the context is filled in further down with the client
+// and model.
+func (s *Server) instrument(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := &metrics.RequestInfo{Route: routeLabel(r), Client: "unauthenticated", Start: time.Now()}
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, r.Method+" "+info.Route, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("http.route", info.Route),
+			tracing.String("url.path", r.URL.Path))
+		defer span.End()
+
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		rec := &statusRecorder{ResponseWriter: w, info: info}
+		next(rec, r.WithContext(metrics.WithRequestInfo(ctx, info)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.Requests.Inc(info.Route, info.Model, strconv.Itoa(status), info.Client)
+
+		span.SetAttributes(
+			tracing.Int("http.response.status_code", status),
+			tracing.String("client", info.Client),
+			tracing.String("model", info.Model))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(tracing.StatusError, http.StatusText(status))
+		}
+	}
+}
+
+// statusRecorder captures the status code and the time to the first body
+// byte of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	info   *metrics.RequestInfo
+	status int
+	wrote  bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	if !rec.wrote {
+		rec.wrote = true
+		metrics.TimeToFirstByte.Observe(time.Since(rec.info.Start).Seconds(), rec.info.Route)
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher when the wrapped writer does.
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// setMetricsModel records the model a request is for. Only models the
+// registry knows are used as labels, to keep the label set bounded. It
+// only consults the cached list, so it never waits for a fetch.
+func (s *Server) setMetricsModel(r *http.Request, model string) {
+	info := metrics.RequestInfoFrom(r.Context())
+	if s.modelTable != nil {
+		if _, ok := s.modelTable.Preset(model); ok {
+			info.Model = model
+			return
+		}
+		model, _ = s.modelTable.Resolve(model)
+	}
+	if s.modelRegistry != nil {
+		if _, found := s.modelRegistry.Cached(model); found {
+			info.Model = model
+			return
+		}
+	}
+	info.Model = "unknown"
+}
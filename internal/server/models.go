@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/models"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// virtualOwner is the owned_by value of virtual models.
+const virtualOwner = "copilot-api-proxy"
+
+// resolveModel applies model aliases and presets to a chat completions
+// request body.
+func (s *Server) resolveModel(body []byte) []byte {
+	if s.modelTable == nil {
+		return body
+	}
+	body, res := s.modelTable.RewriteChatRequest(body)
+	if res.Rewritten() {
+		s.logger.Info("Model rewritten", "requested", res.Requested, "model", res.Model, "preset", res.Preset)
+	}
+	return body
+}
+
+// prepareChatRequest applies model aliases and presets to a chat
+// completions request body and validates it against the capabilities of the
+// target model. It returns the body to send upstream, or the reason the
+// request must be rejected.
+func (s *Server) prepareChatRequest(ctx context.Context, body []byte) ([]byte, *models.Issue) {
+	ctx, span := tracing.Start(ctx, "prepare request", tracing.KindInternal)
+	defer span.End()
+
+	body = s.resolveModel(body)
+	if s.validator == nil {
+		return body, nil
+	}
+	body, fixes, issue := s.validator.Check(ctx, body)
+	if issue != nil {
+		s.logger.Warn("Request rejected by model validation", "param", issue.Param, "code", issue.Code, "error", issue.Message)
+		span.SetAttributes(tracing.String("validation.param", issue.Param), tracing.String("validation.code", issue.Code))
+		span.SetStatus(tracing.StatusError, issue.Message)
+		return nil, issue
+	}
+	if len(fixes) > 0 {
+		s.logger.Info("Request adjusted for model", "fixes", fixes)
+	}
+	return body, nil
+}
+
+// writeValidationError writes issue as an OpenAI invalid request error.
+func writeValidationError(w http.ResponseWriter, issue *models.Issue) {
+	writeJSON(w, http.StatusBadRequest, openai.ErrorResponse{Error: openai.Error{
+		Message: issue.Message,
+		Type:    "invalid_request_error",
+		Param:   &issue.Param,
+		Code:    issue.Code,
+	}})
+}
+
+// presetNames returns the configured virtual models.
+func (s *Server) presetNames() []string {
+	if s.modelTable == nil {
+		return nil
+	}
+	return s.modelTable.PresetNames()
+}
+
+// listModels returns the Copilot models, writing an error response if they
+// cannot be fetched.
+func (s *Server) listModels(w http.ResponseWriter, r *http.Request) ([]copilot.Model, bool) {
+	list, err := s.modelRegistry.List(r.Context())
+	if err != nil {
+		s.logger.Error("Models request failed", "error", err)
+		writeOpenAIError(w, http.StatusBadGateway, "api_error", "Failed to list models")
+		return nil, false
+	}
+	return list, true
+}
+
+// modelsHandler serves the model list in the OpenAI format, followed by the
+// virtual models.
+func (s *Server) modelsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("Models request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+
+		list, ok := s.listModels(w, r)
+		if !ok {
+			return
+		}
+		resp := openai.ModelList{Object: "list", Data: make([]openai.Model, 0, len(list))}
+		for _, model := range list {
+			resp.Data = append(resp.Data, openai.Model{ID: model.ID, Object: "model", Created: modelCreated, OwnedBy: models.OwnedBy(model)})
+		}
+		for _, name := range s.presetNames() {
+			resp.Data = append(resp.Data, openai.Model{ID: name, Object: "model", Created: modelCreated, OwnedBy: virtualOwner})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// modelByIDHandler serves /v1/models/{id}. Aliases and virtual models are
+// reported under the requested name.
+func (s *Server) modelByIDHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/models/")
+		if id == "" || strings.Contains(id, "/") {
+			writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "Unknown model path")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+
+		target, virtual := id, false
+		if s.modelTable != nil {
+			target, _ = s.modelTable.Resolve(id)
+			virtual = target != id
+		}
+		model, found, err := s.modelRegistry.Lookup(r.Context(), target)
+		if err != nil {
+			s.logger.Error("Models request failed", "error", err)
+			writeOpenAIError(w, http.StatusBadGateway, "api_error", "Failed to list models")
+			return
+		}
+		if !found {
+			writeOpenAIErrorCode(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+				"The model '"+id+"' does not exist or you do not have access to it.")
+			return
+		}
+
+		owner := models.OwnedBy(model)
+		if virtual {
+			owner = virtualOwner
+		}
+		writeJSON(w, http.StatusOK, openai.Model{ID: id, Object: "model", Created: modelCreated, OwnedBy: owner})
+	}
+}
+
+// modelCreated is the creation time reported for every model. Copilot does
+// not report one, and a fixed value keeps the list identical across
+// restarts for clients that cache or sort it.
+const modelCreated = 0
+
+// modelCapabilitiesHandler serves the extended model list with the Copilot
+// capability metadata of every model, including virtual ones.
+func (s *Server) modelCapabilitiesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+
+		list, ok := s.listModels(w, r)
+		if !ok {
+			return
+		}
+		data := make([]models.Capabilities, 0, len(list))
+		byID := make(map[string]copilot.Model, len(list))
+		for _, model := range list {
+			data = append(data, models.Describe(model))
+			byID[model.ID] = model
+		}
+		for _, name := range s.presetNames() {
+			target, _ := s.modelTable.Resolve(name)
+			caps := models.Describe(byID[target])
+			caps.ID = name
+			caps.Name = name
+			if preset, ok := s.modelTable.Preset(name); ok && preset.Description != "" {
+				caps.Name = preset.Description
+			}
+			caps.Object = "model"
+			caps.VirtualModelFor = target
+			data = append(data, caps)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+	}
+}
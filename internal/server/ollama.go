@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/httpstreaming"
+	"copilot-api-proxy/pkg/ollama"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// ollamaVersion is the Ollama version reported to clients that check it.
+const ollamaVersion = "0.6.0"
+
+// registerOllamaRoutes sets up the Ollama-compatible API surface.
+func (s *Server) registerOllamaRoutes(router *http.ServeMux) {
+	router.HandleFunc("/api/tags", s.api(s.ollamaTagsHandler()))
+	router.HandleFunc("/api/chat", s.api(s.ollamaChatHandler()))
+	router.HandleFunc("/api/generate", s.api(s.ollamaGenerateHandler()))
+	router.HandleFunc("/api/version", s.api(s.ollamaVersionHandler()))
+}
+
+// ollamaTagsHandler lists the Copilot chat models as Ollama models.
+func (s *Server) ollamaTagsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("Ollama tags request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
+
+		models, err := s.modelRegistry.List(r.Context())
+		if err != nil {
+			s.logger.Error("Models request failed", "error", err)
+			writeJSON(w, http.StatusBadGateway, ollama.ErrorResponse{Error: "failed to list models"})
+			return
+		}
+		writeJSON(w, http.StatusOK, ollama.Tags(models))
+	}
+}
+
+// ollamaVersionHandler reports a fixed Ollama version.
+func (s *Server) ollamaVersionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"version": ollamaVersion})
+	}
+}
+
+// ollamaChatHandler serves /api/chat on top of Copilot chat completions.
+func (s *Server) ollamaChatHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		s.logger.Info("Incoming Ollama chat request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
+
+		bodyBytes, ok := s.readOllamaBody(w, r)
+		if !ok {
+			return
+		}
+		req, err := ollama.DecodeChatRequest(bodyBytes)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ollama.ErrorResponse{Error: err.Error()})
+			return
+		}
+		chatReq, err := ollama.ChatToCompletion(req)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ollama.ErrorResponse{Error: err.Error()})
+			return
+		}
+		s.serveOllama(w, r, chatReq, ollama.NewChatConverter(req.Model, startTime), startTime)
+	}
+}
+
+// ollamaGenerateHandler serves /api/generate on top of Copilot chat completions.
+func (s *Server) ollamaGenerateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		s.logger.Info("Incoming Ollama generate request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
+
+		bodyBytes, ok := s.readOllamaBody(w, r)
+		if !ok {
+			return
+		}
+		req, err := ollama.DecodeGenerateRequest(bodyBytes)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ollama.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		// An empty prompt is how Ollama clients ask for a model to be loaded.
+		if req.Prompt == "" && len(req.Images) == 0 {
+			writeJSON(w, http.StatusOK, ollama.GenerateResponse{
+				Model:     req.Model,
+				CreatedAt: ollama.Timestamp(time.Now()),
+				Done:      true,
+				Metrics:   ollama.Metrics{DoneReason: "load"},
+			})
+			return
+		}
+
+		chatReq, err := ollama.GenerateToCompletion(req)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ollama.ErrorResponse{Error: err.Error()})
+			return
+		}
+		s.serveOllama(w, r, chatReq, ollama.NewGenerateConverter(req.Model, startTime), startTime)
+	}
+}
+
+func (s *Server) readOllamaBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ollama.ErrorResponse{Error: "method not allowed"})
+		return nil, false
+	}
+	_, span := tracing.Start(r.Context(), "parse request", tracing.KindInternal)
+	defer span.End()
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		span.SetError(err)
+		s.logger.Error("Failed to read request body", "error", err)
+		writeJSON(w, http.StatusBadRequest, ollama.ErrorResponse{Error: "failed to read request body"})
+		return nil, false
+	}
+	return bodyBytes, true
+}
+
+// serveOllama sends chatReq upstream and writes the result as Ollama records,
+// converting SSE to NDJSON when streaming.
+func (s *Server) serveOllama(w http.ResponseWriter, r *http.Request, chatReq *openai.ChatCompletionRequest, converter *ollama.Converter, startTime time.Time) {
+	s.logger.Info("Request model", "model", chatReq.Model, "stream", chatReq.Stream)
+	s.setMetricsModel(r, chatReq.Model)
+
+	chatBody, err := json.Marshal(chatReq)
+	if err != nil {
+		s.logger.Error("Failed to marshal translated request", "error", err)
+		writeJSON(w, http.StatusInternalServerError, ollama.ErrorResponse{Error: "failed to translate request"})
+		return
+	}
+
+	chatBody, issue := s.prepareChatRequest(r.Context(), chatBody)
+	if issue != nil {
+		writeJSON(w, http.StatusBadRequest, ollama.ErrorResponse{Error: issue.Message})
+		return
+	}
+
+	upstreamResp, err := s.copilotClient.ChatCompletion(r.Context(), chatBody)
+	upstreamTime := time.Since(startTime)
+	if err != nil {
+		s.logger.Error("Upstream request failed", "error", err, "upstream_duration_ms", upstreamTime.Milliseconds())
+		status, message := upstreamFailure(err)
+		writeJSON(w, status, ollama.ErrorResponse{Error: message})
+		return
+	}
+	defer upstreamResp.Body.Close()
+	copilot.CopyQuotaHeaders(w.Header(), upstreamResp.Header)
+
+	if upstreamResp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(upstreamResp.Body)
+		s.logger.Error("Upstream request returned non-OK status",
+			"status", upstreamResp.Status,
+			"upstream_duration_ms", upstreamTime.Milliseconds(),
+			"body", string(errBody))
+		writeJSON(w, upstreamResp.StatusCode, ollama.ErrorResponse{Error: upstreamErrorMessage(errBody, upstreamResp.Status)})
+		return
+	}
+
+	if !chatReq.Stream {
+		var chatResp openai.ChatCompletionResponse
+		if err := json.NewDecoder(upstreamResp.Body).Decode(&chatResp); err != nil {
+			s.logger.Error("Failed to decode upstream response", "error", err)
+			writeJSON(w, http.StatusBadGateway, ollama.ErrorResponse{Error: "failed to decode upstream response"})
+			return
+		}
+		writeJSON(w, http.StatusOK, converter.Complete(&chatResp))
+		s.recordUsage(r, chatBody, false, chatResp.Usage)
+	} else {
+		sw, done := httpstreaming.TrackStream(r.Context(), w)
+		u := s.streamOllamaResponse(sw, upstreamResp.Body, converter)
+		done()
+		s.recordUsage(r, chatBody, true, u)
+	}
+
+	s.logger.Info("Request completed",
+		"upstream_duration_ms", upstreamTime.Milliseconds(),
+		"total_duration_ms", time.Since(startTime).Milliseconds())
+}
+
+// streamOllamaResponse converts an upstream SSE stream into NDJSON records.
+// It returns the usage the stream reported.
+func (s *Server) streamOllamaResponse(w http.ResponseWriter, body io.Reader, converter *ollama.Converter) *openai.Usage {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	stream := httpstreaming.NewStream(body)
+	err := stream.Each(func(data []byte) error {
+		var chunk openai.ChatCompletionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			s.logger.Warn("Skipping malformed upstream chunk", "error", err)
+			return nil
+		}
+		for _, record := range converter.HandleChunk(&chunk) {
+			if err := httpstreaming.WriteJSONLine(w, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Ollama stream interrupted", "error", err)
+		httpstreaming.WriteJSONLine(w, ollama.ErrorResponse{Error: streamInterruption(err)})
+		return stream.Stats().Usage
+	}
+
+	if err := httpstreaming.WriteJSONLine(w, converter.Finish()); err != nil {
+		s.logger.Error("Failed to write final record to client", "error", err)
+	}
+	return stream.Stats().Usage
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"copilot-api-proxy/pkg/ollama"
+	"copilot-api-proxy/pkg/openai"
+)
+
+// sseReply answers with chunks as server-sent events. Unless complete is
+// set, the connection is cut after the last chunk, without "[DONE]".
+func sseReply(complete bool, chunks ...string) func(openai.ChatCompletionRequest, http.ResponseWriter) {
+	return func(req openai.ChatCompletionRequest, w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		if !complete {
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+// readRecords decodes an NDJSON body into raw records.
+func readRecords(t *testing.T, resp *http.Response) []map[string]any {
+	t.Helper()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	var records []map[string]any
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestOllamaChatStreamsNDJSON(t *testing.T) {
+	upstream := &chatRecorder{reply: sseReply(true,
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Let me"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":" check"}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"Paris\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"length"}],"usage":{"prompt_tokens":9,"completion_tokens":4,"total_tokens":13}}`,
+	)}
+	proxy := serveUpstream(t, upstream)
+
+	records := readRecords(t, post(t, proxy, "/api/chat", `{"model":"gpt-4.1","messages":[{"role":"user","content":"weather?"}]}`))
+	if !upstream.last().Stream {
+		t.Error("upstream request not streamed although Ollama streams by default")
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want two content records and a final one: %v", len(records), records)
+	}
+	for i, want := range []string{"Let me", " check"} {
+		message := records[i]["message"].(map[string]any)
+		if message["content"] != want || records[i]["done"] != false || message["tool_calls"] != nil {
+			t.Errorf("record %d = %v, want content %q without tool calls", i, records[i], want)
+		}
+	}
+	final := records[2]
+	if final["done"] != true || final["done_reason"] != "length" || final["eval_count"] != 4.0 {
+		t.Errorf("final record = %v, want done with reason length and 4 eval tokens", final)
+	}
+	calls, _ := json.Marshal(final["message"].(map[string]any)["tool_calls"])
+	if want := `[{"function":{"arguments":{"city":"Paris"},"name":"weather"}}]`; string(calls) != want {
+		t.Errorf("tool calls = %s, want %s", calls, want)
+	}
+}
+
+func TestOllamaStreamReportsInterruption(t *testing.T) {
+	upstream := &chatRecorder{reply: sseReply(false,
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"partial"}}]}`,
+	)}
+	proxy := serveUpstream(t, upstream)
+
+	records := readRecords(t, post(t, proxy, "/api/generate", `{"model":"gpt-4.1","prompt":"hi"}`))
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want the content and an error record: %v", len(records), records)
+	}
+	if records[0]["response"] != "partial" {
+		t.Errorf("first record = %v, want the partial content", records[0])
+	}
+	if records[1]["error"] != "Upstream stream interrupted" || records[1]["done"] != nil {
+		t.Errorf("last record = %v, want an error record instead of a done record", records[1])
+	}
+}
+
+func TestOllamaGenerateEmptyPromptLoadsModel(t *testing.T) {
+	upstream := &chatRecorder{reply: func(openai.ChatCompletionRequest, http.ResponseWriter) {
+		t.Error("empty prompt was sent upstream")
+	}}
+	proxy := serveUpstream(t, upstream)
+
+	var record ollama.GenerateResponse
+	if err := json.NewDecoder(post(t, proxy, "/api/generate", `{"model":"gpt-4.1","prompt":""}`).Body).Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Model != "gpt-4.1" || !record.Done || record.DoneReason != "load" || record.Response != "" {
+		t.Errorf("record = %+v, want an empty done record with reason load", record)
+	}
+	if strings.TrimSpace(record.CreatedAt) == "" {
+		t.Error("load record has no created_at")
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// quotaHandler reports the Copilot plan and remaining quotas of every
+// account, as last polled from GitHub. With refresh=true the quotas are
+// fetched again before answering.
+func (s *Server) quotaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+		monitor := s.copilotClient.QuotaMonitor()
+		if monitor == nil {
+			writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "Quota monitoring is not enabled")
+			return
+		}
+		if refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh")); refresh {
+			monitor.Refresh(r.Context())
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"object": "list",
+			"data":   monitor.Snapshot(),
+		})
+	}
+}
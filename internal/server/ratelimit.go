@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rateLimit rejects requests that exceed the configured limits with a 429
+// and reports the caller's remaining allowance in x-ratelimit-* headers.
+func (s *Server) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		decision, release := s.limiter.Acquire(clientID(r))
+		defer release()
+
+		if decision.Limit > 0 {
+			w.Header().Set("x-ratelimit-limit-requests", strconv.Itoa(decision.Limit))
+			w.Header().Set("x-ratelimit-remaining-requests", strconv.Itoa(decision.Remaining))
+			w.Header().Set("x-ratelimit-reset-requests", formatReset(decision.Reset))
+		}
+
+		if !decision.Allowed {
+			retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, retryAfter)))
+			s.logger.Warn("Request rate limited",
+				"client", clientName(r),
+				"scope", decision.Scope,
+				"reason", decision.Reason,
+				"retry_after_s", retryAfter)
+			writeOpenAIErrorCode(w, http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded",
+				fmt.Sprintf("Rate limit exceeded: %s. Please retry after %d seconds.", decision.Reason, max(1, retryAfter)))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// formatReset renders a reset duration the way OpenAI does, e.g. "1s" or "6m0s".
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return strconv.Itoa(int(d.Milliseconds())) + "ms"
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/ratelimit"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limiter, err := ratelimit.New(ratelimit.Limits{RequestsPerMinute: 2}, ratelimit.Limits{}, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New("0", logger, nil, WithRateLimiter(limiter), WithAuthDisabled())
+	handler := s.rateLimit(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	do := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		return rec
+	}
+
+	rec := do()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"x-ratelimit-limit-requests":     "2",
+		"x-ratelimit-remaining-requests": "1",
+		"x-ratelimit-reset-requests":     "30s",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if rec.Header().Get("Retry-After") != "" {
+		t.Error("Retry-After set on an allowed request")
+	}
+
+	do()
+	rec = do()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := rec.Header().Get("x-ratelimit-remaining-requests"); got != "0" {
+		t.Errorf("x-ratelimit-remaining-requests = %q, want 0", got)
+	}
+	var body openai.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body is not OpenAI-style JSON: %v: %s", err, rec.Body)
+	}
+	if body.Error.Type != "rate_limit_error" || body.Error.Code != "rate_limit_exceeded" {
+		t.Errorf("error = %+v, want rate_limit_error/rate_limit_exceeded", body.Error)
+	}
+}
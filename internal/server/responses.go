@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/httpstreaming"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/responses"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// responsesHandler serves the OpenAI Responses API on top of Copilot chat
+// completions.
+func (s *Server) responsesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		s.logger.Info("Incoming responses request", "method", r.Method, "path", r.URL.Path, "client", clientName(r))
+
+		if r.Method != http.MethodPost {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+
+		_, parseSpan := tracing.Start(r.Context(), "parse request", tracing.KindInternal)
+		bodyBytes, err := io.ReadAll(r.Body)
+		if err != nil {
+			parseSpan.SetError(err)
+			parseSpan.End()
+			s.logger.Error("Failed to read request body", "error", err)
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
+			return
+		}
+
+		respReq, err := responses.DecodeRequest(bodyBytes)
+		parseSpan.SetError(err)
+		parseSpan.End()
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		s.logger.Info("Request model", "model", respReq.Model, "stream", respReq.Stream)
+		s.setMetricsModel(r, respReq.Model)
+
+		var history []openai.Message
+		if respReq.PreviousResponseID != "" {
+			var ok bool
+			history, ok = s.responseStore.Conversation(respReq.PreviousResponseID)
+			if !ok {
+				writeOpenAIError(w, http.StatusNotFound, "invalid_request_error",
+					"Previous response with id '"+respReq.PreviousResponseID+"' not found.")
+				return
+			}
+		}
+
+		chatReq, conversation, err := responses.ToChatCompletion(respReq, history)
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		chatBody, err := json.Marshal(chatReq)
+		if err != nil {
+			s.logger.Error("Failed to marshal translated request", "error", err)
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to translate request")
+			return
+		}
+
+		chatBody, issue := s.prepareChatRequest(r.Context(), chatBody)
+		if issue != nil {
+			writeValidationError(w, issue)
+			return
+		}
+
+		upstreamResp, err := s.copilotClient.ChatCompletion(r.Context(), chatBody)
+		upstreamTime := time.Since(startTime)
+		if err != nil {
+			s.logger.Error("Upstream request failed", "error", err, "upstream_duration_ms", upstreamTime.Milliseconds())
+			status, message := upstreamFailure(err)
+			writeOpenAIError(w, status, "server_error", message)
+			return
+		}
+		defer upstreamResp.Body.Close()
+		copilot.CopyQuotaHeaders(w.Header(), upstreamResp.Header)
+
+		if upstreamResp.StatusCode != http.StatusOK {
+			errBody, _ := io.ReadAll(upstreamResp.Body)
+			s.logger.Error("Upstream request returned non-OK status",
+				"status", upstreamResp.Status,
+				"upstream_duration_ms", upstreamTime.Milliseconds(),
+				"body", string(errBody))
+			writeOpenAIError(w, upstreamResp.StatusCode,
+				openAIErrorType(upstreamResp.StatusCode), upstreamErrorMessage(errBody, upstreamResp.Status))
+			return
+		}
+
+		id := responses.NewID("resp")
+		var final *responses.Response
+		if respReq.Stream {
+			sw, done := httpstreaming.TrackStream(r.Context(), w)
+			var u *openai.Usage
+			final, u = s.streamResponsesResponse(sw, upstreamResp.Body, id, respReq)
+			done()
+			s.recordUsage(r, chatBody, true, u)
+		} else {
+			var chatResp openai.ChatCompletionResponse
+			if err := json.NewDecoder(upstreamResp.Body).Decode(&chatResp); err != nil {
+				s.logger.Error("Failed to decode upstream response", "error", err)
+				writeOpenAIError(w, http.StatusBadGateway, "server_error", "Failed to decode upstream response")
+				return
+			}
+			final = responses.FromChatCompletion(id, respReq, &chatResp)
+			writeJSON(w, http.StatusOK, final)
+			s.recordUsage(r, chatBody, false, chatResp.Usage)
+		}
+
+		if final != nil && (respReq.Store == nil || *respReq.Store) {
+			s.responseStore.Put(final, append(conversation, responses.OutputMessages(final.Output)...))
+		}
+
+		s.logger.Info("Request completed",
+			"response_id", id,
+			"upstream_duration_ms", upstreamTime.Milliseconds(),
+			"total_duration_ms", time.Since(startTime).Milliseconds())
+	}
+}
+
+// streamResponsesResponse translates an upstream chat completions SSE stream
+// into Responses streaming events. It returns the final response, or nil if
+// the stream failed, and the usage the stream reported.
+func (s *Server) streamResponsesResponse(w http.ResponseWriter, body io.Reader, id string, req *responses.Request) (*responses.Response, *openai.Usage) {
+	httpstreaming.PrepareStream(w)
+	translator := responses.NewStreamTranslator(id, req)
+
+	writeEvents := func(events []responses.Event) error {
+		for _, event := range events {
+			if err := httpstreaming.WriteEvent(w, event.Name, event.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := writeEvents(translator.Start()); err != nil {
+		s.logger.Error("Failed to write events to client", "error", err)
+		return nil, nil
+	}
+
+	stream := httpstreaming.NewStream(body)
+	err := stream.Each(func(data []byte) error {
+		var chunk openai.ChatCompletionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			s.logger.Warn("Skipping malformed upstream chunk", "error", err)
+			return nil
+		}
+		return writeEvents(translator.HandleChunk(&chunk))
+	})
+	if err != nil {
+		s.logger.Error("Responses stream interrupted", "error", err)
+		writeEvents(translator.Fail(streamInterruption(err)))
+		return nil, stream.Stats().Usage
+	}
+
+	events, final := translator.Finish()
+	if err := writeEvents(events); err != nil {
+		s.logger.Error("Failed to write final events to client", "error", err)
+	}
+	return final, stream.Stats().Usage
+}
+
+// responseByIDHandler retrieves or deletes a stored response.
+func (s *Server) responseByIDHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/responses/")
+		if id == "" || strings.Contains(id, "/") {
+			writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "Unknown response path")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			resp, ok := s.responseStore.Get(id)
+			if !ok {
+				writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "Response with id '"+id+"' not found.")
+				return
+			}
+			writeJSON(w, http.StatusOK, resp)
+		case http.MethodDelete:
+			if !s.responseStore.Delete(id) {
+				writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "Response with id '"+id+"' not found.")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "object": "response", "deleted": true})
+		default:
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/responses"
+)
+
+// chatRecorder is an upstream that answers chat completions with reply and
+// keeps the requests it received.
+type chatRecorder struct {
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+	reply    func(req openai.ChatCompletionRequest, w http.ResponseWriter)
+}
+
+func (c *chatRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.mu.Unlock()
+	c.reply(req, w)
+}
+
+func (c *chatRecorder) last() openai.ChatCompletionRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests[len(c.requests)-1]
+}
+
+// echoReply answers with "reply N" where N counts the messages received.
+func echoReply(req openai.ChatCompletionRequest, w http.ResponseWriter) {
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.Choice{{Message: openai.ResponseMessage{Role: "assistant", Content: fmt.Sprintf("reply %d", len(req.Messages))}, FinishReason: "stop"}},
+	})
+}
+
+func TestResponsesChainsPreviousResponse(t *testing.T) {
+	upstream := &chatRecorder{reply: echoReply}
+	proxy := serveUpstream(t, upstream)
+
+	var first responses.Response
+	if err := json.NewDecoder(post(t, proxy, "/v1/responses", `{"model":"m","input":"hello"}`).Body).Decode(&first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != "completed" || len(first.Output) != 1 || first.Output[0].Content[0].Text != "reply 1" {
+		t.Fatalf("first response = %+v", first)
+	}
+
+	var second responses.Response
+	body := fmt.Sprintf(`{"model":"m","previous_response_id":%q,"input":[{"role":"user","content":"again"}]}`, first.ID)
+	if err := json.NewDecoder(post(t, proxy, "/v1/responses", body).Body).Decode(&second); err != nil {
+		t.Fatal(err)
+	}
+	if second.PreviousResponseID == nil || *second.PreviousResponseID != first.ID {
+		t.Errorf("previous_response_id = %v, want %s", second.PreviousResponseID, first.ID)
+	}
+	got, _ := json.Marshal(upstream.last().Messages)
+	want := `[{"role":"user","content":"hello"},{"role":"assistant","content":"reply 1"},{"role":"user","content":"again"}]`
+	if string(got) != want {
+		t.Errorf("upstream messages = %s\nwant %s", got, want)
+	}
+
+	resp, err := http.Post(proxy.URL+"/v1/responses", "application/json", strings.NewReader(`{"model":"m","previous_response_id":"resp_missing","input":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown previous_response_id: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestResponsesStreamsToolCalls(t *testing.T) {
+	upstream := &chatRecorder{reply: func(req openai.ChatCompletionRequest, w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Checking"}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":7,"total_tokens":19}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}}
+	proxy := serveUpstream(t, upstream)
+
+	resp := post(t, proxy, "/v1/responses", `{"model":"m","stream":true,"input":"weather in Paris?",
+		"tools":[{"type":"function","name":"weather","parameters":{"type":"object"}}]}`)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	if tools := upstream.last().Tools; len(tools) != 1 || tools[0].Function.Name != "weather" {
+		t.Errorf("upstream tools = %+v, want the weather function", tools)
+	}
+
+	var names []string
+	var completed responses.Response
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			names = append(names, name)
+			continue
+		}
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || names[len(names)-1] != "response.completed" {
+			continue
+		}
+		var event struct {
+			Response responses.Response `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		completed = event.Response
+	}
+
+	want := []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}
+	if !slices.Equal(names, want) {
+		t.Fatalf("events:\n%v\nwant:\n%v", names, want)
+	}
+	if len(completed.Output) != 2 || completed.Output[1].Arguments != `{"city":"Paris"}` {
+		t.Errorf("completed output = %+v, want the text and the assembled call", completed.Output)
+	}
+	if completed.Usage == nil || completed.Usage.TotalTokens != 19 {
+		t.Errorf("completed usage = %+v, want 19 tokens", completed.Usage)
+	}
+}
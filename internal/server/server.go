@@ -4,25 +4,130 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"copilot-api-proxy/pkg/apikeys"
 	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/models"
+	"copilot-api-proxy/pkg/ratelimit"
+	"copilot-api-proxy/pkg/recording"
+	"copilot-api-proxy/pkg/responses"
+	"copilot-api-proxy/pkg/usage"
 )
 
+// maxStoredResponses bounds how many Responses API results are kept for
+// previous_response_id chaining.
+const maxStoredResponses = 1000
+
 // Server is the main HTTP server for the proxy.
 type Server struct {
 	addr          string
 	logger        *slog.Logger
 	copilotClient *copilot.Client
+	responseStore *responses.Store
+	apiKeys       *apikeys.Store
+	authDisabled  bool
+	limiter       *ratelimit.Limiter
+	modelTable    *models.Table
+	modelRegistry *models.Registry
+	validator     *models.Validator
+	usageLedger   *usage.Ledger
+	recording     *recording.Middleware
+
+	version   string
+	startedAt time.Time
+	inFlight  atomic.Int64
+}
+
+// Option configures optional server features.
+type Option func(*Server)
+
+// WithAPIKeys authenticates inbound requests against the given key store.
+func WithAPIKeys(store *apikeys.Store) Option {
+	return func(s *Server) {
+		s.apiKeys = store
+	}
+}
+
+// WithAuthDisabled serves requests without an API key. Without it, requests
+// are rejected until a key has been issued.
+func WithAuthDisabled() Option {
+	return func(s *Server) {
+		s.authDisabled = true
+	}
+}
+
+// WithRecording records the exchanges with clients to recorder, next to
+// the upstream exchanges recorded by the Copilot client.
+func WithRecording(recorder *recording.Recorder) Option {
+	return func(s *Server) {
+		s.recording = &recording.Middleware{Recorder: recorder, Logger: s.logger}
+	}
+}
+
+// WithRateLimiter enables request rate limiting.
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(s *Server) {
+		s.limiter = limiter
+	}
+}
+
+// WithModelTable enables model aliases and virtual model presets.
+func WithModelTable(table *models.Table) Option {
+	return func(s *Server) {
+		s.modelTable = table
+	}
+}
+
+// WithModelRegistry sets the model registry, for example to use a different
+// cache TTL. By default a registry with models.DefaultCacheTTL is used.
+func WithModelRegistry(registry *models.Registry) Option {
+	return func(s *Server) {
+		s.modelRegistry = registry
+	}
+}
+
+// WithValidator enables pre-flight validation of chat requests against the
+// model capabilities.
+func WithValidator(validator *models.Validator) Option {
+	return func(s *Server) {
+		s.validator = validator
+	}
+}
+
+// WithUsageLedger records the token usage of each request in ledger and
+// serves reports from it on /v1/usage.
+func WithUsageLedger(ledger *usage.Ledger) Option {
+	return func(s *Server) {
+		s.usageLedger = ledger
+	}
+}
+
+// WithVersion sets the version reported by /status.
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
 }
 
 // New creates a new server instance.
-func New(port string, logger *slog.Logger, client *copilot.Client) *Server {
-	return &Server{
+func New(port string, logger *slog.Logger, client *copilot.Client, opts ...Option) *Server {
+	s := &Server{
 		addr:          ":" + port,
 		logger:        logger,
 		copilotClient: client,
+		responseStore: responses.NewStore(maxStoredResponses),
+		version:       "dev",
+		startedAt:     time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.modelRegistry == nil {
+		s.modelRegistry = models.NewRegistry(client, models.DefaultCacheTTL, logger)
 	}
+	return s
 }
 
 // Start runs the HTTP server and blocks until the context is canceled.
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"copilot-api-proxy/pkg/metrics"
+	"copilot-api-proxy/pkg/openai"
+	"copilot-api-proxy/pkg/usage"
+)
+
+// recordUsage adds the token usage of a completed request to the usage
+// ledger. chatBody is the chat completions request sent upstream, which
+// names the model after aliases were applied.
+func (s *Server) recordUsage(r *http.Request, chatBody []byte, stream bool, u *openai.Usage) {
+	if s.usageLedger == nil {
+		return
+	}
+	if u == nil {
+		s.logger.Debug("Upstream reported no usage", "path", r.URL.Path)
+		return
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(chatBody, &req)
+	rec := usage.NewRecord(clientName(r), req.Model, metrics.RequestInfoFrom(r.Context()).Route, stream, u)
+	if err := s.usageLedger.Add(rec); err != nil {
+		s.logger.Error("Failed to record usage", "error", err)
+	}
+}
+
+// usageHandler reports token usage from the ledger, rolled up by day or
+// month, client and model. Query parameters: period (day or month), from
+// and to (inclusive dates, YYYY-MM-DD), client and model.
+func (s *Server) usageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+			return
+		}
+		if s.usageLedger == nil {
+			writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "Usage metering is not enabled")
+			return
+		}
+		params := r.URL.Query()
+		q, err := usage.ParseQuery(params.Get("period"), params.Get("from"), params.Get("to"), params.Get("client"), params.Get("model"))
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		report, err := s.usageLedger.Report(q)
+		if err != nil {
+			s.logger.Error("Failed to read usage ledger", "error", err)
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to read usage ledger")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,211 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// ToChatCompletion converts an Anthropic Messages request into the equivalent
+// OpenAI chat completions request understood by Copilot.
+func ToChatCompletion(req *MessagesRequest) (*openai.ChatCompletionRequest, error) {
+	out := &openai.ChatCompletionRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+		Stream:      req.Stream,
+	}
+	if req.Stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.Metadata != nil {
+		out.User = req.Metadata.UserID
+	}
+
+	if system := joinText(req.System); system != "" {
+		out.Messages = append(out.Messages, openai.Message{Role: "system", Content: system})
+	}
+
+	for i, msg := range req.Messages {
+		var converted []openai.Message
+		var err error
+		switch msg.Role {
+		case "user":
+			converted, err = convertUserMessage(msg.Content)
+		case "assistant":
+			converted, err = convertAssistantMessage(msg.Content)
+		default:
+			err = fmt.Errorf("unsupported role %q", msg.Role)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		out.Messages = append(out.Messages, converted...)
+	}
+
+	for _, tool := range req.Tools {
+		out.Tools = append(out.Tools, openai.Tool{
+			Type: "function",
+			Function: openai.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	if req.ToolChoice != nil && len(req.Tools) > 0 {
+		switch req.ToolChoice.Type {
+		case "auto":
+			out.ToolChoice = "auto"
+		case "any":
+			out.ToolChoice = "required"
+		case "none":
+			out.ToolChoice = "none"
+		case "tool":
+			out.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": req.ToolChoice.Name},
+			}
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice type %q", req.ToolChoice.Type)
+		}
+	}
+
+	return out, nil
+}
+
+// convertUserMessage splits a user turn into OpenAI messages. Tool results
+// become separate "tool" messages, which must directly follow the assistant
+// message that issued the calls, so they are emitted before the user content.
+func convertUserMessage(content Content) ([]openai.Message, error) {
+	var toolMessages []openai.Message
+	var parts []openai.ContentPart
+	hasImage := false
+
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, openai.ContentPart{Type: "text", Text: block.Text})
+		case "image":
+			part, err := convertImage(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+			hasImage = true
+		case "tool_result":
+			text := joinText(block.Content)
+			if block.IsError && text != "" {
+				text = "Error: " + text
+			}
+			toolMessages = append(toolMessages, openai.Message{
+				Role:       "tool",
+				ToolCallID: block.ToolUseID,
+				Content:    text,
+			})
+		case "thinking", "redacted_thinking":
+			// Copilot has no equivalent for replayed reasoning; drop it.
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+	}
+
+	messages := toolMessages
+	if len(parts) > 0 {
+		var body any = parts
+		if !hasImage {
+			body = joinParts(parts)
+		}
+		messages = append(messages, openai.Message{Role: "user", Content: body})
+	}
+	return messages, nil
+}
+
+func convertAssistantMessage(content Content) ([]openai.Message, error) {
+	msg := openai.Message{Role: "assistant"}
+	var text []string
+
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: args,
+				},
+			})
+		case "thinking", "redacted_thinking":
+			// Not replayable upstream; drop it.
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q in assistant message", block.Type)
+		}
+	}
+
+	if len(text) > 0 {
+		msg.Content = strings.Join(text, "\n\n")
+	}
+	return []openai.Message{msg}, nil
+}
+
+func convertImage(source *ImageSource) (openai.ContentPart, error) {
+	if source == nil {
+		return openai.ContentPart{}, fmt.Errorf("image block without source")
+	}
+	var url string
+	switch source.Type {
+	case "base64":
+		url = "data:" + source.MediaType + ";base64," + source.Data
+	case "url":
+		url = source.URL
+	default:
+		return openai.ContentPart{}, fmt.Errorf("unsupported image source type %q", source.Type)
+	}
+	return openai.ContentPart{Type: "image_url", ImageURL: &openai.ImageURL{URL: url}}, nil
+}
+
+// joinText concatenates the text of all text blocks.
+func joinText(blocks []ContentBlock) string {
+	var text []string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			text = append(text, block.Text)
+		}
+	}
+	return strings.Join(text, "\n\n")
+}
+
+func joinParts(parts []openai.ContentPart) string {
+	text := make([]string, 0, len(parts))
+	for _, part := range parts {
+		text = append(text, part.Text)
+	}
+	return strings.Join(text, "\n\n")
+}
+
+// DecodeRequest parses and minimally validates a Messages request body.
+func DecodeRequest(body []byte) (*MessagesRequest, error) {
+	var req MessagesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("model: field required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("messages: at least one message is required")
+	}
+	return &req, nil
+}
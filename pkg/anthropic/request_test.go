@@ -0,0 +1,151 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// assertJSON compares the JSON encoding of got with the JSON document want,
+// ignoring formatting and key order.
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	gotBytes, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var gotValue, wantValue any
+	if err := json.Unmarshal(gotBytes, &gotValue); err != nil {
+		t.Fatalf("unmarshal got: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("unmarshal want: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		pretty, _ := json.MarshalIndent(gotValue, "", "  ")
+		t.Errorf("got:\n%s\nwant:\n%s", pretty, want)
+	}
+}
+
+func TestToChatCompletion(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "string system and content",
+			in: `{"model":"claude-sonnet-4","max_tokens":100,"system":"Be brief.",
+				"messages":[{"role":"user","content":"Hi"}]}`,
+			want: `{"model":"claude-sonnet-4","max_tokens":100,"messages":[
+				{"role":"system","content":"Be brief."},
+				{"role":"user","content":"Hi"}]}`,
+		},
+		{
+			name: "system blocks are joined",
+			in: `{"model":"m","max_tokens":10,
+				"system":[{"type":"text","text":"One."},{"type":"text","text":"Two.","cache_control":{"type":"ephemeral"}}],
+				"messages":[{"role":"user","content":[{"type":"text","text":"a"},{"type":"text","text":"b"}]}]}`,
+			want: `{"model":"m","max_tokens":10,"messages":[
+				{"role":"system","content":"One.\n\nTwo."},
+				{"role":"user","content":"a\n\nb"}]}`,
+		},
+		{
+			name: "tool_use and tool_result",
+			in: `{"model":"m","max_tokens":10,
+				"tools":[{"name":"get_weather","description":"Weather","input_schema":{"type":"object"}}],
+				"tool_choice":{"type":"tool","name":"get_weather"},
+				"messages":[
+					{"role":"user","content":"Weather in Paris?"},
+					{"role":"assistant","content":[
+						{"type":"thinking","thinking":"hmm"},
+						{"type":"text","text":"Checking."},
+						{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+					{"role":"user","content":[
+						{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"18C"}]},
+						{"type":"text","text":"And tomorrow?"}]}]}`,
+			want: `{"model":"m","max_tokens":10,
+				"messages":[
+					{"role":"user","content":"Weather in Paris?"},
+					{"role":"assistant","content":"Checking.","tool_calls":[
+						{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+					{"role":"tool","tool_call_id":"toolu_1","content":"18C"},
+					{"role":"user","content":"And tomorrow?"}],
+				"tools":[{"type":"function","function":{"name":"get_weather","description":"Weather","parameters":{"type":"object"}}}],
+				"tool_choice":{"type":"function","function":{"name":"get_weather"}}}`,
+		},
+		{
+			name: "tool_result error and empty input",
+			in: `{"model":"m","max_tokens":10,"tools":[{"name":"t","input_schema":{}}],"tool_choice":{"type":"any"},
+				"messages":[
+					{"role":"assistant","content":[{"type":"tool_use","id":"toolu_2","name":"t"}]},
+					{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_2","is_error":true,"content":"boom"}]}]}`,
+			want: `{"model":"m","max_tokens":10,
+				"messages":[
+					{"role":"assistant","tool_calls":[{"id":"toolu_2","type":"function","function":{"name":"t","arguments":"{}"}}]},
+					{"role":"tool","tool_call_id":"toolu_2","content":"Error: boom"}],
+				"tools":[{"type":"function","function":{"name":"t","parameters":{}}}],
+				"tool_choice":"required"}`,
+		},
+		{
+			name: "image and streaming",
+			in: `{"model":"m","max_tokens":10,"stream":true,"stop_sequences":["END"],"metadata":{"user_id":"u1"},
+				"messages":[{"role":"user","content":[
+					{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAAA"}},
+					{"type":"text","text":"What is this?"}]}]}`,
+			want: `{"model":"m","max_tokens":10,"stream":true,"stream_options":{"include_usage":true},"stop":["END"],"user":"u1",
+				"messages":[{"role":"user","content":[
+					{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},
+					{"type":"text","text":"What is this?"}]}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := DecodeRequest([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("DecodeRequest: %v", err)
+			}
+			got, err := ToChatCompletion(req)
+			if err != nil {
+				t.Fatalf("ToChatCompletion: %v", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestToChatCompletionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"unknown role", `{"model":"m","messages":[{"role":"system","content":"x"}]}`},
+		{"unknown block", `{"model":"m","messages":[{"role":"user","content":[{"type":"document"}]}]}`},
+		{"unknown tool_choice", `{"model":"m","tools":[{"name":"t","input_schema":{}}],"tool_choice":{"type":"maybe"},"messages":[{"role":"user","content":"x"}]}`},
+		{"image without source", `{"model":"m","messages":[{"role":"user","content":[{"type":"image"}]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := DecodeRequest([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("DecodeRequest: %v", err)
+			}
+			if _, err := ToChatCompletion(req); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecodeRequestValidation(t *testing.T) {
+	for _, in := range []string{
+		`{`,
+		`{"messages":[{"role":"user","content":"x"}]}`,
+		`{"model":"m","messages":[]}`,
+	} {
+		if _, err := DecodeRequest([]byte(in)); err == nil {
+			t.Errorf("DecodeRequest(%s): expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// FromChatCompletion converts a non-streamed chat completions response into an
+// Anthropic Messages response. Copilot sometimes splits text and tool calls
+// across several choices, so all choices are merged into one message.
+func FromChatCompletion(resp *openai.ChatCompletionResponse, model string) *MessagesResponse {
+	out := &MessagesResponse{
+		ID:      messageID(resp.ID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []ContentBlock{},
+	}
+
+	finishReason := ""
+	for _, choice := range resp.Choices {
+		if choice.Message.Content != "" {
+			out.Content = append(out.Content, ContentBlock{Type: "text", Text: choice.Message.Content})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			out.Content = append(out.Content, ContentBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Function.Name,
+				Input: toolInput(call.Function.Arguments),
+			})
+		}
+		if choice.FinishReason != "" && finishReason != "tool_calls" {
+			finishReason = choice.FinishReason
+		}
+	}
+
+	stopReason := StopReason(finishReason)
+	out.StopReason = &stopReason
+	if resp.Usage != nil {
+		out.Usage = usageFrom(resp.Usage)
+	}
+	return out
+}
+
+// StopReason maps an OpenAI finish_reason onto an Anthropic stop_reason.
+func StopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+func usageFrom(u *openai.Usage) Usage {
+	usage := Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CacheReadInputTokens = u.PromptTokensDetails.CachedTokens
+		usage.InputTokens -= u.PromptTokensDetails.CachedTokens
+	}
+	return usage
+}
+
+// toolInput returns the arguments as a JSON object, falling back to an empty
+// object when the model produced something unparsable.
+func toolInput(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+func messageID(id string) string {
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	if id == "" {
+		return "msg_copilot"
+	}
+	return "msg_" + id
+}
@@ -0,0 +1,75 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+func TestFromChatCompletion(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "text",
+			in: `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`,
+			want: `{"id":"msg_chatcmpl-1","type":"message","role":"assistant","model":"claude-sonnet-4",
+				"content":[{"type":"text","text":"Hello"}],"stop_reason":"end_turn","stop_sequence":null,
+				"usage":{"input_tokens":10,"output_tokens":2}}`,
+		},
+		{
+			name: "tool calls split across choices",
+			in: `{"id":"msg_abc","choices":[
+					{"message":{"role":"assistant","content":"Let me check."},"finish_reason":"stop"},
+					{"message":{"role":"assistant","tool_calls":[
+						{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+						{"id":"call_2","type":"function","function":{"name":"broken","arguments":"{not json"}}]},
+					 "finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":30,"completion_tokens":5,"total_tokens":35,"prompt_tokens_details":{"cached_tokens":20}}}`,
+			want: `{"id":"msg_abc","type":"message","role":"assistant","model":"claude-sonnet-4",
+				"content":[
+					{"type":"text","text":"Let me check."},
+					{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}},
+					{"type":"tool_use","id":"call_2","name":"broken","input":{}}],
+				"stop_reason":"tool_use","stop_sequence":null,
+				"usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":20}}`,
+		},
+		{
+			name: "length without usage",
+			in:   `{"choices":[{"message":{"role":"assistant","content":"Trunc"},"finish_reason":"length"}]}`,
+			want: `{"id":"msg_copilot","type":"message","role":"assistant","model":"claude-sonnet-4",
+				"content":[{"type":"text","text":"Trunc"}],"stop_reason":"max_tokens","stop_sequence":null,
+				"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp openai.ChatCompletionResponse
+			if err := json.Unmarshal([]byte(tt.in), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			assertJSON(t, FromChatCompletion(&resp, "claude-sonnet-4"), tt.want)
+		})
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	tests := map[string]string{
+		"stop":           "end_turn",
+		"":               "end_turn",
+		"length":         "max_tokens",
+		"tool_calls":     "tool_use",
+		"function_call":  "tool_use",
+		"content_filter": "end_turn",
+	}
+	for finishReason, want := range tests {
+		if got := StopReason(finishReason); got != want {
+			t.Errorf("StopReason(%q) = %q, want %q", finishReason, got, want)
+		}
+	}
+}
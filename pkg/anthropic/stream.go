@@ -0,0 +1,158 @@
+package anthropic
+
+import (
+	"copilot-api-proxy/pkg/openai"
+)
+
+// Event is a single Anthropic server-sent event.
+type Event struct {
+	Name string
+	Data any
+}
+
+// StreamTranslator converts a stream of chat completion chunks into the
+// Anthropic streaming event sequence: message_start, content_block_start,
+// content_block_delta, content_block_stop, message_delta and message_stop.
+type StreamTranslator struct {
+	model string
+
+	started      bool
+	blockIndex   int
+	blockOpen    bool
+	blockIsText  bool
+	toolBlocks   map[int]int // OpenAI tool call index -> Anthropic block index
+	finishReason string
+	usage        *openai.Usage
+}
+
+// NewStreamTranslator creates a translator that reports model in message_start.
+func NewStreamTranslator(model string) *StreamTranslator {
+	return &StreamTranslator{
+		model:      model,
+		blockIndex: -1,
+		toolBlocks: make(map[int]int),
+	}
+}
+
+// HandleChunk returns the events produced by one upstream chunk.
+func (t *StreamTranslator) HandleChunk(chunk *openai.ChatCompletionChunk) []Event {
+	var events []Event
+
+	if !t.started {
+		t.started = true
+		events = append(events, Event{Name: "message_start", Data: map[string]any{
+			"type": "message_start",
+			"message": map[string]any{
+				"id":            messageID(chunk.ID),
+				"type":          "message",
+				"role":          "assistant",
+				"model":         t.model,
+				"content":       []any{},
+				"stop_reason":   nil,
+				"stop_sequence": nil,
+				"usage":         map[string]int{"input_tokens": 0, "output_tokens": 0},
+			},
+		}})
+	}
+
+	if chunk.Usage != nil {
+		t.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if !t.blockOpen || !t.blockIsText {
+				events = append(events, t.closeBlock()...)
+				events = append(events, t.openBlock(true, map[string]any{"type": "text", "text": ""}))
+			}
+			events = append(events, Event{Name: "content_block_delta", Data: map[string]any{
+				"type":  "content_block_delta",
+				"index": t.blockIndex,
+				"delta": map[string]any{"type": "text_delta", "text": choice.Delta.Content},
+			}})
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			callIndex := 0
+			if call.Index != nil {
+				callIndex = *call.Index
+			}
+			if _, seen := t.toolBlocks[callIndex]; !seen {
+				events = append(events, t.closeBlock()...)
+				events = append(events, t.openBlock(false, map[string]any{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": map[string]any{},
+				}))
+				t.toolBlocks[callIndex] = t.blockIndex
+			}
+			if call.Function.Arguments != "" {
+				events = append(events, Event{Name: "content_block_delta", Data: map[string]any{
+					"type":  "content_block_delta",
+					"index": t.toolBlocks[callIndex],
+					"delta": map[string]any{"type": "input_json_delta", "partial_json": call.Function.Arguments},
+				}})
+			}
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" && t.finishReason != "tool_calls" {
+			t.finishReason = *choice.FinishReason
+		}
+	}
+
+	return events
+}
+
+// Finish returns the closing events once the upstream stream has ended.
+func (t *StreamTranslator) Finish() []Event {
+	var events []Event
+	if !t.started {
+		events = append(events, t.HandleChunk(&openai.ChatCompletionChunk{})...)
+	}
+	events = append(events, t.closeBlock()...)
+
+	usage := map[string]int{"output_tokens": 0}
+	if t.usage != nil {
+		u := usageFrom(t.usage)
+		usage["output_tokens"] = u.OutputTokens
+		usage["input_tokens"] = u.InputTokens
+	}
+
+	events = append(events,
+		Event{Name: "message_delta", Data: map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": StopReason(t.finishReason), "stop_sequence": nil},
+			"usage": usage,
+		}},
+		Event{Name: "message_stop", Data: map[string]any{"type": "message_stop"}},
+	)
+	return events
+}
+
+// ErrorEvent builds the event sent when the stream fails part-way through.
+func ErrorEvent(errType, message string) Event {
+	return Event{Name: "error", Data: NewError(errType, message)}
+}
+
+func (t *StreamTranslator) openBlock(isText bool, block map[string]any) Event {
+	t.blockIndex++
+	t.blockOpen = true
+	t.blockIsText = isText
+	return Event{Name: "content_block_start", Data: map[string]any{
+		"type":          "content_block_start",
+		"index":         t.blockIndex,
+		"content_block": block,
+	}}
+}
+
+func (t *StreamTranslator) closeBlock() []Event {
+	if !t.blockOpen {
+		return nil
+	}
+	t.blockOpen = false
+	return []Event{{Name: "content_block_stop", Data: map[string]any{
+		"type":  "content_block_stop",
+		"index": t.blockIndex,
+	}}}
+}
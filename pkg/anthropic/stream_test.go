@@ -0,0 +1,112 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// translate runs chunks, given as JSON, through a StreamTranslator and
+// returns every event as {"event": name, "data": data}.
+func translate(t *testing.T, chunks []string) []map[string]any {
+	t.Helper()
+	translator := NewStreamTranslator("claude-sonnet-4")
+	var events []Event
+	for _, raw := range chunks {
+		var chunk openai.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(raw), &chunk); err != nil {
+			t.Fatalf("unmarshal chunk %s: %v", raw, err)
+		}
+		events = append(events, translator.HandleChunk(&chunk)...)
+	}
+	events = append(events, translator.Finish()...)
+
+	out := make([]map[string]any, 0, len(events))
+	for _, event := range events {
+		out = append(out, map[string]any{"event": event.Name, "data": event.Data})
+	}
+	return out
+}
+
+const messageStart = `{"event":"message_start","data":{"type":"message_start","message":{
+	"id":"msg_chatcmpl-1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[],
+	"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}}}`
+
+func TestStreamTranslator(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name: "text with usage",
+			chunks: []string{
+				`{"id":"chatcmpl-1","choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{"content":"lo"}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{},"finish_reason":"stop"}]}`,
+				`{"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":2,"total_tokens":14,"prompt_tokens_details":{"cached_tokens":4}}}`,
+			},
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":0}},
+				{"event":"message_delta","data":{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},
+					"usage":{"input_tokens":8,"output_tokens":2}}},
+				{"event":"message_stop","data":{"type":"message_stop"}}]`,
+		},
+		{
+			name: "text then tool calls",
+			chunks: []string{
+				`{"id":"chatcmpl-1","choices":[{"delta":{"content":"Checking."}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+				`{"id":"chatcmpl-1","choices":[{"delta":{},"finish_reason":"stop"}]}`,
+			},
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":0}},
+				{"event":"content_block_start","data":{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"call_1","name":"get_weather","input":{}}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":1}},
+				{"event":"content_block_start","data":{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"call_2","name":"get_time","input":{}}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{}"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":2}},
+				{"event":"message_delta","data":{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":0}}},
+				{"event":"message_stop","data":{"type":"message_stop"}}]`,
+		},
+		{
+			name: "truncated by length",
+			chunks: []string{
+				`{"id":"chatcmpl-1","choices":[{"delta":{"content":"Long"},"finish_reason":"length"}]}`,
+			},
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Long"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":0}},
+				{"event":"message_delta","data":{"type":"message_delta","delta":{"stop_reason":"max_tokens","stop_sequence":null},"usage":{"output_tokens":0}}},
+				{"event":"message_stop","data":{"type":"message_stop"}}]`,
+		},
+		{
+			name:   "empty stream",
+			chunks: nil,
+			want: `[{"event":"message_start","data":{"type":"message_start","message":{
+					"id":"msg_copilot","type":"message","role":"assistant","model":"claude-sonnet-4","content":[],
+					"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}}},
+				{"event":"message_delta","data":{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":0}}},
+				{"event":"message_stop","data":{"type":"message_stop"}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSON(t, translate(t, tt.chunks), tt.want)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MessagesRequest is an Anthropic Messages API request.
+type MessagesRequest struct {
+	Model         string          `json:"model"`
+	MaxTokens     int             `json:"max_tokens"`
+	System        SystemPrompt    `json:"system,omitempty"`
+	Messages      []Message       `json:"messages"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	TopP          *float64        `json:"top_p,omitempty"`
+	TopK          *int            `json:"top_k,omitempty"`
+	Tools         []Tool          `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice     `json:"tool_choice,omitempty"`
+	Metadata      *Metadata       `json:"metadata,omitempty"`
+	Thinking      json.RawMessage `json:"thinking,omitempty"`
+}
+
+// Metadata carries optional information about the caller.
+type Metadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// SystemPrompt is the system field, which Anthropic accepts either as a plain
+// string or as a list of text blocks.
+type SystemPrompt []ContentBlock
+
+// UnmarshalJSON accepts both the string and the block list form.
+func (s *SystemPrompt) UnmarshalJSON(data []byte) error {
+	blocks, err := unmarshalContent(data)
+	if err != nil {
+		return fmt.Errorf("invalid system prompt: %w", err)
+	}
+	*s = blocks
+	return nil
+}
+
+// Message is a single conversation turn.
+type Message struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// Content is a message body, which Anthropic accepts either as a plain
+// string or as a list of content blocks.
+type Content []ContentBlock
+
+// UnmarshalJSON accepts both the string and the block list form.
+func (c *Content) UnmarshalJSON(data []byte) error {
+	blocks, err := unmarshalContent(data)
+	if err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	*c = blocks
+	return nil
+}
+
+func unmarshalContent(data []byte) ([]ContentBlock, error) {
+	if string(data) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return []ContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// ContentBlock is one element of a message's content. Only the fields
+// relevant to the block's Type are set.
+type ContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image
+	Source *ImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string  `json:"tool_use_id,omitempty"`
+	Content   Content `json:"content,omitempty"`
+	IsError   bool    `json:"is_error,omitempty"`
+
+	// thinking
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// ImageSource describes where an image block's data comes from.
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// Tool is a client tool definition.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice controls how the model uses the provided tools.
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// MessagesResponse is a non-streamed Anthropic Messages API response.
+type MessagesResponse struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+// Usage reports token counts in Anthropic terms.
+type Usage struct {
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// ErrorResponse is the Anthropic error envelope.
+type ErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
+
+// Error describes an API error.
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NewError builds an error envelope.
+func NewError(errType, message string) ErrorResponse {
+	return ErrorResponse{Type: "error", Error: Error{Type: errType, Message: message}}
+}
+
+// ErrorTypeForStatus maps an HTTP status code to the Anthropic error type
+// clients expect for it.
+func ErrorTypeForStatus(status int) string {
+	switch status {
+	case 400:
+		return "invalid_request_error"
+	case 401:
+		return "authentication_error"
+	case 403:
+		return "permission_error"
+	case 404:
+		return "not_found_error"
+	case 413:
+		return "request_too_large"
+	case 429:
+		return "rate_limit_error"
+	case 529, 503:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
@@ -0,0 +1,218 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/fsutil"
+)
+
+// secretPrefix marks keys issued by the proxy.
+const secretPrefix = "cap_"
+
+var (
+	// ErrUnknownKey is returned when a presented key is not in the store.
+	ErrUnknownKey = errors.New("unknown API key")
+	// ErrRevokedKey is returned when a presented key has been revoked.
+	ErrRevokedKey = errors.New("API key has been revoked")
+)
+
+// Key is a proxy-issued API key. Only a hash of the secret is stored.
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked.
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+type keysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Store holds the API keys persisted in the keys file.
+type Store struct {
+	mu     sync.RWMutex
+	path   string
+	keys   []Key
+	byHash map[string]int
+}
+
+// Load reads the keys file at path. A missing file yields an empty store.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the location of the keys file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Reload re-reads the keys file, replacing the in-memory keys.
+func (s *Store) Reload() error {
+	var file keysFile
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read keys file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse keys file %s: %w", s.path, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setKeys(file.Keys)
+	return nil
+}
+
+func (s *Store) setKeys(keys []Key) {
+	s.keys = keys
+	s.byHash = make(map[string]int, len(keys))
+	for i, key := range keys {
+		s.byHash[key.Hash] = i
+	}
+}
+
+// Enabled reports whether any keys have been issued. When none have, the
+// proxy rejects every request unless authentication is disabled.
+func (s *Store) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys) > 0
+}
+
+// Authenticate looks up the key matching secret.
+func (s *Store) Authenticate(secret string) (*Key, error) {
+	hash := hashSecret(secret)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.byHash[hash]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	key := s.keys[i]
+	if key.Revoked() {
+		return &key, ErrRevokedKey
+	}
+	return &key, nil
+}
+
+// List returns a copy of all keys, including revoked ones.
+func (s *Store) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Key(nil), s.keys...)
+}
+
+// Create issues a new key with the given name and persists it. The returned
+// secret is not stored and cannot be recovered later.
+func (s *Store) Create(name string) (string, *Key, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("key name is required")
+	}
+
+	secretBytes := make([]byte, 24)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	secret := secretPrefix + hex.EncodeToString(secretBytes)
+
+	key := Key{
+		ID:        "key_" + hex.EncodeToString(idBytes),
+		Name:      name,
+		Prefix:    secret[:len(secretPrefix)+6],
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.keys {
+		if existing.Name == name && !existing.Revoked() {
+			return "", nil, fmt.Errorf("an active key named %q already exists", name)
+		}
+	}
+	keys := append(append([]Key(nil), s.keys...), key)
+	if err := s.save(keys); err != nil {
+		return "", nil, err
+	}
+	s.setKeys(keys)
+	return secret, &key, nil
+}
+
+// Revoke marks the key with the given id or name as revoked and persists
+// the change.
+func (s *Store) Revoke(idOrName string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := append([]Key(nil), s.keys...)
+	for i := range keys {
+		if (keys[i].ID == idOrName || keys[i].Name == idOrName) && !keys[i].Revoked() {
+			now := time.Now().UTC()
+			keys[i].RevokedAt = &now
+			if err := s.save(keys); err != nil {
+				return nil, err
+			}
+			s.setKeys(keys)
+			key := keys[i]
+			return &key, nil
+		}
+	}
+	return nil, fmt.Errorf("no active key with id or name %q", idOrName)
+}
+
+// save atomically writes keys to the keys file with owner-only permissions.
+func (s *Store) save(keys []Key) error {
+	data, err := json.MarshalIndent(keysFile{Keys: keys}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keys: %w", err)
+	}
+	return fsutil.WriteFileAtomic(s.path, data)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+// WithKey returns a copy of ctx carrying the authenticated key.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the authenticated key attached to ctx, if any.
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(*Key)
+	return key, ok
+}
@@ -3,42 +3,674 @@ package config
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/models"
+	"copilot-api-proxy/pkg/premium"
+	"copilot-api-proxy/pkg/ratelimit"
 )
 
+// Account is a named GitHub account whose token is exchanged for Copilot
+// tokens. Host is the GitHub instance it belongs to; empty means github.com.
+type Account struct {
+	Name        string
+	GitHubToken string
+	Host        string
+}
+
 // Config holds all configuration for the application.
 type Config struct {
-	Port        string
-	GitHubToken string
+	Port     string
+	Accounts []Account
+	LogLevel slog.Level
+
+	// ConfigPath is the configuration file that was read, if any.
+	ConfigPath string
+
+	// AuthDisabled serves requests without an API key. By default every
+	// request needs one, so the proxy is closed until a key is issued.
+	AuthDisabled bool
+
+	// AccountStrategy selects how requests are spread over the accounts
+	// and AccountCooldown how long a rejected account is left out.
+	AccountStrategy string
+	AccountCooldown time.Duration
+
+	// ClientLimits apply to each inbound client (API key, or remote address
+	// when authentication is disabled); GlobalLimits apply to all traffic.
+	ClientLimits ratelimit.Limits
+	GlobalLimits ratelimit.Limits
+
+	// ModelsCacheTTL is how long the Copilot model list is cached.
+	ModelsCacheTTL time.Duration
+
+	// ModelValidation selects how chat requests are checked against the
+	// capabilities of their model.
+	ModelValidation models.ValidationMode
+
+	// ModelAliases maps model names clients send to Copilot models, and
+	// ModelPresets defines virtual models.
+	ModelAliases map[string]string
+	ModelPresets map[string]models.Preset
+
+	// TracingExporter selects where spans are sent: "none", "otlp",
+	// "stdout" or "file". TracingEndpoint is the base URL of the OTLP/HTTP
+	// collector; TracingTracesEndpoint, when set, is the full traces URL
+	// and is used as given instead. TracingFile is the file the file
+	// exporter appends to.
+	TracingExporter       string
+	TracingEndpoint       string
+	TracingTracesEndpoint string
+	TracingFile           string
+	TracingServiceName    string
+	TracingHeaders        map[string]string
+
+	// RecordingMode is "off", "record" or "replay". Recording writes the
+	// upstream traffic to JSONL files in RecordingPath, rotating at
+	// RecordingMaxFileMB and keeping RecordingMaxFiles old files; replay
+	// answers upstream requests from the recordings at RecordingPath, a
+	// file or directory, with their recorded delays if ReplayTiming is set.
+	RecordingMode      string
+	RecordingPath      string
+	RecordingMaxFileMB int
+	RecordingMaxFiles  int
+	ReplayTiming       bool
+
+	// GitHubURL and GitHubAPIURL are the GitHub instance of accounts that
+	// do not name their own, and CopilotAPIURL replaces the Copilot API
+	// endpoint advertised by the token exchange, for example to point the
+	// proxy at a mock upstream.
+	GitHubURL     string
+	GitHubAPIURL  string
+	CopilotAPIURL string
+
+	// UpstreamTimeouts bounds the phases of upstream requests, with
+	// per-model overrides.
+	UpstreamTimeouts copilot.TimeoutPolicy
+
+	// Initiator decides the X-Initiator header of chat requests, and
+	// Premium the budget user-initiated requests are counted against.
+	Initiator copilot.InitiatorPolicy
+	Premium   premium.Policy
+
+	// QuotaPollInterval is how often the Copilot quotas of each account are
+	// fetched from GitHub. Zero disables polling.
+	QuotaPollInterval time.Duration
+}
+
+// Tracing exporters.
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+)
+
+// Recording modes.
+const (
+	RecordingOff    = "off"
+	RecordingRecord = "record"
+	RecordingReplay = "replay"
+)
+
+// Overrides holds settings given on the command line, which take precedence
+// over everything else. Empty fields are ignored.
+type Overrides struct {
+	ConfigPath string
+	Port       string
+	LogLevel   string
+	NoAuth     bool
+}
+
+// defaults returns the configuration used when nothing else is set.
+func defaults() *Config {
+	return &Config{
+		Port:            "9871",
+		LogLevel:        slog.LevelInfo,
+		AccountStrategy: string(copilot.StrategyRoundRobin),
+		AccountCooldown: 5 * time.Minute,
+		ModelsCacheTTL:  models.DefaultCacheTTL,
+		ModelValidation: models.ValidationReject,
+		ModelAliases:    make(map[string]string),
+		ModelPresets:    make(map[string]models.Preset),
+
+		TracingExporter:    TracingNone,
+		TracingEndpoint:    "http://localhost:4318",
+		TracingServiceName: "copilot-api-proxy",
+		TracingHeaders:     make(map[string]string),
+
+		RecordingMode:      RecordingOff,
+		RecordingMaxFileMB: 50,
+		RecordingMaxFiles:  10,
+
+		UpstreamTimeouts: copilot.TimeoutPolicy{
+			Default: copilot.DefaultTimeouts,
+			Models:  make(map[string]copilot.Timeouts),
+		},
+
+		Initiator: copilot.InitiatorPolicy{
+			Mode:      copilot.DefaultInitiatorPolicy.Mode,
+			AgentWhen: slices.Clone(copilot.DefaultInitiatorPolicy.AgentWhen),
+			Clients:   make(map[string]string),
+		},
+		Premium: premium.Policy{
+			WarnAt:      0.8,
+			BlockAt:     1,
+			Multipliers: maps.Clone(premium.DefaultMultipliers),
+		},
+		QuotaPollInterval: 5 * time.Minute,
+	}
+}
+
+// Load builds the configuration from, in increasing precedence, the
+// defaults, the configuration file, environment variables and overrides,
+// validates the result and collects the GitHub accounts.
+func Load(overrides Overrides) (*Config, error) {
+	cfg, err := LoadSettings(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := loadAccounts()
+	if err != nil {
+		return nil, err
+	}
+	// Replay needs no GitHub account: nothing reaches Copilot.
+	if len(accounts) == 0 && cfg.RecordingMode != RecordingReplay {
+		return nil, errors.New("GITHUB_TOKEN environment variable not set and no GitHub token found; run the auth command first")
+	}
+	cfg.Accounts = accounts
+	return cfg, nil
+}
+
+// LoadSettings is Load without collecting the GitHub accounts, for
+// commands that add one.
+func LoadSettings(overrides Overrides) (*Config, error) {
+	cfg := defaults()
+
+	path, required := overrides.ConfigPath, true
+	if path == "" {
+		path = os.Getenv("COPILOT_PROXY_CONFIG")
+	}
+	if path == "" {
+		var err error
+		if path, err = GetConfigPath(); err != nil {
+			return nil, fmt.Errorf("failed to get config path: %w", err)
+		}
+		required = false
+	}
+	if err := applyFile(cfg, path, required); err != nil {
+		return nil, err
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if overrides.Port != "" {
+		cfg.Port = overrides.Port
+	}
+	if overrides.NoAuth {
+		cfg.AuthDisabled = true
+	}
+	if overrides.LogLevel != "" {
+		level, err := parseLevel(overrides.LogLevel)
+		if err != nil {
+			return nil, fmt.Errorf("--log-level: %w", err)
+		}
+		cfg.LogLevel = level
+	}
+
+	if cfg.RecordingPath == "" {
+		dir, err := GetDataDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get data directory: %w", err)
+		}
+		cfg.RecordingPath = filepath.Join(dir, "recordings")
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv merges the environment variables into cfg.
+func applyEnv(cfg *Config) error {
+	if port := os.Getenv("PORT"); port != "" {
+		cfg.Port = port
+	}
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		parsed, err := parseLevel(level)
+		if err != nil {
+			return fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+		cfg.LogLevel = parsed
+	}
+	if value := os.Getenv("AUTH_DISABLED"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("AUTH_DISABLED must be true or false, got %q", value)
+		}
+		cfg.AuthDisabled = disabled
+	}
+	if strategy := os.Getenv("ACCOUNT_STRATEGY"); strategy != "" {
+		cfg.AccountStrategy = strategy
+	}
+	if value := os.Getenv("ACCOUNT_COOLDOWN"); value != "" {
+		cooldown, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("ACCOUNT_COOLDOWN must be a duration, got %q", value)
+		}
+		cfg.AccountCooldown = cooldown
+	}
+	if value := os.Getenv("MODELS_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("MODELS_CACHE_TTL must be a duration, got %q", value)
+		}
+		cfg.ModelsCacheTTL = ttl
+	}
+	if value := os.Getenv("MODEL_VALIDATION"); value != "" {
+		mode, err := models.ParseValidationMode(value)
+		if err != nil {
+			return fmt.Errorf("MODEL_VALIDATION: %w", err)
+		}
+		cfg.ModelValidation = mode
+	}
+	if value := os.Getenv("MODEL_ALIASES"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			name, model, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				return fmt.Errorf("MODEL_ALIASES entries must look like name=model, got %q", pair)
+			}
+			cfg.ModelAliases[strings.TrimSpace(name)] = strings.TrimSpace(model)
+		}
+	}
+	if value := os.Getenv("OTEL_TRACES_EXPORTER"); value != "" {
+		cfg.TracingExporter = value
+	}
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); value != "" {
+		cfg.TracingEndpoint = value
+	}
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); value != "" {
+		cfg.TracingTracesEndpoint = value
+	}
+	if value := os.Getenv("OTEL_SERVICE_NAME"); value != "" {
+		cfg.TracingServiceName = value
+	}
+	if value := os.Getenv("TRACING_FILE"); value != "" {
+		cfg.TracingFile = value
+	}
+	if value := os.Getenv("GITHUB_URL"); value != "" {
+		cfg.GitHubURL = value
+	}
+	if value := os.Getenv("GITHUB_API_URL"); value != "" {
+		cfg.GitHubAPIURL = value
+	}
+	if value := os.Getenv("COPILOT_API_URL"); value != "" {
+		cfg.CopilotAPIURL = value
+	}
+	for _, timeout := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"UPSTREAM_CONNECT_TIMEOUT", &cfg.UpstreamTimeouts.Default.Connect},
+		{"UPSTREAM_HEADER_TIMEOUT", &cfg.UpstreamTimeouts.Default.Header},
+		{"UPSTREAM_IDLE_TIMEOUT", &cfg.UpstreamTimeouts.Default.Idle},
+		{"UPSTREAM_TOTAL_TIMEOUT", &cfg.UpstreamTimeouts.Default.Total},
+	} {
+		if value := os.Getenv(timeout.env); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration, got %q", timeout.env, value)
+			}
+			*timeout.value = d
+		}
+	}
+	if value := os.Getenv("INITIATOR_MODE"); value != "" {
+		cfg.Initiator.Mode = value
+	}
+	if value := os.Getenv("PREMIUM_MONTHLY_BUDGET"); value != "" {
+		budget, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("PREMIUM_MONTHLY_BUDGET must be a number, got %q", value)
+		}
+		cfg.Premium.MonthlyBudget = budget
+	}
+	if value := os.Getenv("QUOTA_POLL_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("QUOTA_POLL_INTERVAL must be a duration, got %q", value)
+		}
+		cfg.QuotaPollInterval = interval
+	}
+	if value := os.Getenv("RECORDING_MODE"); value != "" {
+		cfg.RecordingMode = value
+	}
+	if value := os.Getenv("RECORDING_PATH"); value != "" {
+		cfg.RecordingPath = value
+	}
+	if err := applyLimitsEnv(&cfg.ClientLimits, "RATE_LIMIT"); err != nil {
+		return err
+	}
+	return applyLimitsEnv(&cfg.GlobalLimits, "GLOBAL_RATE_LIMIT")
 }
 
-// Load populates the Config struct from environment variables.
-func Load() (*Config, error) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9871" // Default port
+// validate checks the merged configuration and reports every problem at once.
+func (c *Config) validate() error {
+	var errs []error
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %q", c.Port))
 	}
+	if _, err := copilot.ParseStrategy(c.AccountStrategy); err != nil {
+		errs = append(errs, fmt.Errorf("accounts.strategy: %w", err))
+	}
+	if c.AccountCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("accounts.cooldown must be positive, got %s", c.AccountCooldown))
+	}
+	errs = append(errs, validateLimits("limits.client", c.ClientLimits)...)
+	errs = append(errs, validateLimits("limits.global", c.GlobalLimits)...)
+	errs = append(errs, c.validateModels()...)
+	errs = append(errs, c.validateTracing()...)
+	errs = append(errs, c.validateRecording()...)
+	errs = append(errs, c.validateUpstream()...)
+	errs = append(errs, validateTimeouts("timeouts", c.UpstreamTimeouts.Default)...)
+	for _, model := range sortedKeys(c.UpstreamTimeouts.Models) {
+		errs = append(errs, validateTimeouts(fmt.Sprintf("timeouts.models.%q", model), c.UpstreamTimeouts.Models[model])...)
+	}
+	errs = append(errs, c.validateInitiator()...)
+	errs = append(errs, c.validatePremium()...)
+	if c.QuotaPollInterval < 0 {
+		errs = append(errs, fmt.Errorf("quota.poll_interval must not be negative, got %s", c.QuotaPollInterval))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+func validateLimits(section string, limits ratelimit.Limits) []error {
+	var errs []error
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"requests_per_minute", limits.RequestsPerMinute},
+		{"requests_per_day", limits.RequestsPerDay},
+		{"concurrent_streams", limits.ConcurrentStreams},
+	} {
+		if field.value < 0 {
+			errs = append(errs, fmt.Errorf("%s.%s must not be negative, got %d", section, field.name, field.value))
+		}
+	}
+	return errs
+}
 
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		// If env var is not set, try to read from file
+func (c *Config) validateModels() []error {
+	var errs []error
+	if c.ModelsCacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("models.cache_ttl must be positive, got %s", c.ModelsCacheTTL))
+	}
+	for _, name := range sortedKeys(c.ModelAliases) {
+		if name == "" || c.ModelAliases[name] == "" {
+			errs = append(errs, fmt.Errorf("models.aliases: %q = %q must name both a model and its target", name, c.ModelAliases[name]))
+		}
+	}
+	for _, name := range sortedKeys(c.ModelPresets) {
+		preset := c.ModelPresets[name]
+		section := "models.presets." + name
+		if preset.Model == "" {
+			errs = append(errs, fmt.Errorf("%s.model is required", section))
+		}
+		if _, ok := c.ModelAliases[name]; ok {
+			errs = append(errs, fmt.Errorf("%s: name is also defined as an alias", section))
+		}
+		if t := preset.Temperature; t != nil && !(*t >= 0 && *t <= 2) {
+			errs = append(errs, fmt.Errorf("%s.temperature must be between 0 and 2, got %v", section, *t))
+		}
+		if preset.MaxTokens != nil && *preset.MaxTokens <= 0 {
+			errs = append(errs, fmt.Errorf("%s.max_tokens must be positive, got %d", section, *preset.MaxTokens))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validateTracing() []error {
+	var errs []error
+	switch c.TracingExporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.TracingEndpoint == "" && c.TracingTracesEndpoint == "" {
+			errs = append(errs, errors.New("tracing.endpoint is required by the otlp exporter"))
+		}
+	case TracingFile:
+		if c.TracingFile == "" {
+			errs = append(errs, errors.New("tracing.file is required by the file exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be none, otlp, stdout or file, got %q", c.TracingExporter))
+	}
+	if c.TracingServiceName == "" {
+		errs = append(errs, errors.New("tracing.service_name must not be empty"))
+	}
+	return errs
+}
+
+func (c *Config) validateRecording() []error {
+	var errs []error
+	switch c.RecordingMode {
+	case RecordingOff, RecordingRecord, RecordingReplay:
+	default:
+		errs = append(errs, fmt.Errorf("recording.mode must be off, record or replay, got %q", c.RecordingMode))
+	}
+	if c.RecordingMaxFileMB <= 0 {
+		errs = append(errs, fmt.Errorf("recording.max_file_mb must be positive, got %d", c.RecordingMaxFileMB))
+	}
+	if c.RecordingMaxFiles < 0 {
+		errs = append(errs, fmt.Errorf("recording.max_files must not be negative, got %d", c.RecordingMaxFiles))
+	}
+	return errs
+}
+
+func (c *Config) validateUpstream() []error {
+	var errs []error
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"github_url", c.GitHubURL},
+		{"github_api_url", c.GitHubAPIURL},
+		{"copilot_api_url", c.CopilotAPIURL},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if u, err := url.Parse(field.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("upstream.%s must be an absolute http(s) URL, got %q", field.name, field.value))
+		}
+	}
+	if c.GitHubAPIURL != "" && c.GitHubURL == "" {
+		errs = append(errs, errors.New("upstream.github_api_url requires upstream.github_url"))
+	}
+	return errs
+}
+
+func validateTimeouts(section string, timeouts copilot.Timeouts) []error {
+	var errs []error
+	for _, field := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"connect", timeouts.Connect},
+		{"header", timeouts.Header},
+		{"idle", timeouts.Idle},
+		{"total", timeouts.Total},
+	} {
+		if field.value < 0 {
+			errs = append(errs, fmt.Errorf("%s.%s must not be negative, got %s", section, field.name, field.value))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validateInitiator() []error {
+	var errs []error
+	switch c.Initiator.Mode {
+	case copilot.InitiatorAuto, copilot.InitiatorOff, copilot.InitiatorUser, copilot.InitiatorAgent:
+	default:
+		errs = append(errs, fmt.Errorf("initiator.mode must be auto, off, user or agent, got %q", c.Initiator.Mode))
+	}
+	for _, condition := range c.Initiator.AgentWhen {
+		if condition != copilot.AgentOnToolResults && condition != copilot.AgentOnFollowUp {
+			errs = append(errs, fmt.Errorf("initiator.agent_when: unknown condition %q (want %s or %s)",
+				condition, copilot.AgentOnToolResults, copilot.AgentOnFollowUp))
+		}
+	}
+	for _, client := range sortedKeys(c.Initiator.Clients) {
+		if initiator := c.Initiator.Clients[client]; initiator != copilot.InitiatorUser && initiator != copilot.InitiatorAgent {
+			errs = append(errs, fmt.Errorf("initiator.clients.%s must be user or agent, got %q", client, initiator))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validatePremium() []error {
+	var errs []error
+	if c.Premium.MonthlyBudget < 0 {
+		errs = append(errs, fmt.Errorf("premium.monthly_budget must not be negative, got %v", c.Premium.MonthlyBudget))
+	}
+	if c.Premium.WarnAt < 0 {
+		errs = append(errs, fmt.Errorf("premium.warn_at must not be negative, got %v", c.Premium.WarnAt))
+	}
+	if c.Premium.BlockAt < 0 {
+		errs = append(errs, fmt.Errorf("premium.block_at must not be negative, got %v", c.Premium.BlockAt))
+	}
+	for _, model := range sortedKeys(c.Premium.Multipliers) {
+		if multiplier := c.Premium.Multipliers[model]; multiplier < 0 {
+			errs = append(errs, fmt.Errorf("premium.multipliers.%q must not be negative, got %v", model, multiplier))
+		}
+	}
+	return errs
+}
+
+// GitHubHost returns the GitHub instance of account. Accounts without a
+// host of their own use the upstream settings, if set, and github.com
+// otherwise.
+func (c *Config) GitHubHost(account Account) (copilot.GitHubHost, error) {
+	if account.Host != "" || c.GitHubURL == "" {
+		return copilot.ParseGitHubHost(account.Host)
+	}
+	host := copilot.GitHubHost{WebURL: strings.TrimRight(c.GitHubURL, "/"), APIURL: strings.TrimRight(c.GitHubAPIURL, "/")}
+	if host.APIURL == "" {
+		host.APIURL = host.WebURL
+	}
+	return host, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadAccounts collects the GitHub accounts to use. GITHUB_TOKEN, or the
+// original github_token file, provides the "default" account; every
+// accounts/<name>/github_token file adds a named one.
+func loadAccounts() ([]Account, error) {
+	var accounts []Account
+
+	if token := strings.TrimSpace(os.Getenv("GITHUB_TOKEN")); token != "" {
+		accounts = append(accounts, Account{
+			Name:        DefaultAccount,
+			GitHubToken: token,
+			Host:        strings.TrimSpace(os.Getenv("GITHUB_HOST")),
+		})
+	} else {
 		tokenPath, err := GetGitHubTokenPath()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get token path: %w", err)
 		}
-		tokenBytes, err := os.ReadFile(tokenPath)
+		if tokenBytes, err := os.ReadFile(tokenPath); err == nil {
+			if token := strings.TrimSpace(string(tokenBytes)); token != "" {
+				accounts = append(accounts, Account{
+					Name:        DefaultAccount,
+					GitHubToken: token,
+					Host:        readHost(filepath.Join(filepath.Dir(tokenPath), "github_host")),
+				})
+			}
+		}
+	}
+
+	accountsDir, err := GetAccountsDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts directory: %w", err)
+	}
+	entries, err := os.ReadDir(accountsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read accounts directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || ValidateAccountName(entry.Name()) != nil || entry.Name() == DefaultAccount {
+			continue
+		}
+		tokenBytes, err := os.ReadFile(filepath.Join(accountsDir, entry.Name(), "github_token"))
 		if err != nil {
-			return nil, errors.New("GITHUB_TOKEN environment variable not set and failed to read token from file")
+			continue
+		}
+		if token := strings.TrimSpace(string(tokenBytes)); token != "" {
+			accounts = append(accounts, Account{
+				Name:        entry.Name(),
+				GitHubToken: token,
+				Host:        readHost(filepath.Join(accountsDir, entry.Name(), "github_host")),
+			})
 		}
-		token = string(tokenBytes)
 	}
+	return accounts, nil
+}
 
-	if token == "" {
-		return nil, errors.New("GITHUB_TOKEN is empty")
+// applyLimitsEnv reads <prefix>_RPM, <prefix>_RPD and <prefix>_CONCURRENT
+// into limits, leaving unset variables alone.
+func applyLimitsEnv(limits *ratelimit.Limits, prefix string) error {
+	for suffix, target := range map[string]*int{
+		"_RPM":        &limits.RequestsPerMinute,
+		"_RPD":        &limits.RequestsPerDay,
+		"_CONCURRENT": &limits.ConcurrentStreams,
+	} {
+		name := prefix + suffix
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer, got %q", name, value)
+		}
+		*target = n
 	}
+	return nil
+}
 
-	return &Config{
-		Port:        port,
-		GitHubToken: token,
-	}, nil
+// readHost returns the GitHub host recorded at path, or "" for github.com.
+func readHost(path string) string {
+	hostBytes, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(hostBytes))
 }
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+
+	"copilot-api-proxy/pkg/copilot"
+)
+
+func TestGitHubHost(t *testing.T) {
+	upstream := &Config{GitHubURL: "http://localhost:9872/", GitHubAPIURL: "http://localhost:9873"}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		account Account
+		want    copilot.GitHubHost
+	}{
+		{"github.com by default", &Config{}, Account{}, copilot.DefaultGitHubHost},
+		{"account host", &Config{}, Account{Host: "ghes.example.com"},
+			copilot.GitHubHost{WebURL: "https://ghes.example.com", APIURL: "https://ghes.example.com/api/v3"}},
+		{"upstream default", upstream, Account{},
+			copilot.GitHubHost{WebURL: "http://localhost:9872", APIURL: "http://localhost:9873"}},
+		{"upstream API URL defaults to the web URL", &Config{GitHubURL: "http://localhost:9872"}, Account{},
+			copilot.GitHubHost{WebURL: "http://localhost:9872", APIURL: "http://localhost:9872"}},
+		{"account host beats the upstream default", upstream, Account{Host: "ghes.example.com"},
+			copilot.GitHubHost{WebURL: "https://ghes.example.com", APIURL: "https://ghes.example.com/api/v3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.GitHubHost(tt.account)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GitHubHost = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracingEndpointsFromEnv(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("COPILOT_PROXY_CONFIG", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector:4318/custom/traces")
+
+	cfg, err := LoadSettings(Overrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TracingEndpoint != "http://collector:4318" {
+		t.Errorf("TracingEndpoint = %q, want the base endpoint", cfg.TracingEndpoint)
+	}
+	if cfg.TracingTracesEndpoint != "http://collector:4318/custom/traces" {
+		t.Errorf("TracingTracesEndpoint = %q, want the traces endpoint as given", cfg.TracingTracesEndpoint)
+	}
+}
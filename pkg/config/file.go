@@ -0,0 +1,321 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/models"
+)
+
+// fileConfig is the schema of the TOML configuration file. Pointer fields
+// distinguish "not set" from zero so the file only overrides what it names.
+type fileConfig struct {
+	Port    *int        `toml:"port"`
+	Logging fileLogging `toml:"logging"`
+	Auth    struct {
+		Disabled *bool `toml:"disabled"`
+	} `toml:"auth"`
+	Accounts fileAccounts `toml:"accounts"`
+	Limits   struct {
+		Client fileLimits `toml:"client"`
+		Global fileLimits `toml:"global"`
+	} `toml:"limits"`
+	Models struct {
+		CacheTTL   *string               `toml:"cache_ttl"`
+		Validation *string               `toml:"validation"`
+		Aliases    map[string]string     `toml:"aliases"`
+		Presets    map[string]filePreset `toml:"presets"`
+	} `toml:"models"`
+	Tracing   fileTracing   `toml:"tracing"`
+	Recording fileRecording `toml:"recording"`
+	Upstream  struct {
+		GitHubURL     *string `toml:"github_url"`
+		GitHubAPIURL  *string `toml:"github_api_url"`
+		CopilotAPIURL *string `toml:"copilot_api_url"`
+	} `toml:"upstream"`
+	Timeouts struct {
+		fileTimeouts
+		Models map[string]fileTimeouts `toml:"models"`
+	} `toml:"timeouts"`
+	Initiator struct {
+		Mode      *string           `toml:"mode"`
+		AgentWhen []string          `toml:"agent_when"`
+		Clients   map[string]string `toml:"clients"`
+	} `toml:"initiator"`
+	Premium struct {
+		MonthlyBudget *float64           `toml:"monthly_budget"`
+		WarnAt        *float64           `toml:"warn_at"`
+		BlockAt       *float64           `toml:"block_at"`
+		Multipliers   map[string]float64 `toml:"multipliers"`
+	} `toml:"premium"`
+	Quota struct {
+		PollInterval *string `toml:"poll_interval"`
+	} `toml:"quota"`
+}
+
+type fileLogging struct {
+	Level *string `toml:"level"`
+}
+
+type fileAccounts struct {
+	Strategy *string `toml:"strategy"`
+	Cooldown *string `toml:"cooldown"`
+}
+
+type fileLimits struct {
+	RequestsPerMinute *int `toml:"requests_per_minute"`
+	RequestsPerDay    *int `toml:"requests_per_day"`
+	ConcurrentStreams *int `toml:"concurrent_streams"`
+}
+
+type fileTracing struct {
+	Exporter    *string           `toml:"exporter"`
+	Endpoint    *string           `toml:"endpoint"`
+	File        *string           `toml:"file"`
+	ServiceName *string           `toml:"service_name"`
+	Headers     map[string]string `toml:"headers"`
+}
+
+type fileRecording struct {
+	Mode         *string `toml:"mode"`
+	Path         *string `toml:"path"`
+	MaxFileMB    *int    `toml:"max_file_mb"`
+	MaxFiles     *int    `toml:"max_files"`
+	ReplayTiming *bool   `toml:"replay_timing"`
+}
+
+type fileTimeouts struct {
+	Connect *string `toml:"connect"`
+	Header  *string `toml:"header"`
+	Idle    *string `toml:"idle"`
+	Total   *string `toml:"total"`
+}
+
+type filePreset struct {
+	Model        string   `toml:"model"`
+	Description  string   `toml:"description"`
+	Temperature  *float64 `toml:"temperature"`
+	MaxTokens    *int     `toml:"max_tokens"`
+	SystemPrompt string   `toml:"system_prompt"`
+}
+
+// applyFile merges the configuration file at path into cfg. A missing file
+// is not an error unless required is set. Unknown keys are rejected so that
+// typos do not go unnoticed.
+func applyFile(cfg *Config, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file fileConfig
+	meta, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return fmt.Errorf("%s: unknown keys: %s", path, strings.Join(keys, ", "))
+	}
+	cfg.ConfigPath = path
+
+	var errs []error
+	if file.Port != nil {
+		cfg.Port = strconv.Itoa(*file.Port)
+	}
+	if file.Logging.Level != nil {
+		level, err := parseLevel(*file.Logging.Level)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("logging.level: %w", err))
+		}
+		cfg.LogLevel = level
+	}
+	if file.Auth.Disabled != nil {
+		cfg.AuthDisabled = *file.Auth.Disabled
+	}
+	if file.Accounts.Strategy != nil {
+		cfg.AccountStrategy = *file.Accounts.Strategy
+	}
+	if file.Accounts.Cooldown != nil {
+		cooldown, err := time.ParseDuration(*file.Accounts.Cooldown)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("accounts.cooldown: %w", err))
+		}
+		cfg.AccountCooldown = cooldown
+	}
+	file.Limits.Client.apply(&cfg.ClientLimits.RequestsPerMinute, &cfg.ClientLimits.RequestsPerDay, &cfg.ClientLimits.ConcurrentStreams)
+	file.Limits.Global.apply(&cfg.GlobalLimits.RequestsPerMinute, &cfg.GlobalLimits.RequestsPerDay, &cfg.GlobalLimits.ConcurrentStreams)
+	if file.Models.CacheTTL != nil {
+		ttl, err := time.ParseDuration(*file.Models.CacheTTL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("models.cache_ttl: %w", err))
+		}
+		cfg.ModelsCacheTTL = ttl
+	}
+	if file.Models.Validation != nil {
+		mode, err := models.ParseValidationMode(*file.Models.Validation)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("models.validation: %w", err))
+		} else {
+			cfg.ModelValidation = mode
+		}
+	}
+	for name, model := range file.Models.Aliases {
+		cfg.ModelAliases[name] = model
+	}
+	for name, preset := range file.Models.Presets {
+		cfg.ModelPresets[name] = models.Preset{
+			Model:        preset.Model,
+			Description:  preset.Description,
+			Temperature:  preset.Temperature,
+			MaxTokens:    preset.MaxTokens,
+			SystemPrompt: preset.SystemPrompt,
+		}
+	}
+	file.Tracing.apply(cfg)
+	file.Recording.apply(cfg)
+	if file.Upstream.GitHubURL != nil {
+		cfg.GitHubURL = *file.Upstream.GitHubURL
+	}
+	if file.Upstream.GitHubAPIURL != nil {
+		cfg.GitHubAPIURL = *file.Upstream.GitHubAPIURL
+	}
+	if file.Upstream.CopilotAPIURL != nil {
+		cfg.CopilotAPIURL = *file.Upstream.CopilotAPIURL
+	}
+	errs = append(errs, file.Timeouts.apply("timeouts", &cfg.UpstreamTimeouts.Default)...)
+	for model, timeouts := range file.Timeouts.Models {
+		override := copilot.Timeouts{}
+		errs = append(errs, timeouts.apply(fmt.Sprintf("timeouts.models.%q", model), &override)...)
+		cfg.UpstreamTimeouts.Models[model] = override
+	}
+	if file.Initiator.Mode != nil {
+		cfg.Initiator.Mode = *file.Initiator.Mode
+	}
+	if file.Initiator.AgentWhen != nil {
+		cfg.Initiator.AgentWhen = file.Initiator.AgentWhen
+	}
+	for client, initiator := range file.Initiator.Clients {
+		cfg.Initiator.Clients[client] = initiator
+	}
+	if file.Premium.MonthlyBudget != nil {
+		cfg.Premium.MonthlyBudget = *file.Premium.MonthlyBudget
+	}
+	if file.Premium.WarnAt != nil {
+		cfg.Premium.WarnAt = *file.Premium.WarnAt
+	}
+	if file.Premium.BlockAt != nil {
+		cfg.Premium.BlockAt = *file.Premium.BlockAt
+	}
+	for model, multiplier := range file.Premium.Multipliers {
+		cfg.Premium.Multipliers[model] = multiplier
+	}
+	if file.Quota.PollInterval != nil {
+		interval, err := time.ParseDuration(*file.Quota.PollInterval)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("quota.poll_interval: %w", err))
+		} else {
+			cfg.QuotaPollInterval = interval
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (l fileLimits) apply(perMinute, perDay, concurrent *int) {
+	if l.RequestsPerMinute != nil {
+		*perMinute = *l.RequestsPerMinute
+	}
+	if l.RequestsPerDay != nil {
+		*perDay = *l.RequestsPerDay
+	}
+	if l.ConcurrentStreams != nil {
+		*concurrent = *l.ConcurrentStreams
+	}
+}
+
+func (t fileTracing) apply(cfg *Config) {
+	if t.Exporter != nil {
+		cfg.TracingExporter = *t.Exporter
+	}
+	if t.Endpoint != nil {
+		cfg.TracingEndpoint = *t.Endpoint
+	}
+	if t.File != nil {
+		cfg.TracingFile = *t.File
+	}
+	if t.ServiceName != nil {
+		cfg.TracingServiceName = *t.ServiceName
+	}
+	for key, value := range t.Headers {
+		cfg.TracingHeaders[key] = value
+	}
+}
+
+func (t fileTimeouts) apply(section string, timeouts *copilot.Timeouts) []error {
+	var errs []error
+	for _, field := range []struct {
+		name  string
+		raw   *string
+		value *time.Duration
+	}{
+		{"connect", t.Connect, &timeouts.Connect},
+		{"header", t.Header, &timeouts.Header},
+		{"idle", t.Idle, &timeouts.Idle},
+		{"total", t.Total, &timeouts.Total},
+	} {
+		if field.raw == nil {
+			continue
+		}
+		d, err := time.ParseDuration(*field.raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", section, field.name, err))
+		}
+		*field.value = d
+	}
+	return errs
+}
+
+func (r fileRecording) apply(cfg *Config) {
+	if r.Mode != nil {
+		cfg.RecordingMode = *r.Mode
+	}
+	if r.Path != nil {
+		cfg.RecordingPath = *r.Path
+	}
+	if r.MaxFileMB != nil {
+		cfg.RecordingMaxFileMB = *r.MaxFileMB
+	}
+	if r.MaxFiles != nil {
+		cfg.RecordingMaxFiles = *r.MaxFiles
+	}
+	if r.ReplayTiming != nil {
+		cfg.ReplayTiming = *r.ReplayTiming
+	}
+}
+
+// parseLevel parses a log level name such as "debug" or "warn".
+func parseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+	}
+	return level, nil
+}
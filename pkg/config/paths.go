@@ -1,16 +1,41 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 )
 
-func GetGitHubTokenPath() (string, error) {
+// DefaultAccount is the name of the account configured through GITHUB_TOKEN
+// or the original github_token file.
+const DefaultAccount = "default"
+
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateAccountName checks that name is usable as a directory name.
+func ValidateAccountName(name string) error {
+	if !accountNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid account name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// GetDataDir returns the directory holding the proxy's persistent state.
+func GetDataDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".local", "share", "copilot-api-proxy", "github_token"), nil
+	return filepath.Join(home, ".local", "share", "copilot-api-proxy"), nil
+}
+
+func GetGitHubTokenPath() (string, error) {
+	dir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "github_token"), nil
 }
 
 func EnsurePaths() error {
@@ -31,3 +56,102 @@ func EnsurePaths() error {
 	}
 	return file.Close()
 }
+
+// GetAccountsDir returns the directory holding one subdirectory per named
+// GitHub account.
+func GetAccountsDir() (string, error) {
+	dir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "accounts"), nil
+}
+
+// GetAccountTokenPath returns the GitHub token path for a named account.
+// The "default" account uses the original single-account token file.
+func GetAccountTokenPath(name string) (string, error) {
+	if name == DefaultAccount {
+		return GetGitHubTokenPath()
+	}
+	if err := ValidateAccountName(name); err != nil {
+		return "", err
+	}
+	dir, err := GetAccountsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name, "github_token"), nil
+}
+
+// GetAccountHostPath returns the path of the file recording which GitHub
+// instance a named account belongs to. The file is absent for github.com.
+func GetAccountHostPath(name string) (string, error) {
+	tokenPath, err := GetAccountTokenPath(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(tokenPath), "github_host"), nil
+}
+
+// GetAccountCopilotTokenPath returns the path where the exchanged Copilot
+// token of a named account is cached between restarts.
+func GetAccountCopilotTokenPath(name string) (string, error) {
+	tokenPath, err := GetAccountTokenPath(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(tokenPath), "copilot_token.json"), nil
+}
+
+// GetAPIKeysPath returns the path of the file holding proxy-issued API keys.
+func GetAPIKeysPath() (string, error) {
+	dir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "api_keys.json"), nil
+}
+
+// GetRateLimitStatePath returns the path of the file persisting rate limit
+// counters across restarts.
+func GetRateLimitStatePath() (string, error) {
+	dir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ratelimit_state.json"), nil
+}
+
+// GetPremiumStatePath returns the path of the file persisting the premium
+// requests used this month across restarts.
+func GetPremiumStatePath() (string, error) {
+	dir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "premium_state.json"), nil
+}
+
+// GetUsageLedgerPath returns the path of the file recording the token usage
+// of each request.
+func GetUsageLedgerPath() (string, error) {
+	dir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "usage.jsonl"), nil
+}
+
+// GetConfigPath returns the default configuration file path under the XDG
+// config directory.
+func GetConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "copilot-api-proxy", "config.toml"), nil
+}
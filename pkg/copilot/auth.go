@@ -12,26 +12,39 @@ type ExchangeTokenResponse struct {
 	Token     string `json:"token"`
 	ExpiresAt int64  `json:"expires_at"`
 	RefreshIn int64  `json:"refresh_in"`
+
+	// Endpoints lists the hosts serving this user's plan; Business and
+	// Enterprise seats are served from different hosts than individuals.
+	Endpoints Endpoints `json:"endpoints"`
+
+	// Plan metadata.
+	SKU                  string         `json:"sku"`
+	ChatEnabled          bool           `json:"chat_enabled"`
+	Individual           bool           `json:"individual"`
+	LimitedUserQuotas    map[string]int `json:"limited_user_quotas"`
+	LimitedUserResetDate *int64         `json:"limited_user_reset_date"`
+	TrackingID           string         `json:"tracking_id"`
+}
+
+// Endpoints holds the service URLs advertised by the token exchange.
+type Endpoints struct {
+	API           string `json:"api"`
+	Proxy         string `json:"proxy"`
+	Telemetry     string `json:"telemetry"`
+	OriginTracker string `json:"origin-tracker"`
 }
 
 // ExchangeGitHubToken takes a GitHub OAuth token and exchanges it for a short-lived Copilot token.
-func ExchangeGitHubToken(ctx context.Context, githubToken string) (*ExchangeTokenResponse, error) {
+func ExchangeGitHubToken(ctx context.Context, host GitHubHost, githubToken string) (*ExchangeTokenResponse, error) {
 	// 1. Create a new GET request to the exchange endpoint.
-	url := "https://api.github.com/copilot_internal/v2/token"
+	url := host.APIURL + "/copilot_internal/v2/token"
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token exchange request: %w", err)
 	}
 
 	// 2. Add the required headers.
-	req.Header.Set("Authorization", "token "+githubToken)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("editor-version", "vscode/1.98.1")
-	req.Header.Set("editor-plugin-version", "copilot-chat/0.26.7")
-	req.Header.Set("user-agent", "GitHubCopilotChat/0.26.7")
-	req.Header.Set("x-github-api-version", "2025-04-01")
-	req.Header.Set("x-vscode-user-agent-library-version", "electron-fetch")
+	setGitHubHeaders(req, githubToken)
 
 	// 3. Execute the request.
 	resp, err := http.DefaultClient.Do(req)
@@ -54,3 +67,16 @@ func ExchangeGitHubToken(ctx context.Context, githubToken string) (*ExchangeToke
 	// 6. Return the response.
 	return &tokenResponse, nil
 }
+
+// setGitHubHeaders adds the headers the copilot_internal endpoints expect
+// from the Copilot Chat extension.
+func setGitHubHeaders(req *http.Request, githubToken string) {
+	req.Header.Set("Authorization", "token "+githubToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("editor-version", "vscode/1.98.1")
+	req.Header.Set("editor-plugin-version", "copilot-chat/0.26.7")
+	req.Header.Set("user-agent", "GitHubCopilotChat/0.26.7")
+	req.Header.Set("x-github-api-version", "2025-04-01")
+	req.Header.Set("x-vscode-user-agent-library-version", "electron-fetch")
+}
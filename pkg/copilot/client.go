@@ -1,53 +1,301 @@
 package copilot
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
-)
 
-const (
-	copilotAPIHost = "api.individual.githubcopilot.com"
+	"copilot-api-proxy/pkg/metrics"
+	"copilot-api-proxy/pkg/premium"
+	"copilot-api-proxy/pkg/tracing"
 )
 
 // Client is an HTTP client for forwarding requests to the Copilot API.
 type Client struct {
-	httpClient   *http.Client
-	tokenManager *TokenManager
+	httpClient *http.Client
+	pool       *Pool
+	apiURL     string
+	timeouts   atomic.Pointer[TimeoutPolicy]
+	initiator  atomic.Pointer[InitiatorPolicy]
+	budget     *premium.Budget
+	quota      *QuotaMonitor
+	logger     *slog.Logger
+}
+
+// ClientOption configures optional client behaviour.
+type ClientOption func(*Client)
+
+// WithTransport sends upstream requests through rt instead of the default
+// transport, for example to record them or to replay recorded responses.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.httpClient.Transport = rt
+	}
+}
+
+// WithAPIURL sends requests to url instead of the Copilot API endpoint
+// advertised by each account's token exchange.
+func WithAPIURL(url string) ClientOption {
+	return func(c *Client) {
+		c.apiURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithPremiumBudget counts user-initiated chat requests against budget and
+// refuses them once it is exhausted.
+func WithPremiumBudget(budget *premium.Budget) ClientOption {
+	return func(c *Client) {
+		c.budget = budget
+	}
 }
 
-// NewClient creates a new Copilot client.
-func NewClient(tokenManager *TokenManager, timeout time.Duration) *Client {
-	return &Client{
-		httpClient:   &http.Client{Timeout: timeout},
-		tokenManager: tokenManager,
+// WithQuotaMonitor adds the serving account's remaining quotas from
+// monitor to every response as x-copilot-quota-* headers.
+func WithQuotaMonitor(monitor *QuotaMonitor) ClientOption {
+	return func(c *Client) {
+		c.quota = monitor
+	}
+}
+
+// NewClient creates a new Copilot client that spreads requests over the
+// accounts in pool and bounds each request by timeouts.
+func NewClient(pool *Pool, timeouts TimeoutPolicy, logger *slog.Logger, opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient: &http.Client{},
+		pool:       pool,
+		logger:     logger,
+	}
+	c.SetTimeouts(timeouts)
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// SetTimeouts replaces the timeouts applied to new requests.
+func (c *Client) SetTimeouts(timeouts TimeoutPolicy) {
+	c.timeouts.Store(&timeouts)
+}
+
+// SetInitiatorPolicy replaces the policy that sets the X-Initiator header
+// of chat requests. Without one, the header is left as the client sent it.
+func (c *Client) SetInitiatorPolicy(policy InitiatorPolicy) {
+	c.initiator.Store(&policy)
+}
+
+// PremiumBudget returns the premium request budget, or nil if none is
+// tracked.
+func (c *Client) PremiumBudget() *premium.Budget {
+	return c.budget
+}
+
+// QuotaMonitor returns the monitor of the accounts' Copilot quotas, or nil
+// if quotas are not monitored.
+func (c *Client) QuotaMonitor() *QuotaMonitor {
+	return c.quota
+}
+
+// Pool returns the account pool the client draws tokens from.
+func (c *Client) Pool() *Pool {
+	return c.pool
 }
 
 // ForwardRequest creates and sends a new request to the Copilot API based on
 // an incoming request, adding the necessary authentication.
+// If Copilot rejects the token with a 401, the token is refreshed and the
+// request replayed once. If Copilot still rejects the account, it is ejected
+// from the pool and the request is retried once on another account.
 // The caller is responsible for closing the response body.
 func (c *Client) ForwardRequest(ctx context.Context, incomingReq *http.Request) (*http.Response, error) {
-	// 1. Construct the target URL.
+	// 1. Pick an account; its token exchange tells us which host serves it.
+	_, acquireSpan := tracing.Start(ctx, "acquire token", tracing.KindInternal)
+	account, release, err := c.pool.Acquire(clientIDFrom(ctx))
+	acquireSpan.SetError(err)
+	if err == nil {
+		acquireSpan.SetAttributes(tracing.String("copilot.account", account.Name))
+	}
+	acquireSpan.End()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Buffer the body so the request can be replayed after a token refresh.
+	var body []byte
+	if incomingReq.Body != nil {
+		body, err = io.ReadAll(incomingReq.Body)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	// 3. Mark chat requests as user or agent initiated, and refuse billed
+	// ones the premium request budget cannot cover.
+	model := requestModel(body)
+	var reservation *premium.Reservation
+	if isChatCompletions(incomingReq.URL.Path) {
+		incomingReq = c.setInitiator(ctx, incomingReq, body)
+		if c.budget != nil && !strings.EqualFold(incomingReq.Header.Get("X-Initiator"), InitiatorAgent) {
+			reservation, err = c.budget.Check(model)
+			if err != nil {
+				release()
+				return nil, err
+			}
+		}
+	}
+
+	// 4. Bound the whole exchange, including the streamed body, by the
+	// total timeout of the requested model.
+	timeouts := c.timeouts.Load().For(model)
+	ctx, cancel := context.WithCancelCause(ctx)
+	var total *time.Timer
+	if timeouts.Total > 0 {
+		total = time.AfterFunc(timeouts.Total, func() { cancel(&TimeoutError{Phase: "total", Limit: timeouts.Total}) })
+	}
+
+	// 5. Send the request. If the account was ejected, fail over to the
+	// next healthy account, if there is one.
+	resp, ejected, err := c.attempt(ctx, cancel, timeouts, account, incomingReq, body)
+	if err == nil && ejected {
+		if next, nextRelease, err := c.pool.acquireHealthy(clientIDFrom(ctx)); err == nil {
+			c.logger.Warn("Retrying on another Copilot account", "from", account.Name, "to", next.Name, "status", resp.StatusCode)
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			release()
+			account, release = next, nextRelease
+			resp, _, err = c.attempt(ctx, cancel, timeouts, account, incomingReq, body)
+		}
+	}
+	if err != nil {
+		if total != nil {
+			total.Stop()
+		}
+		cancel(nil)
+		release()
+		if reservation != nil {
+			reservation.Refund()
+		}
+		return nil, fmt.Errorf("account %s: %w", account.Name, err)
+	}
+	// Failed requests are not billed by Copilot.
+	if reservation != nil && resp.StatusCode >= http.StatusBadRequest {
+		reservation.Refund()
+	}
+	if c.quota != nil {
+		c.quota.SetHeaders(resp.Header, account.Name)
+	}
+	// Do not close the response body here; the caller needs to stream it.
+	resp.Body = &releaseOnClose{ReadCloser: newTimeoutBody(ctx, resp.Body, cancel, timeouts.Idle, total), release: release}
+	return resp, nil
+}
+
+// attempt sends the request with account, refreshing the token and retrying
+// once on a 401, and reports the outcome to the pool. It also reports
+// whether the pool ejected the account.
+func (c *Client) attempt(ctx context.Context, cancel context.CancelCauseFunc, timeouts Timeouts, account *Account, incomingReq *http.Request, body []byte) (*http.Response, bool, error) {
+	start := time.Now()
+	resp, token, err := c.send(ctx, cancel, timeouts, account, incomingReq, body)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		resp, err = c.retryUnauthorized(ctx, cancel, timeouts, account, incomingReq, body, resp, token)
+	}
+	info := metrics.RequestInfoFrom(ctx)
+	metrics.UpstreamLatency.Observe(time.Since(start).Seconds(), info.Route, info.Model)
+	return resp, c.pool.Report(account, resp, err), err
+}
+
+// setInitiator returns req with the X-Initiator header chosen by the
+// initiator policy, copying req rather than changing the caller's headers.
+func (c *Client) setInitiator(ctx context.Context, req *http.Request, body []byte) *http.Request {
+	policy := c.initiator.Load()
+	if policy == nil {
+		return req
+	}
+	initiator := policy.Initiator(metrics.RequestInfoFrom(ctx).Client, body)
+	if initiator == "" {
+		return req
+	}
+	req = req.Clone(ctx)
+	req.Header.Set("X-Initiator", initiator)
+	return req
+}
+
+// isChatCompletions reports whether path is the chat completions endpoint.
+func isChatCompletions(path string) bool {
+	return path == "/chat/completions" || path == "/v1/chat/completions"
+}
+
+// retryUnauthorized handles a 401 by forcing a token refresh and replaying
+// the request. If the refresh fails, the original 401 is returned.
+func (c *Client) retryUnauthorized(ctx context.Context, cancel context.CancelCauseFunc, timeouts Timeouts, account *Account, incomingReq *http.Request, body []byte, resp *http.Response, staleToken string) (*http.Response, error) {
+	// Keep the original error body so it can still be returned if the
+	// refresh does not help.
+	errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(errBody))
+
+	c.logger.Warn("Copilot rejected token, refreshing and retrying", "account", account.Name)
+	if err := account.TokenManager.ForceRefresh(ctx, staleToken); err != nil {
+		c.logger.Error("Forced token refresh failed", "account", account.Name, "error", err)
+		return resp, nil
+	}
+
+	retried, _, err := c.send(ctx, cancel, timeouts, account, incomingReq, body)
+	if err != nil {
+		return nil, err
+	}
+	if retried.StatusCode == http.StatusUnauthorized {
+		c.logger.Error("Copilot rejected refreshed token", "account", account.Name)
+	}
+	return retried, nil
+}
+
+// send builds and executes one upstream request with the account's current
+// token, returning the token used. The connect and header timeouts cancel
+// ctx through cancel. Its span ends when the response headers arrive;
+// streaming the body is traced by the caller.
+func (c *Client) send(ctx context.Context, cancel context.CancelCauseFunc, timeouts Timeouts, account *Account, incomingReq *http.Request, body []byte) (*http.Response, string, error) {
 	path := incomingReq.URL.Path
 	if path == "/v1/chat/completions" {
 		path = "/chat/completions"
 	}
-	targetURL := "https://" + copilotAPIHost + path
+	base := c.apiURL
+	if base == "" {
+		base = account.TokenManager.APIEndpoint()
+	}
+	targetURL := base + path
+	c.logger.Debug("Selected Copilot account", "account", account.Name, "url", targetURL)
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	ctx, span := tracing.Start(ctx, incomingReq.Method+" "+path, tracing.KindClient,
+		tracing.String("http.request.method", incomingReq.Method),
+		tracing.String("url.full", targetURL),
+		tracing.String("copilot.account", account.Name))
+	defer span.End()
 
-	// 2. Create a new request to the upstream API.
-	// The body of the incoming request is passed directly.
-	upstreamReq, err := http.NewRequestWithContext(ctx, incomingReq.Method, targetURL, incomingReq.Body)
+	upstreamReq, err := http.NewRequestWithContext(ctx, incomingReq.Method, targetURL, bodyReader)
 	if err != nil {
-		return nil, err
+		span.SetError(err)
+		return nil, "", err
 	}
 
-	// 3. Copy headers from the original request.
+	// Copy headers from the original request, minus the caller's own
+	// credentials for the proxy, and set the required Copilot headers.
 	upstreamReq.Header = incomingReq.Header.Clone()
-
-	// 4. Set the required headers for the Copilot API.
-	upstreamReq.Host = copilotAPIHost
-	token := c.tokenManager.GetToken()
+	upstreamReq.Header.Del("x-api-key")
+	// Leave compression to the transport, which then decompresses the
+	// response itself. A caller's Accept-Encoding would hand us a body we
+	// cannot parse for usage or translate.
+	upstreamReq.Header.Del("Accept-Encoding")
+	token := account.TokenManager.GetToken()
 	upstreamReq.Header.Set("Authorization", "Bearer "+token)
 	upstreamReq.Header.Set("editor-version", "vscode/1.98.1")
 	upstreamReq.Header.Set("editor-plugin-version", "copilot-chat/0.26.7")
@@ -57,7 +305,34 @@ func (c *Client) ForwardRequest(ctx context.Context, incomingReq *http.Request)
 	upstreamReq.Header.Set("openai-intent", "conversation-panel")
 	upstreamReq.Header.Set("x-vscode-user-agent-library-version", "electron-fetch")
 
-	// 5. Execute the request and return the response.
-	// Do not close the response body here; the caller needs to stream it.
-	return c.httpClient.Do(upstreamReq)
+	tracing.Inject(ctx, upstreamReq.Header)
+
+	traceCtx, stopTimers := withPhaseTimeouts(ctx, timeouts, cancel)
+	resp, err := c.httpClient.Do(upstreamReq.WithContext(traceCtx))
+	stopTimers()
+	if err != nil {
+		if cause, ok := context.Cause(ctx).(*TimeoutError); ok {
+			err = cause
+		}
+		span.SetError(err)
+		return nil, token, err
+	}
+	span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(tracing.StatusError, resp.Status)
+	}
+	return resp, token, nil
+}
+
+// ChatCompletion sends a chat completions request built by the proxy itself,
+// such as one translated from another API format, to the Copilot API.
+// The caller is responsible for closing the response body.
+func (c *Client) ChatCompletion(ctx context.Context, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return c.ForwardRequest(ctx, req)
 }
@@ -0,0 +1,245 @@
+package copilot
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"copilot-api-proxy/pkg/premium"
+)
+
+// newTestClient builds a client whose accounts use static tokens named
+// after them, sending every request to upstream.
+func newTestClient(t *testing.T, upstream http.Handler, names ...string) *Client {
+	t.Helper()
+	return newTestClientWith(t, upstream, nil, names...)
+}
+
+func newTestClientWith(t *testing.T, upstream http.Handler, opts []ClientOption, names ...string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	accounts := make([]*Account, 0, len(names))
+	for _, name := range names {
+		accounts = append(accounts, &Account{Name: name, TokenManager: NewStaticTokenManager(name, "token-"+name, logger)})
+	}
+	pool, err := NewPool(accounts, StrategyRoundRobin, DefaultTimeouts.Total, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(pool, TimeoutPolicy{Default: DefaultTimeouts}, logger, append(opts, WithAPIURL(srv.URL))...)
+}
+
+// rateLimitAccount answers 429 to requests made with the token of account
+// and echoes the token otherwise.
+func rateLimitAccount(account string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "token-"+account {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, token)
+	}
+}
+
+func forward(t *testing.T, c *Client) (int, string) {
+	t.Helper()
+	return forwardTo(t, c, "/v1/embeddings")
+}
+
+func forwardTo(t *testing.T, c *Client, path string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"model":"m"}`))
+	resp, err := c.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestForwardRequestFailsOverToNextAccount(t *testing.T) {
+	c := newTestClient(t, rateLimitAccount("a"), "a", "b")
+
+	status, body := forward(t, c)
+	if status != http.StatusOK || body != "token-b" {
+		t.Fatalf("got %d %q, want 200 from account b", status, body)
+	}
+
+	for _, account := range c.Pool().Status() {
+		if account.Name == "a" && account.Healthy {
+			t.Error("account a should have been ejected")
+		}
+		if account.Name == "b" && (!account.Healthy || account.InFlight != 0) {
+			t.Errorf("account b: healthy=%v in_flight=%d, want healthy and idle", account.Healthy, account.InFlight)
+		}
+	}
+}
+
+func TestForwardRequestReturnsRejectionWithoutOtherAccount(t *testing.T) {
+	c := newTestClient(t, rateLimitAccount("a"), "a")
+
+	status, _ := forward(t, c)
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want the upstream 429", status)
+	}
+	if account := c.Pool().Status()[0]; account.InFlight != 0 {
+		t.Errorf("in_flight = %d after the request, want 0", account.InFlight)
+	}
+}
+
+func TestForwardRequestRefundsFailedPremiumRequests(t *testing.T) {
+	budget, err := premium.New(premium.Policy{MonthlyBudget: 1, BlockAt: 1, Multipliers: premium.DefaultMultipliers}, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := true
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if fail {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "{}")
+	})
+	c := newTestClientWith(t, upstream, []ClientOption{WithPremiumBudget(budget)}, "a")
+
+	if status, _ := forwardTo(t, c, "/v1/chat/completions"); status != http.StatusBadRequest {
+		t.Fatalf("got %d, want the upstream 400", status)
+	}
+	if used := budget.Status().Used; used != 0 {
+		t.Fatalf("used = %v after a failed request, want 0", used)
+	}
+
+	fail = false
+	if status, _ := forwardTo(t, c, "/v1/chat/completions"); status != http.StatusOK {
+		t.Fatalf("got %d, want 200", status)
+	}
+	if used := budget.Status().Used; used != 1 {
+		t.Fatalf("used = %v after a successful request, want 1", used)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	if _, err := c.ForwardRequest(context.Background(), req); !errors.Is(err, premium.ErrBudgetExhausted) {
+		t.Fatalf("ForwardRequest over budget: %v, want ErrBudgetExhausted", err)
+	}
+}
+
+func TestForwardRequestDecompressesUpstreamResponse(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			io.WriteString(w, "uncompressed")
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, `{"ok":true}`)
+		gz.Close()
+	})
+	c := newTestClient(t, upstream, "a")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model":"m"}`))
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	resp, err := c.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"ok":true}` || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("got %q with Content-Encoding %q, want the decoded body", body, resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestForwardRequestRefreshesOnceForConcurrentUnauthorized(t *testing.T) {
+	const callers = 8
+	var exchanges, rejected atomic.Int32
+	var arrived sync.WaitGroup
+	var tm *TokenManager
+	arrived.Add(callers)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/copilot_internal/v2/token" {
+			// The first exchange hands out a token Copilot then rejects.
+			token := "stale"
+			if exchanges.Add(1) > 1 {
+				token = "fresh"
+			}
+			json.NewEncoder(w).Encode(ExchangeTokenResponse{Token: token, ExpiresAt: time.Now().Add(time.Hour).Unix(), RefreshIn: 1500})
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") == "Bearer stale" {
+			// Hold the rejections until every caller has one in flight.
+			// Half of them then race for the refresh; the other half
+			// only learn of the rejection once the token was replaced.
+			arrived.Done()
+			arrived.Wait()
+			if rejected.Add(1) > callers/2 {
+				for tm.GetToken() != "fresh" {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	})
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var err error
+	tm, err = NewTokenManager(context.Background(), "a", "gho_a", GitHubHost{WebURL: srv.URL, APIURL: srv.URL}, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tm.Close)
+	pool, err := NewPool([]*Account{{Name: "a", TokenManager: tm}}, StrategyRoundRobin, time.Minute, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(pool, TimeoutPolicy{Default: DefaultTimeouts}, logger, WithAPIURL(srv.URL))
+
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"model":"m","caller":%d}`, i)
+			resp, err := c.ForwardRequest(context.Background(), httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body)))
+			if err != nil {
+				t.Errorf("caller %d: %v", i, err)
+				return
+			}
+			defer resp.Body.Close()
+			got, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(got) != body {
+				t.Errorf("caller %d: got %d %q, want 200 with its own body replayed", i, resp.StatusCode, got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := exchanges.Load(); n != 2 {
+		t.Errorf("%d token exchanges, want the initial one and a single shared refresh", n)
+	}
+	if account := pool.Status()[0]; !account.Healthy {
+		t.Error("account ejected although the refreshed token was accepted")
+	}
+}
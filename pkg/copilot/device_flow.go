@@ -11,11 +11,15 @@ import (
 )
 
 const (
-	githubDeviceCodeURL  = "https://github.com/login/device/code"
-	githubAccessTokenURL = "https://github.com/login/oauth/access_token"
-	githubClientID       = "Iv1.b507a08c87ecfe98"
+	githubDeviceCodePath  = "/login/device/code"
+	githubAccessTokenPath = "/login/oauth/access_token"
+	githubClientID        = "Iv1.b507a08c87ecfe98"
 )
 
+// slowDownStep is how much longer the poll interval gets each time GitHub
+// answers "slow_down" without saying what interval it wants.
+var slowDownStep = 5 * time.Second
+
 // DeviceCodeResponse holds the response from the GitHub device code endpoint.
 type DeviceCodeResponse struct {
 	DeviceCode      string `json:"device_code"`
@@ -31,10 +35,11 @@ type AccessTokenResponse struct {
 	TokenType   string `json:"token_type"`
 	Scope       string `json:"scope"`
 	Error       string `json:"error"`
+	Interval    int    `json:"interval,omitempty"`
 }
 
 // GetDeviceCode retrieves a device and user code from GitHub.
-func GetDeviceCode(ctx context.Context) (*DeviceCodeResponse, error) {
+func GetDeviceCode(ctx context.Context, host GitHubHost) (*DeviceCodeResponse, error) {
 	body, err := json.Marshal(map[string]string{
 		"client_id": githubClientID,
 		"scope":     "read:user",
@@ -43,7 +48,7 @@ func GetDeviceCode(ctx context.Context) (*DeviceCodeResponse, error) {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", githubDeviceCodeURL, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", host.WebURL+githubDeviceCodePath, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create device code request: %w", err)
 	}
@@ -69,8 +74,9 @@ func GetDeviceCode(ctx context.Context) (*DeviceCodeResponse, error) {
 	return &deviceCodeResp, nil
 }
 
-// PollAccessToken polls GitHub for an access token using the device code.
-func PollAccessToken(ctx context.Context, deviceCode *DeviceCodeResponse) (string, error) {
+// PollAccessToken polls GitHub for an access token using the device code,
+// backing off when GitHub asks it to slow down.
+func PollAccessToken(ctx context.Context, host GitHubHost, deviceCode *DeviceCodeResponse) (string, error) {
 	interval := time.Duration(deviceCode.Interval) * time.Second
 
 	for {
@@ -87,7 +93,7 @@ func PollAccessToken(ctx context.Context, deviceCode *DeviceCodeResponse) (strin
 				return "", fmt.Errorf("failed to marshal request body: %w", err)
 			}
 
-			req, err := http.NewRequestWithContext(ctx, "POST", githubAccessTokenURL, bytes.NewBuffer(body))
+			req, err := http.NewRequestWithContext(ctx, "POST", host.WebURL+githubAccessTokenPath, bytes.NewBuffer(body))
 			if err != nil {
 				return "", fmt.Errorf("failed to create access token request: %w", err)
 			}
@@ -100,24 +106,31 @@ func PollAccessToken(ctx context.Context, deviceCode *DeviceCodeResponse) (strin
 				fmt.Printf("failed to execute access token request: %v\n", err)
 				continue
 			}
-			defer resp.Body.Close()
 
 			var accessTokenResp AccessTokenResponse
-			if err := json.NewDecoder(resp.Body).Decode(&accessTokenResp); err != nil {
+			err = json.NewDecoder(resp.Body).Decode(&accessTokenResp)
+			resp.Body.Close()
+			if err != nil {
 				fmt.Printf("failed to decode access token response: %v\n", err)
 				continue
 			}
 
-			if accessTokenResp.Error != "" {
-				// These are expected errors while the user hasn't authorized.
-				// e.g. "authorization_pending", "slow_down", "expired_token"
-				if accessTokenResp.Error == "authorization_pending" {
-					// continue polling
-				} else if accessTokenResp.Error == "expired_token" {
-					return "", fmt.Errorf("device code expired")
+			switch accessTokenResp.Error {
+			case "":
+			case "authorization_pending":
+				// The user has not entered the code yet.
+				continue
+			case "slow_down":
+				if accessTokenResp.Interval > 0 {
+					interval = time.Duration(accessTokenResp.Interval) * time.Second
+				} else {
+					interval += slowDownStep
 				}
-				// "slow_down" means we should increase the interval, but for now we just continue
 				continue
+			case "expired_token":
+				return "", fmt.Errorf("device code expired")
+			default:
+				return "", fmt.Errorf("device authorization failed: %s", accessTokenResp.Error)
 			}
 
 			if accessTokenResp.AccessToken != "" {
@@ -0,0 +1,202 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ghesStandIn is a GitHub Enterprise Server stand-in serving the device
+// flow under /login and the token exchange under /api/v3. Access token
+// polls are answered with the queued errors before the token is issued.
+type ghesStandIn struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	paths  []string
+	polls  []string
+	auth   string
+	client string
+}
+
+func newGHESStandIn(t *testing.T, polls ...string) *ghesStandIn {
+	t.Helper()
+	g := &ghesStandIn{polls: polls}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		g.record(r)
+		g.mu.Lock()
+		g.client = body["client_id"]
+		g.mu.Unlock()
+		json.NewEncoder(w).Encode(DeviceCodeResponse{
+			DeviceCode:      "dc-1",
+			UserCode:        "ABCD-1234",
+			VerificationURI: g.URL + "/login/device",
+			ExpiresIn:       900,
+		})
+	})
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		g.record(r)
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["device_code"] != "dc-1" {
+			json.NewEncoder(w).Encode(AccessTokenResponse{Error: "bad_verification_code"})
+			return
+		}
+		g.mu.Lock()
+		var next string
+		if len(g.polls) > 0 {
+			next, g.polls = g.polls[0], g.polls[1:]
+		}
+		g.mu.Unlock()
+		if next != "" {
+			json.NewEncoder(w).Encode(AccessTokenResponse{Error: next})
+			return
+		}
+		json.NewEncoder(w).Encode(AccessTokenResponse{AccessToken: "gho_ghes", TokenType: "bearer"})
+	})
+	mux.HandleFunc("GET /api/v3/copilot_internal/v2/token", func(w http.ResponseWriter, r *http.Request) {
+		g.record(r)
+		g.mu.Lock()
+		g.auth = r.Header.Get("Authorization")
+		g.mu.Unlock()
+		json.NewEncoder(w).Encode(ExchangeTokenResponse{
+			Token:     "tid=ghes",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			RefreshIn: 1500,
+			Endpoints: Endpoints{API: "https://copilot-api.github.example.com"},
+			SKU:       "copilot_enterprise_seat",
+		})
+	})
+	g.Server = httptest.NewServer(mux)
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *ghesStandIn) record(r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paths = append(g.paths, r.Method+" "+r.URL.Path)
+}
+
+func (g *ghesStandIn) host(t *testing.T) GitHubHost {
+	t.Helper()
+	// Any host other than github.com is treated as GitHub Enterprise Server.
+	host, err := ParseGitHubHost(g.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.APIURL != g.URL+"/api/v3" {
+		t.Fatalf("APIURL = %q, want %q", host.APIURL, g.URL+"/api/v3")
+	}
+	return host
+}
+
+func TestDeviceFlowAndExchangeAgainstGHES(t *testing.T) {
+	slowDownStep = 10 * time.Millisecond
+	t.Cleanup(func() { slowDownStep = 5 * time.Second })
+
+	g := newGHESStandIn(t, "authorization_pending", "slow_down", "authorization_pending")
+	host := g.host(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	code, err := GetDeviceCode(ctx, host)
+	if err != nil {
+		t.Fatalf("GetDeviceCode: %v", err)
+	}
+	if code.UserCode != "ABCD-1234" || code.VerificationURI != g.URL+"/login/device" {
+		t.Fatalf("unexpected device code response: %+v", code)
+	}
+
+	token, err := PollAccessToken(ctx, host, code)
+	if err != nil {
+		t.Fatalf("PollAccessToken: %v", err)
+	}
+	if token != "gho_ghes" {
+		t.Fatalf("token = %q, want gho_ghes", token)
+	}
+
+	session, err := ExchangeGitHubToken(ctx, host, token)
+	if err != nil {
+		t.Fatalf("ExchangeGitHubToken: %v", err)
+	}
+	if session.Token != "tid=ghes" || session.SKU != "copilot_enterprise_seat" {
+		t.Fatalf("unexpected exchange response: %+v", session)
+	}
+
+	want := []string{
+		"POST /login/device/code",
+		"POST /login/oauth/access_token",
+		"POST /login/oauth/access_token",
+		"POST /login/oauth/access_token",
+		"POST /login/oauth/access_token",
+		"GET /api/v3/copilot_internal/v2/token",
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !slices.Equal(g.paths, want) {
+		t.Errorf("requests = %q, want %q", g.paths, want)
+	}
+	if g.client != githubClientID {
+		t.Errorf("client_id = %q, want %q", g.client, githubClientID)
+	}
+	if g.auth != "token gho_ghes" {
+		t.Errorf("exchange Authorization = %q, want %q", g.auth, "token gho_ghes")
+	}
+}
+
+func TestPollAccessTokenSlowDownBacksOff(t *testing.T) {
+	slowDownStep = 50 * time.Millisecond
+	t.Cleanup(func() { slowDownStep = 5 * time.Second })
+
+	g := newGHESStandIn(t, "slow_down", "slow_down")
+	start := time.Now()
+	token, err := PollAccessToken(context.Background(), g.host(t), &DeviceCodeResponse{DeviceCode: "dc-1"})
+	if err != nil {
+		t.Fatalf("PollAccessToken: %v", err)
+	}
+	if token != "gho_ghes" {
+		t.Fatalf("token = %q, want gho_ghes", token)
+	}
+	// The interval grows by one step per slow_down: 0, 50ms, then 100ms.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("polling took %s, want at least 150ms of back-off", elapsed)
+	}
+}
+
+func TestPollAccessTokenStops(t *testing.T) {
+	tests := []struct {
+		name  string
+		error string
+	}{
+		{"expired", "expired_token"},
+		{"denied", "access_denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGHESStandIn(t, "authorization_pending", tt.error)
+			if _, err := PollAccessToken(context.Background(), g.host(t), &DeviceCodeResponse{DeviceCode: "dc-1"}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestExchangeGitHubTokenRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	host, _ := ParseGitHubHost(srv.URL)
+	if _, err := ExchangeGitHubToken(context.Background(), host, "gho_bad"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,60 @@
+package copilot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GitHubHost holds the web and API base URLs of a GitHub instance, either
+// github.com or a GitHub Enterprise Server installation.
+type GitHubHost struct {
+	WebURL string
+	APIURL string
+}
+
+// DefaultGitHubHost is github.com.
+var DefaultGitHubHost = GitHubHost{
+	WebURL: "https://github.com",
+	APIURL: "https://api.github.com",
+}
+
+// ParseGitHubHost derives the base URLs for a GitHub hostname or URL.
+// github.com (or an empty value) maps to DefaultGitHubHost, GHE.com tenants
+// use their api. subdomain, and any other host is treated as GitHub
+// Enterprise Server with its API under /api/v3. A scheme may be given to
+// reach a server over plain http.
+func ParseGitHubHost(raw string) (GitHubHost, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return DefaultGitHubHost, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return GitHubHost{}, fmt.Errorf("invalid GitHub host %q: %w", raw, err)
+	}
+	if u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return GitHubHost{}, fmt.Errorf("invalid GitHub host %q", raw)
+	}
+
+	hostname := strings.ToLower(u.Hostname())
+	switch {
+	case hostname == "github.com" || hostname == "www.github.com":
+		return DefaultGitHubHost, nil
+	case strings.HasSuffix(hostname, ".ghe.com"):
+		base := u.Scheme + "://" + u.Host
+		return GitHubHost{WebURL: base, APIURL: u.Scheme + "://api." + u.Host}, nil
+	default:
+		base := u.Scheme + "://" + u.Host + strings.TrimRight(u.Path, "/")
+		return GitHubHost{WebURL: base, APIURL: base + "/api/v3"}, nil
+	}
+}
+
+// String returns the web URL, which identifies the instance.
+func (h GitHubHost) String() string {
+	return h.WebURL
+}
@@ -0,0 +1,36 @@
+package copilot
+
+import "testing"
+
+func TestParseGitHubHost(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want GitHubHost
+	}{
+		{"", DefaultGitHubHost},
+		{"github.com", DefaultGitHubHost},
+		{"https://www.github.com/", DefaultGitHubHost},
+		{"acme.ghe.com", GitHubHost{WebURL: "https://acme.ghe.com", APIURL: "https://api.acme.ghe.com"}},
+		{"github.example.com", GitHubHost{WebURL: "https://github.example.com", APIURL: "https://github.example.com/api/v3"}},
+		{"GitHub.Example.com:8443", GitHubHost{WebURL: "https://GitHub.Example.com:8443", APIURL: "https://GitHub.Example.com:8443/api/v3"}},
+		{"http://10.0.0.5/github/", GitHubHost{WebURL: "http://10.0.0.5/github", APIURL: "http://10.0.0.5/github/api/v3"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseGitHubHost(tt.raw)
+		if err != nil {
+			t.Errorf("ParseGitHubHost(%q): %v", tt.raw, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseGitHubHost(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseGitHubHostInvalid(t *testing.T) {
+	for _, raw := range []string{"ftp://github.example.com", "https://", "http://%zz"} {
+		if _, err := ParseGitHubHost(raw); err == nil {
+			t.Errorf("ParseGitHubHost(%q): expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package copilot
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// Values of the X-Initiator header, which tells Copilot whether a request
+// was made by the user or by an agent on the user's behalf. Only
+// user-initiated requests count as premium requests.
+const (
+	InitiatorUser  = "user"
+	InitiatorAgent = "agent"
+)
+
+// Initiator modes.
+const (
+	// InitiatorAuto classifies each request with the policy's rules.
+	InitiatorAuto = "auto"
+	// InitiatorOff leaves the header as the client sent it.
+	InitiatorOff = "off"
+)
+
+// Conditions that mark a request as agent-initiated.
+const (
+	// AgentOnToolResults matches requests whose last message is a tool
+	// result, i.e. the model is continuing after a tool call.
+	AgentOnToolResults = "tool_results"
+	// AgentOnFollowUp matches any request with an earlier assistant turn.
+	AgentOnFollowUp = "follow_up"
+)
+
+// InitiatorPolicy decides the X-Initiator header of chat requests. Mode is
+// InitiatorAuto, InitiatorOff, or InitiatorUser or InitiatorAgent to send
+// that value for every request. Clients fixes the initiator per API key
+// name in auto mode, and AgentWhen lists the conditions that make any
+// other request agent-initiated.
+type InitiatorPolicy struct {
+	Mode      string
+	AgentWhen []string
+	Clients   map[string]string
+}
+
+// DefaultInitiatorPolicy treats calls that carry tool results as agent
+// calls.
+var DefaultInitiatorPolicy = InitiatorPolicy{
+	Mode:      InitiatorAuto,
+	AgentWhen: []string{AgentOnToolResults},
+}
+
+// Initiator returns the X-Initiator value for a chat request from client
+// with the given body, or "" to leave the header alone.
+func (p InitiatorPolicy) Initiator(client string, body []byte) string {
+	switch p.Mode {
+	case InitiatorUser, InitiatorAgent:
+		return p.Mode
+	case InitiatorAuto:
+	default:
+		return ""
+	}
+	if initiator, ok := p.Clients[client]; ok {
+		return initiator
+	}
+
+	var req struct {
+		Messages []struct {
+			Role string `json:"role"`
+		} `json:"messages"`
+	}
+	if json.Unmarshal(body, &req) != nil || len(req.Messages) == 0 {
+		return InitiatorUser
+	}
+	if slices.Contains(p.AgentWhen, AgentOnToolResults) && req.Messages[len(req.Messages)-1].Role == "tool" {
+		return InitiatorAgent
+	}
+	if slices.Contains(p.AgentWhen, AgentOnFollowUp) {
+		for _, message := range req.Messages {
+			if message.Role == "assistant" {
+				return InitiatorAgent
+			}
+		}
+	}
+	return InitiatorUser
+}
@@ -0,0 +1,96 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Model is a single entry of the Copilot /models response.
+type Model struct {
+	ID                 string            `json:"id"`
+	Name               string            `json:"name"`
+	Object             string            `json:"object"`
+	Vendor             string            `json:"vendor"`
+	Version            string            `json:"version"`
+	Preview            bool              `json:"preview"`
+	ModelPickerEnabled bool              `json:"model_picker_enabled"`
+	Capabilities       ModelCapabilities `json:"capabilities"`
+	Policy             *ModelPolicy      `json:"policy,omitempty"`
+}
+
+// ModelCapabilities describes what a model supports and its limits.
+type ModelCapabilities struct {
+	Family    string        `json:"family"`
+	Type      string        `json:"type"`
+	Tokenizer string        `json:"tokenizer"`
+	Limits    ModelLimits   `json:"limits"`
+	Supports  ModelSupports `json:"supports"`
+	Object    string        `json:"object,omitempty"`
+}
+
+// ModelLimits holds the token and input limits of a model.
+type ModelLimits struct {
+	MaxContextWindowTokens int         `json:"max_context_window_tokens,omitempty"`
+	MaxOutputTokens        int         `json:"max_output_tokens,omitempty"`
+	MaxPromptTokens        int         `json:"max_prompt_tokens,omitempty"`
+	MaxInputs              int         `json:"max_inputs,omitempty"`
+	Vision                 *VisionInfo `json:"vision,omitempty"`
+}
+
+// VisionInfo holds the image limits of a vision-capable model.
+type VisionInfo struct {
+	MaxPromptImageSize  int      `json:"max_prompt_image_size,omitempty"`
+	MaxPromptImages     int      `json:"max_prompt_images,omitempty"`
+	SupportedMediaTypes []string `json:"supported_media_types,omitempty"`
+}
+
+// ModelSupports lists the optional features a model accepts.
+type ModelSupports struct {
+	ToolCalls         bool `json:"tool_calls,omitempty"`
+	ParallelToolCalls bool `json:"parallel_tool_calls,omitempty"`
+	Streaming         bool `json:"streaming,omitempty"`
+	StructuredOutputs bool `json:"structured_outputs,omitempty"`
+	Vision            bool `json:"vision,omitempty"`
+	Dimensions        bool `json:"dimensions,omitempty"`
+}
+
+// ModelPolicy reports whether the user has enabled a model.
+type ModelPolicy struct {
+	State string `json:"state"`
+	Terms string `json:"terms,omitempty"`
+}
+
+// ModelsResponse is the Copilot /models response.
+type ModelsResponse struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+// ListModels fetches the list of models available to the authenticated user.
+func (c *Client) ListModels(ctx context.Context) (*ModelsResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.ForwardRequest(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute models request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("models request failed with status %s: %s", resp.Status, string(bodyBytes))
+	}
+
+	var models ModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, fmt.Errorf("failed to decode models response: %w", err)
+	}
+	return &models, nil
+}
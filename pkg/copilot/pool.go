@@ -0,0 +1,312 @@
+package copilot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Strategy selects how the pool distributes requests across accounts.
+type Strategy string
+
+const (
+	// StrategyRoundRobin cycles through the healthy accounts in order.
+	StrategyRoundRobin Strategy = "round-robin"
+	// StrategyLeastLoaded picks the healthy account with the fewest
+	// in-flight requests.
+	StrategyLeastLoaded Strategy = "least-loaded"
+	// StrategySticky pins each inbound client to one account for as long
+	// as that account stays healthy.
+	StrategySticky Strategy = "sticky"
+)
+
+// ParseStrategy validates a strategy name. An empty name means round-robin.
+func ParseStrategy(name string) (Strategy, error) {
+	switch Strategy(name) {
+	case "":
+		return StrategyRoundRobin, nil
+	case StrategyRoundRobin, StrategyLeastLoaded, StrategySticky:
+		return Strategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown account strategy %q (want round-robin, least-loaded or sticky)", name)
+	}
+}
+
+// ErrNoAccountAvailable is returned when failing over and no other account
+// is healthy.
+var ErrNoAccountAvailable = errors.New("no Copilot account available")
+
+// Account is one GitHub account with its own Copilot token.
+type Account struct {
+	Name         string
+	TokenManager *TokenManager
+
+	inFlight       int
+	requests       int64
+	failures       int64
+	cooldownUntil  time.Time
+	lastStatus     int
+	lastError      string
+	lastErrorAt    time.Time
+	lastResponseAt time.Time
+}
+
+// AccountStatus is a snapshot of an account's health for reporting.
+type AccountStatus struct {
+	Name          string     `json:"name"`
+	Healthy       bool       `json:"healthy"`
+	APIEndpoint   string     `json:"api_endpoint"`
+	SKU           string     `json:"sku,omitempty"`
+	ChatEnabled   bool       `json:"chat_enabled"`
+	InFlight      int        `json:"in_flight"`
+	Requests      int64      `json:"requests"`
+	Failures      int64      `json:"failures"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	// LastResponseAt is when Copilot last answered a request, whatever the
+	// status; a LastErrorAt after it means Copilot could not be reached.
+	LastResponseAt *time.Time `json:"last_response_at,omitempty"`
+	Token          TokenState `json:"token"`
+}
+
+// Pool distributes requests across several accounts and takes accounts out
+// of rotation for a cool-down period when Copilot rejects them.
+type Pool struct {
+	mu       sync.Mutex
+	accounts []*Account
+	strategy Strategy
+	cooldown time.Duration
+	next     int
+	sticky   map[string]*Account
+	logger   *slog.Logger
+}
+
+// NewPool creates a pool over accounts. cooldown is how long an account is
+// ejected after a 401, 403 or 429 without a Retry-After header.
+func NewPool(accounts []*Account, strategy Strategy, cooldown time.Duration, logger *slog.Logger) (*Pool, error) {
+	if len(accounts) == 0 {
+		return nil, errors.New("pool needs at least one account")
+	}
+	return &Pool{
+		accounts: accounts,
+		strategy: strategy,
+		cooldown: cooldown,
+		sticky:   make(map[string]*Account),
+		logger:   logger,
+	}, nil
+}
+
+// Accounts returns the accounts in the pool.
+func (p *Pool) Accounts() []*Account {
+	return p.accounts
+}
+
+// Close stops the token managers of all accounts.
+func (p *Pool) Close() {
+	for _, account := range p.accounts {
+		account.TokenManager.Close()
+	}
+}
+
+// Acquire picks an account for a request from client and counts the
+// request as in flight. The returned release function must be called once
+// the request has finished. If every account is cooling down, the one that
+// recovers first is used, so Copilot's own rejection reaches the caller
+// rather than the pool refusing the request.
+func (p *Pool) Acquire(client string) (*Account, func(), error) {
+	return p.acquire(client, true)
+}
+
+// acquireHealthy is like Acquire but fails with ErrNoAccountAvailable
+// instead of falling back to an account that is cooling down.
+func (p *Pool) acquireHealthy(client string) (*Account, func(), error) {
+	return p.acquire(client, false)
+}
+
+func (p *Pool) acquire(client string, fallback bool) (*Account, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	account := p.pick(client, time.Now(), fallback)
+	if account == nil {
+		return nil, nil, ErrNoAccountAvailable
+	}
+	account.inFlight++
+	account.requests++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			account.inFlight--
+		})
+	}
+	return account, release, nil
+}
+
+func (p *Pool) pick(client string, now time.Time, fallback bool) *Account {
+	healthy := make([]*Account, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		if !now.Before(account.cooldownUntil) {
+			healthy = append(healthy, account)
+		}
+	}
+	if len(healthy) == 0 {
+		if !fallback {
+			return nil
+		}
+		return p.soonestRecovering()
+	}
+
+	switch p.strategy {
+	case StrategyLeastLoaded:
+		best := healthy[0]
+		for _, account := range healthy[1:] {
+			if account.inFlight < best.inFlight {
+				best = account
+			}
+		}
+		return best
+	case StrategySticky:
+		if account, ok := p.sticky[client]; ok && !now.Before(account.cooldownUntil) {
+			return account
+		}
+		account := p.roundRobin(healthy)
+		if previous, ok := p.sticky[client]; ok {
+			p.logger.Info("Moving client to another Copilot account", "client", client, "from", previous.Name, "to", account.Name)
+		}
+		p.sticky[client] = account
+		return account
+	default:
+		return p.roundRobin(healthy)
+	}
+}
+
+// soonestRecovering returns the account whose cool-down ends first.
+func (p *Pool) soonestRecovering() *Account {
+	best := p.accounts[0]
+	for _, account := range p.accounts[1:] {
+		if account.cooldownUntil.Before(best.cooldownUntil) {
+			best = account
+		}
+	}
+	return best
+}
+
+func (p *Pool) roundRobin(healthy []*Account) *Account {
+	account := healthy[p.next%len(healthy)]
+	p.next++
+	return account
+}
+
+// Report records the outcome of a request made with account and ejects the
+// account for a cool-down if Copilot rejected it, reporting whether it did.
+func (p *Pool) Report(account *Account, resp *http.Response, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		account.failures++
+		account.lastError = err.Error()
+		account.lastErrorAt = time.Now()
+		return false
+	}
+
+	now := time.Now()
+	account.lastStatus = resp.StatusCode
+	account.lastResponseAt = now
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		cooldown := p.cooldown
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+		account.failures++
+		account.cooldownUntil = now.Add(cooldown)
+		account.lastError = resp.Status
+		account.lastErrorAt = now
+		p.logger.Warn("Copilot account ejected",
+			"account", account.Name,
+			"status", resp.StatusCode,
+			"cooldown", cooldown.String())
+		return true
+	}
+	return false
+}
+
+// Status reports the health of every account.
+func (p *Pool) Status() []AccountStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]AccountStatus, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		session := account.TokenManager.Session()
+		status := AccountStatus{
+			Name:        account.Name,
+			Healthy:     !now.Before(account.cooldownUntil),
+			APIEndpoint: account.TokenManager.APIEndpoint(),
+			SKU:         session.SKU,
+			ChatEnabled: session.ChatEnabled,
+			Token:       account.TokenManager.State(),
+			InFlight:    account.inFlight,
+			Requests:    account.requests,
+			Failures:    account.failures,
+			LastStatus:  account.lastStatus,
+			LastError:   account.lastError,
+		}
+		if !status.Healthy {
+			until := account.cooldownUntil
+			status.CooldownUntil = &until
+		}
+		if !account.lastErrorAt.IsZero() {
+			at := account.lastErrorAt
+			status.LastErrorAt = &at
+		}
+		if !account.lastResponseAt.IsZero() {
+			at := account.lastResponseAt
+			status.LastResponseAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// releaseOnClose wraps a response body so the pool learns when a streamed
+// response has been fully consumed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+type clientIDKey struct{}
+
+// WithClientID returns a copy of ctx identifying the inbound client, used by
+// the sticky strategy.
+func WithClientID(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientIDKey{}, client)
+}
+
+func clientIDFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientIDKey{}).(string)
+	return client
+}
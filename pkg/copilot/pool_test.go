@@ -0,0 +1,121 @@
+package copilot
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, strategy Strategy, names ...string) *Pool {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	accounts := make([]*Account, 0, len(names))
+	for _, name := range names {
+		accounts = append(accounts, &Account{Name: name, TokenManager: NewStaticTokenManager(name, "token-"+name, logger)})
+	}
+	pool, err := NewPool(accounts, strategy, time.Minute, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func rejection(status int, retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: status, Status: http.StatusText(status), Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func acquireName(t *testing.T, pool *Pool, client string) string {
+	t.Helper()
+	account, release, err := pool.Acquire(client)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	release()
+	return account.Name
+}
+
+func TestPoolReportEjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    *http.Response
+		ejected bool
+	}{
+		{"ok", rejection(http.StatusOK, ""), false},
+		{"server error", rejection(http.StatusInternalServerError, ""), false},
+		{"unauthorized", rejection(http.StatusUnauthorized, ""), true},
+		{"forbidden", rejection(http.StatusForbidden, ""), true},
+		{"rate limited", rejection(http.StatusTooManyRequests, "30"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestPool(t, StrategyRoundRobin, "a")
+			account := pool.Accounts()[0]
+			if got := pool.Report(account, tt.resp, nil); got != tt.ejected {
+				t.Fatalf("Report = %v, want %v", got, tt.ejected)
+			}
+			if healthy := pool.Status()[0].Healthy; healthy == tt.ejected {
+				t.Errorf("healthy = %v after %d", healthy, tt.resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestPoolReportHonoursRetryAfter(t *testing.T) {
+	pool := newTestPool(t, StrategyRoundRobin, "a")
+	account := pool.Accounts()[0]
+	before := time.Now()
+	pool.Report(account, rejection(http.StatusTooManyRequests, "5"), nil)
+
+	until := pool.Status()[0].CooldownUntil
+	if until == nil {
+		t.Fatal("account not cooling down")
+	}
+	if d := until.Sub(before); d < 5*time.Second || d > 6*time.Second {
+		t.Errorf("cooldown = %v, want the 5s from Retry-After", d)
+	}
+}
+
+func TestPoolSkipsEjectedAccounts(t *testing.T) {
+	for _, strategy := range []Strategy{StrategyRoundRobin, StrategyLeastLoaded, StrategySticky} {
+		t.Run(string(strategy), func(t *testing.T) {
+			pool := newTestPool(t, strategy, "a", "b")
+			pool.Report(pool.Accounts()[0], rejection(http.StatusTooManyRequests, ""), nil)
+
+			for range 3 {
+				if name := acquireName(t, pool, "client"); name != "b" {
+					t.Fatalf("acquired %s, want the healthy account b", name)
+				}
+			}
+		})
+	}
+}
+
+func TestPoolFallsBackWhenAllAccountsCoolDown(t *testing.T) {
+	pool := newTestPool(t, StrategyRoundRobin, "a", "b")
+	a, b := pool.Accounts()[0], pool.Accounts()[1]
+	pool.Report(a, rejection(http.StatusTooManyRequests, "60"), nil)
+	pool.Report(b, rejection(http.StatusTooManyRequests, "10"), nil)
+
+	if name := acquireName(t, pool, ""); name != "b" {
+		t.Errorf("acquired %s, want b whose cooldown ends first", name)
+	}
+	if _, _, err := pool.acquireHealthy(""); err != ErrNoAccountAvailable {
+		t.Errorf("acquireHealthy error = %v, want ErrNoAccountAvailable", err)
+	}
+}
+
+func TestForwardRequestPassesThroughWhenAllAccountsCoolDown(t *testing.T) {
+	c := newTestClient(t, rateLimitAccount("a"), "a")
+
+	for range 2 {
+		if status, _ := forward(t, c); status != http.StatusTooManyRequests {
+			t.Fatalf("got %d, want the upstream 429 while the only account cools down", status)
+		}
+	}
+}
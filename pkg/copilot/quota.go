@@ -0,0 +1,209 @@
+package copilot
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// quotaFetchTimeout bounds fetching the quotas of one account.
+const quotaFetchTimeout = 30 * time.Second
+
+// QuotaHeaderPrefix starts the response headers that carry the serving
+// account's remaining quotas.
+const QuotaHeaderPrefix = "x-copilot-quota-"
+
+// AccountQuota is the most recent quota snapshot of one account.
+type AccountQuota struct {
+	Account   string                   `json:"account"`
+	Plan      string                   `json:"plan,omitempty"`
+	ResetDate string                   `json:"reset_date,omitempty"`
+	Quotas    map[string]QuotaSnapshot `json:"quotas,omitempty"`
+	FetchedAt *time.Time               `json:"fetched_at,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+}
+
+// NewAccountQuota builds the snapshot of an account from its user info.
+func NewAccountQuota(account string, user *UserInfo, fetchedAt time.Time) AccountQuota {
+	return AccountQuota{
+		Account:   account,
+		Plan:      user.Plan,
+		ResetDate: user.ResetDate(),
+		Quotas:    user.Quotas(),
+		FetchedAt: &fetchedAt,
+	}
+}
+
+// QuotaMonitor polls copilot_internal/user for every account in a pool and
+// keeps the latest snapshots, so clients can be told how much allowance is
+// left before Copilot starts refusing requests.
+type QuotaMonitor struct {
+	pool     *Pool
+	logger   *slog.Logger
+	interval atomic.Int64
+	wake     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	doneCh   chan struct{}
+
+	mu        sync.RWMutex
+	snapshots map[string]AccountQuota
+}
+
+// NewQuotaMonitor creates a monitor and starts polling every interval, with
+// the first poll right away. A zero interval disables polling; snapshots
+// are then only taken by Refresh.
+func NewQuotaMonitor(pool *Pool, interval time.Duration, logger *slog.Logger) *QuotaMonitor {
+	m := &QuotaMonitor{
+		pool:      pool,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+		doneCh:    make(chan struct{}),
+		snapshots: make(map[string]AccountQuota),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.interval.Store(int64(interval))
+	go m.pollLoop()
+	return m
+}
+
+// SetInterval changes the polling interval, taking effect right away.
+func (m *QuotaMonitor) SetInterval(interval time.Duration) {
+	if time.Duration(m.interval.Swap(int64(interval))) == interval {
+		return
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops polling, abandoning a poll in progress.
+func (m *QuotaMonitor) Close() {
+	m.cancel()
+	<-m.doneCh
+}
+
+func (m *QuotaMonitor) pollLoop() {
+	defer close(m.doneCh)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	if m.interval.Load() <= 0 {
+		timer.Stop()
+	}
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.wake:
+			timer.Stop()
+		case <-timer.C:
+			m.Refresh(m.ctx)
+		}
+		if interval := time.Duration(m.interval.Load()); interval > 0 {
+			timer.Reset(interval)
+		}
+	}
+}
+
+// Refresh fetches the quotas of every account now. An account whose fetch
+// fails keeps its previous quotas, with the error alongside. Accounts
+// without a GitHub token, such as those replaying recorded traffic, have
+// no quotas to fetch and are skipped.
+func (m *QuotaMonitor) Refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, account := range m.pool.Accounts() {
+		if !account.TokenManager.HasGitHubToken() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.refreshAccount(ctx, account)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *QuotaMonitor) refreshAccount(ctx context.Context, account *Account) {
+	ctx, cancel := context.WithTimeout(ctx, quotaFetchTimeout)
+	defer cancel()
+	user, err := account.TokenManager.User(ctx)
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous, seen := m.snapshots[account.Name]
+	if err != nil {
+		m.logger.Warn("Failed to fetch Copilot quotas", "account", account.Name, "error", err)
+		previous.Account = account.Name
+		previous.Error = err.Error()
+		m.snapshots[account.Name] = previous
+		return
+	}
+
+	snapshot := NewAccountQuota(account.Name, user, now)
+	for id, quota := range snapshot.Quotas {
+		if quota.Unlimited || quota.Remaining > 0 {
+			continue
+		}
+		if old, ok := previous.Quotas[id]; seen && ok && !old.Unlimited && old.Remaining <= 0 {
+			continue
+		}
+		m.logger.Warn("Copilot quota used up", "account", account.Name, "quota", id, "resets", snapshot.ResetDate)
+	}
+	m.snapshots[account.Name] = snapshot
+}
+
+// Snapshot returns the latest quotas of every account, in pool order.
+// Accounts that have not been fetched yet are omitted.
+func (m *QuotaMonitor) Snapshot() []AccountQuota {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	quotas := make([]AccountQuota, 0, len(m.snapshots))
+	for _, account := range m.pool.Accounts() {
+		if snapshot, ok := m.snapshots[account.Name]; ok {
+			quotas = append(quotas, snapshot)
+		}
+	}
+	return quotas
+}
+
+// SetHeaders adds the latest quotas of account to h: the remaining and
+// entitled amount of each limited quota, and when they reset. Unlimited
+// quotas are left out.
+func (m *QuotaMonitor) SetHeaders(h http.Header, account string) {
+	m.mu.RLock()
+	snapshot, ok := m.snapshots[account]
+	m.mu.RUnlock()
+	if !ok || snapshot.FetchedAt == nil {
+		return
+	}
+	for id, quota := range snapshot.Quotas {
+		if quota.Unlimited {
+			continue
+		}
+		prefix := QuotaHeaderPrefix + strings.ReplaceAll(id, "_", "-")
+		h.Set(prefix+"-remaining", strconv.FormatFloat(quota.Remaining, 'f', -1, 64))
+		h.Set(prefix+"-entitlement", strconv.FormatFloat(quota.Entitlement, 'f', -1, 64))
+	}
+	if snapshot.ResetDate != "" {
+		h.Set(QuotaHeaderPrefix+"reset-date", snapshot.ResetDate)
+	}
+}
+
+// CopyQuotaHeaders copies the quota headers of an upstream response to a
+// response being written to a client.
+func CopyQuotaHeaders(dst, src http.Header) {
+	for key, values := range src {
+		if strings.HasPrefix(strings.ToLower(key), QuotaHeaderPrefix) {
+			dst[key] = values
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package copilot
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestQuotaMonitorSkipsAccountsWithoutGitHubToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pool, err := NewPool([]*Account{{Name: "static", TokenManager: NewStaticTokenManager("static", "token", logger)}},
+		StrategyRoundRobin, DefaultTimeouts.Total, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewQuotaMonitor(pool, 0, logger)
+	defer m.Close()
+
+	m.Refresh(context.Background())
+	if quotas := m.Snapshot(); len(quotas) != 0 {
+		t.Fatalf("Snapshot = %+v, want no entry for a static account", quotas)
+	}
+}
@@ -0,0 +1,180 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/modelpattern"
+)
+
+// Timeouts bounds the phases of an upstream request. Zero means no limit.
+type Timeouts struct {
+	// Connect covers getting a connection: DNS, dial and TLS handshake.
+	Connect time.Duration
+	// Header is the longest wait from sending the request to receiving
+	// the response headers. Non-streamed completions only send headers
+	// once the whole answer is ready.
+	Header time.Duration
+	// Idle is the longest gap between two reads of the response body,
+	// such as between the chunks of a stream.
+	Idle time.Duration
+	// Total caps the whole exchange, including the streamed body.
+	Total time.Duration
+}
+
+// DefaultTimeouts are used when the configuration sets none.
+var DefaultTimeouts = Timeouts{
+	Connect: 10 * time.Second,
+	Header:  5 * time.Minute,
+	Idle:    2 * time.Minute,
+	Total:   30 * time.Minute,
+}
+
+// merge returns t with the fields set in o replaced.
+func (t Timeouts) merge(o Timeouts) Timeouts {
+	if o.Connect != 0 {
+		t.Connect = o.Connect
+	}
+	if o.Header != 0 {
+		t.Header = o.Header
+	}
+	if o.Idle != 0 {
+		t.Idle = o.Idle
+	}
+	if o.Total != 0 {
+		t.Total = o.Total
+	}
+	return t
+}
+
+// TimeoutPolicy holds the default timeouts and per-model overrides. Model
+// keys are patterns as described in package modelpattern; the zero fields
+// of the matching override fall back to the defaults.
+type TimeoutPolicy struct {
+	Default Timeouts
+	Models  map[string]Timeouts
+}
+
+// For returns the timeouts that apply to model.
+func (p TimeoutPolicy) For(model string) Timeouts {
+	override, _ := modelpattern.Lookup(p.Models, model)
+	return p.Default.merge(override)
+}
+
+// TimeoutError reports which limit an upstream request exceeded.
+type TimeoutError struct {
+	Phase string
+	Limit time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("upstream %s timeout after %s", e.Phase, e.Limit)
+}
+
+// Timeout reports true, as net.Error does for timeouts.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// requestModel extracts the model of a JSON request body.
+func requestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Model
+}
+
+// phaseTimer cancels a request if a phase is not over within its limit.
+// The trace hooks run on transport goroutines, hence the lock.
+type phaseTimer struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel context.CancelCauseFunc
+}
+
+func (p *phaseTimer) start(phase string, limit time.Duration) {
+	if limit <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(limit, func() { p.cancel(&TimeoutError{Phase: phase, Limit: limit}) })
+}
+
+func (p *phaseTimer) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+// withPhaseTimeouts arms the connect and header timeouts for one request.
+// Call stop once the request returns.
+func withPhaseTimeouts(ctx context.Context, timeouts Timeouts, cancel context.CancelCauseFunc) (context.Context, func()) {
+	connect := &phaseTimer{cancel: cancel}
+	header := &phaseTimer{cancel: cancel}
+	trace := &httptrace.ClientTrace{
+		GetConn:              func(string) { connect.start("connect", timeouts.Connect) },
+		GotConn:              func(httptrace.GotConnInfo) { connect.stop() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { header.start("response header", timeouts.Header) },
+		GotFirstResponseByte: func() { header.stop() },
+	}
+	return httptrace.WithClientTrace(ctx, trace), func() {
+		connect.stop()
+		header.stop()
+	}
+}
+
+// timeoutBody enforces the idle timeout on a response body and ends the
+// total timeout when the body is closed. Reads that fail because a limit
+// was exceeded return the TimeoutError.
+type timeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	idle   time.Duration
+	timer  *time.Timer
+	total  *time.Timer
+}
+
+func newTimeoutBody(ctx context.Context, body io.ReadCloser, cancel context.CancelCauseFunc, idle time.Duration, total *time.Timer) *timeoutBody {
+	b := &timeoutBody{ReadCloser: body, ctx: ctx, cancel: cancel, idle: idle, total: total}
+	if idle > 0 {
+		b.timer = time.AfterFunc(idle, func() { cancel(&TimeoutError{Phase: "idle", Limit: idle}) })
+	}
+	return b
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.timer != nil {
+		b.timer.Reset(b.idle)
+	}
+	if err != nil && err != io.EOF {
+		if cause, ok := context.Cause(b.ctx).(*TimeoutError); ok {
+			err = cause
+		}
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if b.total != nil {
+		b.total.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,71 @@
+package copilot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"copilot-api-proxy/pkg/fsutil"
+)
+
+// cachedToken is the on-disk form of an exchanged Copilot token. It records
+// which GitHub token and host produced it so a re-authenticated account
+// never reuses a token from its previous identity.
+type cachedToken struct {
+	GitHubTokenHash string                `json:"github_token_sha256"`
+	Host            string                `json:"host"`
+	FetchedAt       time.Time             `json:"fetched_at"`
+	Response        ExchangeTokenResponse `json:"response"`
+}
+
+// loadCachedToken returns the cached exchange response at path if it was
+// produced for githubToken on host and is still usable. A missing, stale or
+// foreign cache yields nil without an error.
+func loadCachedToken(path, githubToken string, host GitHubHost) (*cachedToken, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+
+	var cached cachedToken
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("failed to parse token cache: %w", err)
+	}
+	if cached.GitHubTokenHash != hashToken(githubToken) || cached.Host != host.String() {
+		return nil, nil
+	}
+	if cached.Response.Token == "" || cached.Response.ExpiresAt == 0 {
+		return nil, nil
+	}
+	if !wallNow().Add(refreshBuffer).Before(time.Unix(cached.Response.ExpiresAt, 0)) {
+		return nil, nil
+	}
+	return &cached, nil
+}
+
+// saveCachedToken atomically writes an exchange response to path with
+// owner-only permissions.
+func saveCachedToken(path, githubToken string, host GitHubHost, resp *ExchangeTokenResponse, fetchedAt time.Time) error {
+	data, err := json.Marshal(cachedToken{
+		GitHubTokenHash: hashToken(githubToken),
+		Host:            host.String(),
+		FetchedAt:       fetchedAt,
+		Response:        *resp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal token cache: %w", err)
+	}
+	return fsutil.WriteFileAtomic(path, data)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
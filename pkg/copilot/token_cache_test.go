@@ -0,0 +1,93 @@
+package copilot
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadCachedToken(t *testing.T) {
+	ghes := GitHubHost{WebURL: "https://ghes.example.com", APIURL: "https://ghes.example.com/api/v3"}
+	valid := &ExchangeTokenResponse{Token: "copilot-token", ExpiresAt: time.Now().Add(time.Hour).Unix(), RefreshIn: 1500}
+	tests := []struct {
+		name        string
+		resp        *ExchangeTokenResponse
+		githubToken string
+		host        GitHubHost
+		want        bool
+	}{
+		{"matching entry", valid, "gho_a", DefaultGitHubHost, true},
+		{"other GitHub token", valid, "gho_b", DefaultGitHubHost, false},
+		{"other host", valid, "gho_a", ghes, false},
+		{"expired", &ExchangeTokenResponse{Token: "copilot-token", ExpiresAt: time.Now().Add(-time.Minute).Unix()}, "gho_a", DefaultGitHubHost, false},
+		{"expiring within the refresh buffer", &ExchangeTokenResponse{Token: "copilot-token", ExpiresAt: time.Now().Add(refreshBuffer / 2).Unix()}, "gho_a", DefaultGitHubHost, false},
+		{"without expiry", &ExchangeTokenResponse{Token: "copilot-token"}, "gho_a", DefaultGitHubHost, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "copilot_token.json")
+			if err := saveCachedToken(path, "gho_a", DefaultGitHubHost, tt.resp, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			cached, err := loadCachedToken(path, tt.githubToken, tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cached != nil; got != tt.want {
+				t.Fatalf("loaded = %v, want %v", got, tt.want)
+			}
+			if cached != nil && cached.Response.Token != "copilot-token" {
+				t.Errorf("token = %q, want copilot-token", cached.Response.Token)
+			}
+		})
+	}
+}
+
+func TestLoadCachedTokenMissingFile(t *testing.T) {
+	cached, err := loadCachedToken(filepath.Join(t.TempDir(), "missing.json"), "gho_a", DefaultGitHubHost)
+	if cached != nil || err != nil {
+		t.Fatalf("got %v, %v; want nil, nil for a missing cache", cached, err)
+	}
+}
+
+func TestSaveCachedTokenReplacesFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "copilot_token.json")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A reader that opened the old file keeps seeing it in full.
+	old, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	resp := &ExchangeTokenResponse{Token: "copilot-token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	if err := saveCachedToken(path, "gho_a", DefaultGitHubHost, resp, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("permissions = %o, want 600", perm)
+	}
+	if data, _ := io.ReadAll(old); string(data) != "old" {
+		t.Errorf("open reader saw %q, want the old file untouched", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only the cache without temporary files", len(entries))
+	}
+	if cached, err := loadCachedToken(path, "gho_a", DefaultGitHubHost); err != nil || cached == nil {
+		t.Fatalf("reading back the cache: %v, %v", cached, err)
+	}
+}
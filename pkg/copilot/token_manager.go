@@ -2,38 +2,155 @@ package copilot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
+
+	"copilot-api-proxy/pkg/metrics"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// defaultAPIEndpoint is used until the token exchange advertises one.
+const defaultAPIEndpoint = "https://api.individual.githubcopilot.com"
+
+const (
+	// refreshTimeout bounds a single token exchange.
+	refreshTimeout = 30 * time.Second
+	// refreshBuffer is how long before Copilot's refresh_in the token is
+	// refreshed.
+	refreshBuffer = 60 * time.Second
+	// minRefreshInterval keeps a tiny or negative refresh_in from turning
+	// the loop into a busy loop.
+	minRefreshInterval = 30 * time.Second
+	// Failed refreshes are retried with exponential backoff between these
+	// bounds, with up to backoffJitter of random spread.
+	minBackoff    = 5 * time.Second
+	maxBackoff    = 5 * time.Minute
+	backoffJitter = 0.2
+	// checkInterval is how often the loop compares the wall clock with the
+	// schedule. Timers run on the monotonic clock, which stops while the
+	// machine sleeps, so the loop cannot rely on one long timer.
+	checkInterval = 10 * time.Second
+	// clockJumpThreshold is how far the wall clock may drift from the
+	// monotonic clock between checks before a suspend/resume or clock
+	// change is assumed.
+	clockJumpThreshold = 30 * time.Second
 )
 
+// Token states reported by TokenState.State.
+const (
+	TokenValid      = "valid"
+	TokenRefreshing = "refreshing"
+	TokenFailing    = "failing"
+	TokenExpired    = "expired"
+)
+
+// TokenState is a snapshot of the token lifecycle for health reporting.
+type TokenState struct {
+	State               string     `json:"state"`
+	ExpiresAt           time.Time  `json:"expires_at"`
+	NextRefreshAt       time.Time  `json:"next_refresh_at"`
+	LastRefreshAt       time.Time  `json:"last_refresh_at"`
+	FailingSince        *time.Time `json:"failing_since,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// refreshCall is a refresh shared by every caller that needs a new token at
+// the same time.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
 // TokenManager handles the Copilot token and its refresh cycle.
 type TokenManager struct {
 	mu           sync.RWMutex
+	name         string
 	githubToken  string
+	githubHost   GitHubHost
+	cachePath    string
 	copilotToken string
-	refreshesAt  time.Time
+	apiEndpoint  string
+	session      ExchangeTokenResponse
+	inflight     *refreshCall
 	logger       *slog.Logger
 	stopCh       chan struct{}
+
+	// Schedule and health. All times are wall-clock only, so comparisons
+	// stay meaningful across suspend/resume.
+	expiresAt     time.Time
+	nextRefreshAt time.Time
+	lastRefreshAt time.Time
+	failingSince  time.Time
+	failures      int
+	lastError     string
 }
 
 // NewTokenManager creates a manager, gets the initial token, and starts the refresh loop.
-func NewTokenManager(ctx context.Context, githubToken string, logger *slog.Logger) (*TokenManager, error) {
+// If cachePath is set, exchanged tokens are persisted there and a cached
+// token that is still valid is reused instead of exchanging a new one.
+// The account name labels the manager's metrics.
+func NewTokenManager(ctx context.Context, name, githubToken string, githubHost GitHubHost, cachePath string, logger *slog.Logger) (*TokenManager, error) {
 	tm := &TokenManager{
+		name:        name,
 		githubToken: githubToken,
+		githubHost:  githubHost,
+		cachePath:   cachePath,
 		logger:      logger,
 		stopCh:      make(chan struct{}),
 	}
 
-	if err := tm.refresh(ctx); err != nil {
-		return nil, fmt.Errorf("initial token refresh failed: %w", err)
+	if !tm.loadCache() {
+		if err := tm.refresh(ctx); err != nil {
+			return nil, fmt.Errorf("initial token refresh failed: %w", err)
+		}
 	}
 
 	go tm.refreshTokenLoop()
 	return tm, nil
 }
 
+// NewStaticTokenManager creates a manager that always hands out token and
+// never refreshes it, for serving recorded traffic without a GitHub account.
+func NewStaticTokenManager(name, token string, logger *slog.Logger) *TokenManager {
+	return &TokenManager{
+		name:         name,
+		copilotToken: token,
+		logger:       logger,
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// loadCache adopts a still-valid cached token and reports whether it did.
+func (tm *TokenManager) loadCache() bool {
+	if tm.cachePath == "" {
+		return false
+	}
+	cached, err := loadCachedToken(tm.cachePath, tm.githubToken, tm.githubHost)
+	if err != nil {
+		tm.logger.Warn("Ignoring unusable Copilot token cache", "path", tm.cachePath, "error", err)
+		return false
+	}
+	if cached == nil {
+		return false
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.applyLocked(&cached.Response, cached.FetchedAt)
+	metrics.TokenRefreshes.Inc(tm.name, "cached")
+	tm.logger.Info("Using cached Copilot token",
+		"expires_at", cached.Response.ExpiresAt,
+		"next_refresh_at", tm.nextRefreshAt.Format(time.RFC3339))
+	return true
+}
+
 // GetToken returns the current, valid Copilot token in a thread-safe way.
 func (tm *TokenManager) GetToken() string {
 	tm.mu.RLock()
@@ -41,24 +158,128 @@ func (tm *TokenManager) GetToken() string {
 	return tm.copilotToken
 }
 
+// ForceRefresh refreshes the token after Copilot rejected staleToken.
+// Concurrent callers share a single refresh, and if the token has already
+// been replaced since staleToken was handed out, no refresh happens.
+func (tm *TokenManager) ForceRefresh(ctx context.Context, staleToken string) error {
+	_, span := tracing.Start(ctx, "token refresh", tracing.KindInternal, tracing.String("copilot.account", tm.name))
+	defer span.End()
+
+	tm.mu.Lock()
+	if tm.copilotToken != staleToken {
+		tm.mu.Unlock()
+		span.SetAttributes(tracing.Bool("token.already_replaced", true))
+		return nil
+	}
+	call := tm.startRefreshLocked("token rejected")
+	tm.mu.Unlock()
+
+	select {
+	case <-call.done:
+		span.SetError(call.err)
+		return call.err
+	case <-ctx.Done():
+		span.SetError(ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// State reports the current token lifecycle state.
+func (tm *TokenManager) State() TokenState {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	state := TokenState{
+		State:               TokenValid,
+		ExpiresAt:           tm.expiresAt,
+		NextRefreshAt:       tm.nextRefreshAt,
+		LastRefreshAt:       tm.lastRefreshAt,
+		ConsecutiveFailures: tm.failures,
+		LastError:           tm.lastError,
+	}
+	if !tm.failingSince.IsZero() {
+		since := tm.failingSince
+		state.FailingSince = &since
+	}
+
+	switch {
+	case !tm.expiresAt.IsZero() && !wallNow().Before(tm.expiresAt):
+		state.State = TokenExpired
+	case tm.inflight != nil:
+		state.State = TokenRefreshing
+	case tm.failures > 0:
+		state.State = TokenFailing
+	}
+	return state
+}
+
+// APIEndpoint returns the base URL of the Copilot API advertised by the
+// most recent token exchange.
+func (tm *TokenManager) APIEndpoint() string {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if tm.apiEndpoint == "" {
+		return defaultAPIEndpoint
+	}
+	return tm.apiEndpoint
+}
+
+// Session returns the most recent token exchange response, including plan
+// metadata such as the SKU and quotas.
+func (tm *TokenManager) Session() ExchangeTokenResponse {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.session
+}
+
+// HasGitHubToken reports whether the manager holds a GitHub token. Static
+// managers do not.
+func (tm *TokenManager) HasGitHubToken() bool {
+	return tm.githubToken != ""
+}
+
+// User fetches the plan and quotas of the account from GitHub. Static
+// managers have no GitHub token to ask with.
+func (tm *TokenManager) User(ctx context.Context) (*UserInfo, error) {
+	if tm.githubToken == "" {
+		return nil, errors.New("no GitHub token to fetch quotas with")
+	}
+	return GetCopilotUser(ctx, tm.githubHost, tm.githubToken)
+}
+
 // Close gracefully stops the background refresh loop.
 func (tm *TokenManager) Close() {
 	close(tm.stopCh)
 }
 
-// refreshTokenLoop runs in the background, refreshing the token before it expires.
+// refreshTokenLoop runs in the background, refreshing the token before it
+// expires. It wakes up periodically and compares the wall clock with the
+// schedule, refreshing right away if the wall clock jumped (for example
+// after the machine resumed from sleep).
 func (tm *TokenManager) refreshTokenLoop() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	watch := newDriftWatch(systemClock{start: time.Now()})
 	for {
-		tm.mu.RLock()
-		duration := time.Until(tm.refreshesAt)
-		tm.mu.RUnlock()
+		select {
+		case <-ticker.C:
+		case <-tm.stopCh:
+			tm.logger.Info("Token refresh loop stopped")
+			return
+		}
+
+		reason := tm.refreshReason(watch.check())
+		if reason == "" {
+			continue
+		}
+
+		tm.mu.Lock()
+		call := tm.startRefreshLocked(reason)
+		tm.mu.Unlock()
 
 		select {
-		case <-time.After(duration):
-			tm.logger.Info("Refreshing Copilot token")
-			if err := tm.refresh(context.Background()); err != nil {
-				tm.logger.Error("Failed to refresh token", "error", err)
-			}
+		case <-call.done:
 		case <-tm.stopCh:
 			tm.logger.Info("Token refresh loop stopped")
 			return
@@ -66,21 +287,202 @@ func (tm *TokenManager) refreshTokenLoop() {
 	}
 }
 
+// refreshReason reports why the loop should refresh at wall time now, given
+// how far the wall clock drifted from the monotonic clock since the last
+// check, or "" if it should not.
+func (tm *TokenManager) refreshReason(now time.Time, drift time.Duration) string {
+	if drift > clockJumpThreshold || drift < -clockJumpThreshold {
+		tm.logger.Info("Wall clock jumped, refreshing token", "drift", drift.Round(time.Second).String())
+		return "clock jump"
+	}
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if !now.Before(tm.nextRefreshAt) {
+		return "scheduled"
+	}
+	return ""
+}
+
+// clock reads the wall clock and the monotonic clock separately, so tests
+// can make them disagree the way a suspend/resume or clock change does.
+type clock interface {
+	// Wall returns the wall-clock time without a monotonic reading.
+	Wall() time.Time
+	// Monotonic returns the monotonic time elapsed since a fixed origin.
+	Monotonic() time.Duration
+}
+
+type systemClock struct {
+	start time.Time
+}
+
+func (c systemClock) Wall() time.Time          { return wallNow() }
+func (c systemClock) Monotonic() time.Duration { return time.Since(c.start) }
+
+// driftWatch measures how far the wall clock moved relative to the
+// monotonic clock between checks.
+type driftWatch struct {
+	clock    clock
+	lastWall time.Time
+	lastMono time.Duration
+}
+
+func newDriftWatch(c clock) *driftWatch {
+	return &driftWatch{clock: c, lastWall: c.Wall(), lastMono: c.Monotonic()}
+}
+
+// check returns the current wall time and the drift since the last check.
+func (w *driftWatch) check() (time.Time, time.Duration) {
+	wall, mono := w.clock.Wall(), w.clock.Monotonic()
+	drift := wall.Sub(w.lastWall) - (mono - w.lastMono)
+	w.lastWall, w.lastMono = wall, mono
+	return wall, drift
+}
+
+// startRefreshLocked starts a refresh unless one is already running and
+// returns the call to wait on. tm.mu must be held.
+func (tm *TokenManager) startRefreshLocked(reason string) *refreshCall {
+	if tm.inflight != nil {
+		return tm.inflight
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	tm.inflight = call
+
+	go func() {
+		// Not tied to any caller's context: several callers may be
+		// waiting on the same refresh.
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		tm.logger.Info("Refreshing Copilot token", "reason", reason)
+		call.err = tm.refresh(ctx)
+
+		tm.mu.Lock()
+		tm.inflight = nil
+		tm.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
 // refresh executes the token exchange and updates the manager's state.
+// On failure the next attempt is scheduled with exponential backoff.
 func (tm *TokenManager) refresh(ctx context.Context) error {
-	resp, err := ExchangeGitHubToken(ctx, tm.githubToken)
+	ctx, span := tracing.Start(ctx, "token exchange", tracing.KindClient,
+		tracing.String("copilot.account", tm.name),
+		tracing.String("github.host", tm.githubHost.String()))
+	defer span.End()
+
+	resp, err := ExchangeGitHubToken(ctx, tm.githubHost, tm.githubToken)
+	span.SetError(err)
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	now := wallNow()
 	if err != nil {
+		tm.failures++
+		if tm.failingSince.IsZero() {
+			tm.failingSince = now
+		}
+		tm.lastError = err.Error()
+		backoff := backoffDelay(tm.failures)
+		tm.nextRefreshAt = now.Add(backoff)
+		metrics.TokenRefreshes.Inc(tm.name, "failure")
+		tm.logger.Error("Failed to refresh token",
+			"error", err,
+			"consecutive_failures", tm.failures,
+			"retry_in", backoff.Round(time.Second).String())
 		return err
 	}
 
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
+	tm.applyLocked(resp, now)
+	metrics.TokenRefreshes.Inc(tm.name, "success")
+	tm.logger.Info("Successfully refreshed Copilot token",
+		"expires_at", resp.ExpiresAt,
+		"next_refresh_at", tm.nextRefreshAt.Format(time.RFC3339))
+
+	if tm.cachePath != "" {
+		if err := saveCachedToken(tm.cachePath, tm.githubToken, tm.githubHost, resp, now); err != nil {
+			tm.logger.Warn("Failed to cache Copilot token", "path", tm.cachePath, "error", err)
+		}
+	}
+	return nil
+}
 
+// applyLocked adopts an exchange response fetched at fetchedAt and schedules
+// the next refresh. tm.mu must be held.
+func (tm *TokenManager) applyLocked(resp *ExchangeTokenResponse, fetchedAt time.Time) {
 	tm.copilotToken = resp.Token
-	// Refresh 60 seconds before the official refresh_in time as a buffer.
-	refreshDuration := time.Duration(resp.RefreshIn-60) * time.Second
-	tm.refreshesAt = time.Now().Add(refreshDuration)
+	tm.session = *resp
+	tm.failures = 0
+	tm.failingSince = time.Time{}
+	tm.lastError = ""
+	tm.lastRefreshAt = fetchedAt
 
-	tm.logger.Info("Successfully refreshed Copilot token", "expires_at", resp.ExpiresAt)
-	return nil
+	endpoint, err := apiEndpoint(resp.Endpoints.API)
+	if err != nil {
+		tm.logger.Warn("Ignoring invalid API endpoint from token exchange", "endpoint", resp.Endpoints.API, "error", err)
+	} else if endpoint != tm.apiEndpoint {
+		tm.logger.Info("Using Copilot API endpoint", "endpoint", endpoint, "sku", resp.SKU)
+		tm.apiEndpoint = endpoint
+	}
+
+	tm.expiresAt = time.Time{}
+	if resp.ExpiresAt > 0 {
+		tm.expiresAt = time.Unix(resp.ExpiresAt, 0)
+	}
+	expiresAt := tm.expiresAt
+	metrics.TokenExpiry.SetFunc(func() float64 {
+		if expiresAt.IsZero() {
+			return 0
+		}
+		return time.Until(expiresAt).Seconds()
+	}, tm.name)
+	tm.nextRefreshAt = refreshTime(wallNow(), fetchedAt, time.Duration(resp.RefreshIn)*time.Second, tm.expiresAt)
+}
+
+// refreshTime computes when to refresh a token fetched at fetchedAt:
+// refreshBuffer before Copilot's refresh_in, never after the token expires,
+// and never sooner than minRefreshInterval from now.
+func refreshTime(now, fetchedAt time.Time, refreshIn time.Duration, expiresAt time.Time) time.Time {
+	at := fetchedAt.Add(refreshIn - refreshBuffer)
+	if !expiresAt.IsZero() && expiresAt.Add(-refreshBuffer).Before(at) {
+		at = expiresAt.Add(-refreshBuffer)
+	}
+	if earliest := now.Add(minRefreshInterval); at.Before(earliest) {
+		at = earliest
+	}
+	return at
+}
+
+// backoffDelay returns the jittered delay before retry number failures.
+func backoffDelay(failures int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+	jitter := 1 + backoffJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * jitter)
+}
+
+// wallNow returns the current time without its monotonic reading.
+func wallNow() time.Time {
+	return time.Now().Round(0)
+}
+
+// apiEndpoint validates an advertised API URL and strips any trailing slash.
+// An empty value falls back to the default endpoint.
+func apiEndpoint(raw string) (string, error) {
+	if raw == "" {
+		return defaultAPIEndpoint, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", fmt.Errorf("not an absolute http(s) URL")
+	}
+	return strings.TrimRight(u.String(), "/"), nil
 }
@@ -0,0 +1,93 @@
+package copilot
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		base     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{6, 160 * time.Second},
+		{7, maxBackoff},
+		{100, maxBackoff},
+	}
+	for _, tt := range tests {
+		low := time.Duration(float64(tt.base) * (1 - backoffJitter))
+		high := time.Duration(float64(tt.base) * (1 + backoffJitter))
+		for range 200 {
+			if got := backoffDelay(tt.failures); got < low || got > high {
+				t.Fatalf("backoffDelay(%d) = %v, want within [%v, %v]", tt.failures, got, low, high)
+			}
+		}
+	}
+}
+
+func TestRefreshTime(t *testing.T) {
+	now := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		fetchedAt time.Time
+		refreshIn time.Duration
+		expiresAt time.Time
+		want      time.Time
+	}{
+		{"before refresh_in", now, 25 * time.Minute, now.Add(30 * time.Minute), now.Add(24 * time.Minute)},
+		{"without expiry", now, 25 * time.Minute, time.Time{}, now.Add(24 * time.Minute)},
+		{"capped by expires_at", now, 25 * time.Minute, now.Add(10 * time.Minute), now.Add(9 * time.Minute)},
+		{"relative to fetch time", now.Add(-20 * time.Minute), 25 * time.Minute, now.Add(10 * time.Minute), now.Add(4 * time.Minute)},
+		{"no sooner than the minimum interval", now, 0, now.Add(30 * time.Minute), now.Add(minRefreshInterval)},
+		{"already expired", now.Add(-time.Hour), 25 * time.Minute, now.Add(-30 * time.Minute), now.Add(minRefreshInterval)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshTime(now, tt.fetchedAt, tt.refreshIn, tt.expiresAt); !got.Equal(tt.want) {
+				t.Errorf("refreshTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeClock lets the wall clock and the monotonic clock move independently.
+type fakeClock struct {
+	wall time.Time
+	mono time.Duration
+}
+
+func (c *fakeClock) Wall() time.Time          { return c.wall }
+func (c *fakeClock) Monotonic() time.Duration { return c.mono }
+
+func TestRefreshReasonDetectsClockJumps(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)}
+	watch := newDriftWatch(clock)
+	tm := NewStaticTokenManager("a", "token", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	// Due after the jumps below have moved the wall clock ahead by an hour.
+	tm.nextRefreshAt = clock.wall.Add(time.Hour + 10*time.Minute)
+
+	steps := []struct {
+		name       string
+		wall, mono time.Duration
+		want       string
+	}{
+		{"clocks agree", checkInterval, checkInterval, ""},
+		{"small drift", checkInterval + 5*time.Second, checkInterval, ""},
+		{"resumed from sleep", 2 * time.Hour, checkInterval, "clock jump"},
+		{"clock set back", -time.Hour, checkInterval, "clock jump"},
+		{"clocks agree again", checkInterval, checkInterval, ""},
+		{"refresh due", 20 * time.Minute, 20 * time.Minute, "scheduled"},
+	}
+	for _, step := range steps {
+		clock.wall = clock.wall.Add(step.wall)
+		clock.mono += step.mono
+		if got := tm.refreshReason(watch.check()); got != step.want {
+			t.Fatalf("%s: refreshReason = %q, want %q", step.name, got, step.want)
+		}
+	}
+}
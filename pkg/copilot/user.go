@@ -0,0 +1,94 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Quota identifiers reported by copilot_internal/user.
+const (
+	QuotaChat                = "chat"
+	QuotaCompletions         = "completions"
+	QuotaPremiumInteractions = "premium_interactions"
+)
+
+// QuotaSnapshot is the allowance left on one Copilot quota.
+type QuotaSnapshot struct {
+	Entitlement      float64 `json:"entitlement"`
+	Remaining        float64 `json:"remaining"`
+	PercentRemaining float64 `json:"percent_remaining"`
+	Unlimited        bool    `json:"unlimited"`
+	OverageCount     float64 `json:"overage_count"`
+	OveragePermitted bool    `json:"overage_permitted"`
+}
+
+// UserInfo is the response of the copilot_internal/user endpoint: the
+// user's plan and what is left of its quotas this period.
+type UserInfo struct {
+	Login          string                   `json:"login"`
+	Plan           string                   `json:"copilot_plan"`
+	AccessTypeSKU  string                   `json:"access_type_sku"`
+	ChatEnabled    bool                     `json:"chat_enabled"`
+	QuotaResetDate string                   `json:"quota_reset_date"`
+	QuotaSnapshots map[string]QuotaSnapshot `json:"quota_snapshots"`
+
+	// The free plan reports its quotas as plain counts instead of
+	// snapshots: what is left in LimitedUserQuotas and the monthly
+	// allowance in MonthlyQuotas.
+	LimitedUserQuotas    map[string]float64 `json:"limited_user_quotas"`
+	MonthlyQuotas        map[string]float64 `json:"monthly_quotas"`
+	LimitedUserResetDate string             `json:"limited_user_reset_date"`
+}
+
+// Quotas returns the user's quotas by identifier, converting the free
+// plan's counts into snapshots.
+func (u *UserInfo) Quotas() map[string]QuotaSnapshot {
+	if len(u.QuotaSnapshots) > 0 {
+		return u.QuotaSnapshots
+	}
+	quotas := make(map[string]QuotaSnapshot, len(u.MonthlyQuotas))
+	for id, entitlement := range u.MonthlyQuotas {
+		snapshot := QuotaSnapshot{Entitlement: entitlement, Remaining: u.LimitedUserQuotas[id]}
+		if entitlement > 0 {
+			snapshot.PercentRemaining = snapshot.Remaining / entitlement * 100
+		}
+		quotas[id] = snapshot
+	}
+	return quotas
+}
+
+// ResetDate returns the date the quotas next reset, as YYYY-MM-DD.
+func (u *UserInfo) ResetDate() string {
+	if u.QuotaResetDate != "" {
+		return u.QuotaResetDate
+	}
+	return u.LimitedUserResetDate
+}
+
+// GetCopilotUser fetches the Copilot plan and quotas of the owner of a
+// GitHub OAuth token.
+func GetCopilotUser(ctx context.Context, host GitHubHost, githubToken string) (*UserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host.APIURL+"/copilot_internal/user", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Copilot user request: %w", err)
+	}
+	setGitHubHeaders(req, githubToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute Copilot user request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Copilot user request failed with status: %s", resp.Status)
+	}
+
+	var user UserInfo
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode Copilot user response: %w", err)
+	}
+	return &user, nil
+}
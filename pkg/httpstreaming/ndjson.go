@@ -0,0 +1,23 @@
+package httpstreaming
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// WriteJSONLine marshals v and writes it to w as a single newline-delimited
+// JSON record, flushing immediately.
+func WriteJSONLine(w http.ResponseWriter, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package httpstreaming
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Transform rewrites the data payload of one event on its way to the
+// client. It returns the payload to forward, which may be data itself, or
+// nil to drop the event. A transform error ends the stream.
+type Transform func(data []byte) ([]byte, error)
+
+// Observe returns a transform that calls fn with each payload and forwards
+// it unchanged.
+func Observe(fn func(data []byte)) Transform {
+	return func(data []byte) ([]byte, error) {
+		fn(data)
+		return data, nil
+	}
+}
+
+// Stream reads an upstream event stream one event at a time, records its
+// Stats and passes each data payload through a pipeline of transforms. The
+// "[DONE]" terminator ends the stream and is not passed to the transforms.
+type Stream struct {
+	events     *EventReader
+	transforms []Transform
+	stats      Stats
+	start      time.Time
+	done       bool
+}
+
+// NewStream creates a stream over the events in r. Latencies in its Stats
+// are measured from now.
+func NewStream(r io.Reader, transforms ...Transform) *Stream {
+	return &Stream{
+		events:     NewEventReader(r),
+		transforms: transforms,
+		start:      time.Now(),
+	}
+}
+
+// Use appends transforms to the pipeline. They run in the order added.
+func (s *Stream) Use(transforms ...Transform) {
+	s.transforms = append(s.transforms, transforms...)
+}
+
+// Stats returns what the stream has seen so far.
+func (s *Stream) Stats() Stats {
+	return s.stats
+}
+
+// Next returns the next event after the transforms, skipping dropped
+// events. It returns io.EOF after the "[DONE]" event or at the end of the
+// upstream stream, whichever comes first.
+func (s *Stream) Next() (Event, error) {
+	for !s.done {
+		ev, err := s.events.Next()
+		if err != nil {
+			return Event{}, err
+		}
+		if ev.IsDone() {
+			s.done = true
+			s.stats.Done = true
+			break
+		}
+		s.stats.observe(ev.Data, time.Since(s.start))
+
+		data := ev.Data
+		for _, transform := range s.transforms {
+			if data, err = transform(data); err != nil {
+				return Event{}, fmt.Errorf("stream transform: %w", err)
+			}
+			if data == nil {
+				break
+			}
+		}
+		if data == nil {
+			continue
+		}
+		ev.Data = data
+		return ev, nil
+	}
+	return Event{}, io.EOF
+}
+
+// Each calls fn with the data payload of every event until the end of the
+// stream or until fn returns an error.
+func (s *Stream) Each(fn func(data []byte) error) error {
+	for {
+		ev, err := s.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ev.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// Relay writes the stream to w, flushing once per complete event, and
+// finishes with "[DONE]" if the upstream stream did. If reading upstream
+// fails, the client gets an error event before the stream ends. The
+// returned error wraps ErrClientWrite when the client went away.
+func (s *Stream) Relay(w http.ResponseWriter) error {
+	for {
+		ev, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeStreamError(w, err)
+			return err
+		}
+		if err := writeEvent(w, ev); err != nil {
+			return fmt.Errorf("%w: %w", ErrClientWrite, err)
+		}
+	}
+	if s.done {
+		if err := WriteDone(w); err != nil {
+			return fmt.Errorf("%w: %w", ErrClientWrite, err)
+		}
+	}
+	return nil
+}
+
+// ErrClientWrite marks a Relay error caused by writing to the client.
+var ErrClientWrite = errors.New("failed to write to client")
@@ -0,0 +1,134 @@
+package httpstreaming
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// doneSentinel is the data payload OpenAI-style streams send as their last event.
+var doneSentinel = []byte("[DONE]")
+
+// Event is one server-sent event. Data holds the data fields joined with
+// newlines; Name and ID are empty unless the event set them.
+type Event struct {
+	Name string
+	ID   string
+	Data []byte
+}
+
+// IsDone reports whether e is the OpenAI-style "[DONE]" terminator.
+func (e Event) IsDone() bool {
+	return bytes.Equal(e.Data, doneSentinel)
+}
+
+// EventReader parses a server-sent event stream line by line.
+type EventReader struct {
+	reader *bufio.Reader
+}
+
+// NewEventReader creates a reader for the event stream in r.
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next event that carries data. Comments, retry fields and
+// events without data are skipped. At the end of the stream Next returns
+// io.EOF; an event cut off by the end of the stream is still returned first.
+func (er *EventReader) Next() (Event, error) {
+	var ev Event
+	hasData := false
+	for {
+		line, err := er.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+			if len(line) == 0 {
+				if hasData {
+					return ev, nil
+				}
+				ev = Event{}
+			} else {
+				field, value, _ := bytes.Cut(line, []byte(":"))
+				value = bytes.TrimPrefix(value, []byte(" "))
+				switch string(field) {
+				case "data":
+					if hasData {
+						ev.Data = append(ev.Data, '\n')
+					}
+					ev.Data = append(ev.Data, value...)
+					hasData = true
+				case "event":
+					ev.Name = string(value)
+				case "id":
+					ev.ID = string(value)
+				}
+			}
+		}
+		if err == io.EOF && hasData {
+			return ev, nil
+		}
+		if err != nil {
+			return Event{}, err
+		}
+	}
+}
+
+// ReadEvents reads a server-sent event stream and calls fn with the data
+// payload of every event. Multi-line data fields are joined with newlines.
+// Reading stops at EOF, at a "[DONE]" event, or when fn returns an error.
+func ReadEvents(r io.Reader, fn func(data []byte) error) error {
+	return NewStream(r).Each(fn)
+}
+
+// writeEvent writes ev to w as a single server-sent event and flushes it.
+func writeEvent(w http.ResponseWriter, ev Event) error {
+	var buf bytes.Buffer
+	if ev.Name != "" {
+		buf.WriteString("event: " + ev.Name + "\n")
+	}
+	if ev.ID != "" {
+		buf.WriteString("id: " + ev.ID + "\n")
+	}
+	for line := range bytes.SplitSeq(ev.Data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// WriteEvent marshals payload as JSON and writes it to w as a single
+// server-sent event, flushing immediately. An empty event name omits the
+// event field.
+func WriteEvent(w http.ResponseWriter, event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+	return writeEvent(w, Event{Name: event, Data: data})
+}
+
+// WriteDone writes the OpenAI-style "[DONE]" terminator event.
+func WriteDone(w http.ResponseWriter) error {
+	return writeEvent(w, Event{Data: doneSentinel})
+}
+
+// PrepareStream sets the standard headers for a server-sent event response
+// and writes the status line.
+func PrepareStream(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,74 @@
+package httpstreaming
+
+import (
+	"encoding/json"
+	"time"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// Stats summarises a chat completions event stream.
+type Stats struct {
+	// Chunks is the number of data events, not counting "[DONE]".
+	Chunks int
+	// FirstToken is the time until the first chunk carrying content or a
+	// tool call, or zero if none did.
+	FirstToken time.Duration
+	// FinishReason is the last finish reason reported by a choice.
+	FinishReason string
+	// Usage is the token usage reported by the stream, if any.
+	Usage *openai.Usage
+	// Done reports whether the stream ended with "[DONE]".
+	Done bool
+}
+
+// observe records one data payload received elapsed after the stream
+// started. Payloads that are not chat completion chunks are only counted.
+func (s *Stats) observe(data []byte, elapsed time.Duration) {
+	s.Chunks++
+
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content   string            `json:"content"`
+				ToolCalls []json.RawMessage `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *openai.Usage `json:"usage"`
+	}
+	if json.Unmarshal(data, &chunk) != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		if s.FirstToken == 0 && (choice.Delta.Content != "" || len(choice.Delta.ToolCalls) > 0) {
+			s.FirstToken = elapsed
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.FinishReason = *choice.FinishReason
+		}
+	}
+	if chunk.Usage != nil {
+		s.Usage = chunk.Usage
+	}
+}
+
+// observeBody records a complete chat completions response. Bodies that
+// are not chat completions leave the stats empty.
+func (s *Stats) observeBody(data []byte) {
+	var resp struct {
+		Choices []struct {
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *openai.Usage `json:"usage"`
+	}
+	if json.Unmarshal(data, &resp) != nil {
+		return
+	}
+	for _, choice := range resp.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.FinishReason = *choice.FinishReason
+		}
+	}
+	s.Usage = resp.Usage
+}
@@ -1,46 +1,137 @@
 package httpstreaming
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+
+	"copilot-api-proxy/pkg/openai"
 )
 
+// maxCapturedBody bounds how much of a JSON response is kept to read its
+// usage.
+const maxCapturedBody = 8 << 20
+
 // StreamResponse copies headers and streams the body from an upstream response
-// to the client's response writer, flushing chunks as they arrive.
-func StreamResponse(w http.ResponseWriter, upstreamResp *http.Response, logger *slog.Logger) {
+// to the client's response writer. Event streams are relayed event by event
+// through transforms and summarised in the returned Stats; other bodies are
+// copied as they arrive, and JSON bodies are summarised once complete. Only
+// SSE and NDJSON bodies are counted in the stream metrics.
+func StreamResponse(w http.ResponseWriter, upstreamResp *http.Response, logger *slog.Logger, transforms ...Transform) Stats {
+	contentType := upstreamResp.Header.Get("Content-Type")
+	sse := strings.HasPrefix(contentType, "text/event-stream")
+	if sse || strings.HasPrefix(contentType, "application/x-ndjson") {
+		ctx := context.Background()
+		if upstreamResp.Request != nil {
+			ctx = upstreamResp.Request.Context()
+		}
+		tracked, done := TrackStream(ctx, w)
+		defer done()
+		w = tracked
+	}
+
 	// Copy headers from the upstream response to our response writer.
 	for key, values := range upstreamResp.Header {
 		for _, value := range values {
 			w.Header().Add(key, value)
 		}
 	}
+	if sse {
+		// Events are relayed as decoded text and transforms may change
+		// the length of the body.
+		w.Header().Del("Content-Encoding")
+		w.Header().Del("Content-Length")
+	}
 	w.WriteHeader(upstreamResp.StatusCode)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		logger.Warn("Response writer does not support flushing. Streaming may not be real-time.")
-		io.Copy(w, upstreamResp.Body)
-		return
 	}
 
-	// Stream the body, flushing after each write.
+	if sse {
+		stream := NewStream(upstreamResp.Body, transforms...)
+		if err := stream.Relay(w); err != nil {
+			if errors.Is(err, ErrClientWrite) {
+				logger.Error("Failed to write event to client", "error", err)
+			} else {
+				logger.Error("Error reading from upstream stream", "error", err)
+			}
+		}
+		return stream.Stats()
+	}
+
+	var body io.Reader = upstreamResp.Body
+	var captured *cappedBuffer
+	if strings.HasPrefix(contentType, "application/json") {
+		captured = &cappedBuffer{limit: maxCapturedBody}
+		body = io.TeeReader(body, captured)
+	}
+	if ok {
+		copyFlushing(w, flusher, body, logger)
+	} else {
+		io.Copy(w, body)
+	}
+
+	var stats Stats
+	if captured != nil && !captured.truncated {
+		stats.observeBody(captured.Bytes())
+	}
+	return stats
+}
+
+// copyFlushing copies body to w, flushing after each write.
+func copyFlushing(w io.Writer, flusher http.Flusher, body io.Reader, logger *slog.Logger) {
 	buf := make([]byte, 32*1024) // 32KB buffer
 	for {
-		n, err := upstreamResp.Body.Read(buf)
+		n, err := body.Read(buf)
 		if n > 0 {
 			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
 				logger.Error("Failed to write chunk to client", "error", writeErr)
-				break
+				return
 			}
 			flusher.Flush()
 		}
 		if err == io.EOF {
-			break
+			return
 		}
 		if err != nil {
 			logger.Error("Error reading from upstream body", "error", err)
-			break
+			return
 		}
 	}
 }
+
+// cappedBuffer keeps the first limit bytes written to it and notes whether
+// more were discarded.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// writeStreamError ends an interrupted event stream with an OpenAI-style
+// error event, so clients see why it stopped instead of a truncated body.
+func writeStreamError(w http.ResponseWriter, err error) {
+	code := "upstream_error"
+	message := "Upstream stream interrupted"
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		code = "upstream_timeout"
+		message = "Upstream stream timed out: " + err.Error()
+	}
+	WriteEvent(w, "", openai.ErrorResponse{Error: openai.Error{Message: message, Type: "server_error", Code: code}})
+}
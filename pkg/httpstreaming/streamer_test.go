@@ -0,0 +1,75 @@
+package httpstreaming
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"copilot-api-proxy/pkg/metrics"
+)
+
+func TestStreamResponseDropsEncodingOfTransformedEvents(t *testing.T) {
+	body := "data: {\"id\":\"1\"}\n\ndata: [DONE]\n\n"
+	upstream := &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type":     {"text/event-stream"},
+			"Content-Encoding": {"gzip"},
+			"Content-Length":   {"36"},
+		},
+		Body: io.NopCloser(strings.NewReader(body)),
+	}
+	rec := httptest.NewRecorder()
+	upper := func(data []byte) ([]byte, error) { return bytes.ToUpper(data), nil }
+
+	StreamResponse(rec, upstream, slog.New(slog.NewTextHandler(io.Discard, nil)), upper)
+
+	for _, header := range []string{"Content-Encoding", "Content-Length"} {
+		if value := rec.Header().Get(header); value != "" {
+			t.Errorf("%s = %q, want it dropped", header, value)
+		}
+	}
+	if !strings.Contains(rec.Body.String(), `{"ID":"1"}`) {
+		t.Errorf("body = %q, want the transformed event", rec.Body.String())
+	}
+}
+
+func TestStreamResponseCountsOnlyStreamsInMetrics(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		stream      bool
+	}{
+		{"text/event-stream", "data: {}\n\ndata: [DONE]\n\n", true},
+		{"application/x-ndjson", "{}\n{}\n", true},
+		{"application/json", `{"object":"list"}`, false},
+		{"text/plain", "not found", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			route := "test " + tt.contentType
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req = req.WithContext(metrics.WithRequestInfo(req.Context(), &metrics.RequestInfo{Route: route}))
+			upstream := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {tt.contentType}},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+				Request:    req,
+			}
+			StreamResponse(httptest.NewRecorder(), upstream, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			var exposition strings.Builder
+			if err := metrics.Default.Write(&exposition); err != nil {
+				t.Fatal(err)
+			}
+			series := `copilot_proxy_stream_duration_seconds_count{route="` + route + `"} 1`
+			if got := strings.Contains(exposition.String(), series); got != tt.stream {
+				t.Errorf("counted as a stream = %v, want %v", got, tt.stream)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package httpstreaming
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"copilot-api-proxy/pkg/metrics"
+	"copilot-api-proxy/pkg/tracing"
+)
+
+// trackedWriter counts the bytes written to a streamed response and ends
+// the first chunk span on the first write.
+type trackedWriter struct {
+	http.ResponseWriter
+	bytes      int64
+	firstChunk *tracing.Span
+}
+
+func (t *trackedWriter) Write(p []byte) (int, error) {
+	if t.bytes == 0 && len(p) > 0 {
+		t.firstChunk.End()
+	}
+	n, err := t.ResponseWriter.Write(p)
+	t.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer does.
+func (t *trackedWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer.
+func (t *trackedWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// TrackStream records a streamed response in the stream metrics and spans
+// of the request in ctx. Write the stream to the returned writer and call
+// done when it ends.
+func TrackStream(ctx context.Context, w http.ResponseWriter) (http.ResponseWriter, func()) {
+	route := metrics.RequestInfoFrom(ctx).Route
+	start := time.Now()
+	metrics.StreamsInFlight.Add(1, route)
+
+	ctx, span := tracing.Start(ctx, "stream response", tracing.KindInternal)
+	_, firstChunk := tracing.Start(ctx, "first chunk", tracing.KindInternal)
+
+	tracked := &trackedWriter{ResponseWriter: w, firstChunk: firstChunk}
+	return tracked, func() {
+		metrics.StreamsInFlight.Add(-1, route)
+		metrics.StreamDuration.Observe(time.Since(start).Seconds(), route)
+		metrics.StreamedBytes.Add(float64(tracked.bytes), route)
+
+		firstChunk.End()
+		span.SetAttributes(tracing.Int("stream.bytes", int(tracked.bytes)))
+		span.End()
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests by route.\nWith a \\ in the help.", "route", "client")
+	streams := r.NewGaugeVec("streams_in_flight", "Streams in flight.")
+	expiry := r.NewGaugeVec("token_expiry_seconds", "Seconds until expiry.", "account")
+	latency := r.NewHistogramVec("latency_seconds", "Upstream latency.", []float64{0.1, 1, 2.5}, "route")
+
+	requests.Inc("/v1/models", "key-b")
+	requests.Add(2, "/v1/chat/completions", `say "hi"\n`+"\n")
+	streams.Add(3)
+	streams.Add(-1)
+	expiry.SetFunc(func() float64 { return 1500 }, "a")
+	latency.Observe(0.05, "/v1/chat/completions")
+	latency.Observe(1, "/v1/chat/completions")
+	latency.Observe(7, "/v1/chat/completions")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests by route.\nWith a \\ in the help.
+# TYPE requests_total counter
+requests_total{route="/v1/chat/completions",client="say \"hi\"\\n\n"} 2
+requests_total{route="/v1/models",client="key-b"} 1
+# HELP streams_in_flight Streams in flight.
+# TYPE streams_in_flight gauge
+streams_in_flight 2
+# HELP token_expiry_seconds Seconds until expiry.
+# TYPE token_expiry_seconds gauge
+token_expiry_seconds{account="a"} 1500
+# HELP latency_seconds Upstream latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/v1/chat/completions",le="0.1"} 1
+latency_seconds_bucket{route="/v1/chat/completions",le="1"} 2
+latency_seconds_bucket{route="/v1/chat/completions",le="2.5"} 2
+latency_seconds_bucket{route="/v1/chat/completions",le="+Inf"} 3
+latency_seconds_sum{route="/v1/chat/completions"} 8.05
+latency_seconds_count{route="/v1/chat/completions"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistryWriteOmitsSeriesNeverObserved(t *testing.T) {
+	r := NewRegistry()
+	r.NewHistogramVec("latency_seconds", "Upstream latency.", []float64{1}, "route")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP latency_seconds Upstream latency.\n# TYPE latency_seconds histogram\n"
+	if got := b.String(); got != want {
+		t.Errorf("exposition = %q, want only the header", got)
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"time"
+)
+
+// Default is the registry the proxy metrics are registered in.
+var Default = NewRegistry()
+
+var (
+	latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	streamBuckets  = []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+)
+
+// Proxy metrics.
+var (
+	Requests = Default.NewCounterVec("copilot_proxy_requests_total",
+		"Requests handled, by route, model, status code and client.",
+		"route", "model", "status", "client")
+	UpstreamLatency = Default.NewHistogramVec("copilot_proxy_upstream_latency_seconds",
+		"Time until Copilot returned response headers.",
+		latencyBuckets, "route", "model")
+	TimeToFirstByte = Default.NewHistogramVec("copilot_proxy_time_to_first_byte_seconds",
+		"Time from receiving a request until the first response byte was written.",
+		latencyBuckets, "route")
+	StreamDuration = Default.NewHistogramVec("copilot_proxy_stream_duration_seconds",
+		"Time spent streaming upstream response bodies to clients.",
+		streamBuckets, "route")
+	StreamedBytes = Default.NewCounterVec("copilot_proxy_streamed_bytes_total",
+		"Response body bytes streamed to clients.",
+		"route")
+	StreamsInFlight = Default.NewGaugeVec("copilot_proxy_streams_in_flight",
+		"Responses currently being streamed to clients.",
+		"route")
+	TokenRefreshes = Default.NewCounterVec("copilot_proxy_token_refreshes_total",
+		"Copilot token refreshes by outcome (success, failure or cached).",
+		"account", "outcome")
+	TokenExpiry = Default.NewGaugeVec("copilot_proxy_token_expiry_seconds",
+		"Seconds until the current Copilot token expires.",
+		"account")
+)
+
+// RequestInfo describes the inbound request a piece of work belongs to. The
+// server attaches it to the request context so code further down, such as
+// the upstream client and the streamer, can label its metrics.
+type RequestInfo struct {
+	Route  string
+	Model  string
+	Client string
+	Start  time.Time
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo attaches info to ctx.
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the request info attached to ctx, or a
+// placeholder for work that does not belong to a client request.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo); ok {
+		return info
+	}
+	return &RequestInfo{Route: "internal", Start: time.Now()}
+}
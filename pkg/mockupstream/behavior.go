@@ -0,0 +1,114 @@
+package mockupstream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BehaviorHeader lets a request script its own response. The proxy forwards
+// client headers upstream, so tests can set it on requests to the proxy.
+const BehaviorHeader = "X-Mock-Behavior"
+
+// Behavior scripts how the mock answers a request. Zero fields mean normal
+// behaviour.
+type Behavior struct {
+	// Path restricts a queued behavior to requests whose path ends with
+	// it. Empty means /chat/completions.
+	Path string `json:"path,omitempty"`
+	// Delay is waited before the response headers are sent.
+	Delay Duration `json:"delay,omitempty"`
+	// Status answers with this error status instead of a normal response.
+	Status int `json:"status,omitempty"`
+	// RetryAfter sets the Retry-After header, in seconds, of an error.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// ChunkDelay is waited between streamed chunks.
+	ChunkDelay Duration `json:"chunk_delay,omitempty"`
+	// Chunks is the number of content chunks in a completion.
+	Chunks int `json:"chunks,omitempty"`
+	// DisconnectAfter drops the connection after this many streamed chunks.
+	DisconnectAfter int `json:"disconnect_after,omitempty"`
+}
+
+// merge returns b with the fields set in o replaced.
+func (b Behavior) merge(o Behavior) Behavior {
+	if o.Delay != 0 {
+		b.Delay = o.Delay
+	}
+	if o.Status != 0 {
+		b.Status = o.Status
+	}
+	if o.RetryAfter != 0 {
+		b.RetryAfter = o.RetryAfter
+	}
+	if o.ChunkDelay != 0 {
+		b.ChunkDelay = o.ChunkDelay
+	}
+	if o.Chunks != 0 {
+		b.Chunks = o.Chunks
+	}
+	if o.DisconnectAfter != 0 {
+		b.DisconnectAfter = o.DisconnectAfter
+	}
+	return b
+}
+
+// ParseBehavior parses the BehaviorHeader form, a comma-separated list
+// such as "status=429,retry_after=5" or "delay=2s,disconnect_after=3".
+func ParseBehavior(value string) (Behavior, error) {
+	var b Behavior
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return Behavior{}, fmt.Errorf("behavior %q must look like key=value", pair)
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "delay":
+			b.Delay, err = parseDuration(raw)
+		case "chunk_delay":
+			b.ChunkDelay, err = parseDuration(raw)
+		case "status":
+			b.Status, err = strconv.Atoi(raw)
+		case "retry_after":
+			b.RetryAfter, err = strconv.Atoi(raw)
+		case "chunks":
+			b.Chunks, err = strconv.Atoi(raw)
+		case "disconnect_after":
+			b.DisconnectAfter, err = strconv.Atoi(raw)
+		case "path":
+			b.Path = raw
+		default:
+			return Behavior{}, fmt.Errorf("unknown behavior %q", key)
+		}
+		if err != nil {
+			return Behavior{}, fmt.Errorf("behavior %s: %w", key, err)
+		}
+	}
+	return b, nil
+}
+
+// Duration is a time.Duration written as a string such as "250ms" in JSON.
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := parseDuration(string(text))
+	*d = parsed
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func parseDuration(s string) (Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	return Duration(d), err
+}
@@ -0,0 +1,61 @@
+package mockupstream
+
+import "copilot-api-proxy/pkg/copilot"
+
+// mockModels is the model list served by /models. It covers the shapes the
+// proxy treats differently: tools and vision, a reasoning model, a model
+// without tool support and an embeddings model.
+var mockModels = []copilot.Model{
+	{
+		ID: "gpt-4.1", Name: "GPT-4.1", Object: "model", Vendor: "Azure OpenAI", Version: "gpt-4.1-2025-04-14",
+		ModelPickerEnabled: true,
+		Capabilities: copilot.ModelCapabilities{
+			Family: "gpt-4.1", Type: "chat", Tokenizer: "o200k_base", Object: "model_capabilities",
+			Limits: copilot.ModelLimits{
+				MaxContextWindowTokens: 128000, MaxOutputTokens: 16384, MaxPromptTokens: 128000,
+				Vision: &copilot.VisionInfo{MaxPromptImages: 1, MaxPromptImageSize: 3145728, SupportedMediaTypes: []string{"image/jpeg", "image/png", "image/webp", "image/gif"}},
+			},
+			Supports: copilot.ModelSupports{ToolCalls: true, ParallelToolCalls: true, Streaming: true, StructuredOutputs: true, Vision: true},
+		},
+		Policy: &copilot.ModelPolicy{State: "enabled"},
+	},
+	{
+		ID: "o3-mini", Name: "o3-mini", Object: "model", Vendor: "Azure OpenAI", Version: "o3-mini-2025-01-31",
+		ModelPickerEnabled: true,
+		Capabilities: copilot.ModelCapabilities{
+			Family: "o3-mini", Type: "chat", Tokenizer: "o200k_base", Object: "model_capabilities",
+			Limits:   copilot.ModelLimits{MaxContextWindowTokens: 200000, MaxOutputTokens: 100000, MaxPromptTokens: 64000},
+			Supports: copilot.ModelSupports{ToolCalls: true, Streaming: true, StructuredOutputs: true},
+		},
+		Policy: &copilot.ModelPolicy{State: "enabled"},
+	},
+	{
+		ID: "claude-sonnet-4", Name: "Claude Sonnet 4", Object: "model", Vendor: "Anthropic", Version: "claude-sonnet-4",
+		ModelPickerEnabled: true, Preview: true,
+		Capabilities: copilot.ModelCapabilities{
+			Family: "claude-sonnet-4", Type: "chat", Tokenizer: "o200k_base", Object: "model_capabilities",
+			Limits: copilot.ModelLimits{
+				MaxContextWindowTokens: 80000, MaxOutputTokens: 16000, MaxPromptTokens: 80000,
+				Vision: &copilot.VisionInfo{MaxPromptImages: 1, MaxPromptImageSize: 3145728, SupportedMediaTypes: []string{"image/jpeg", "image/png", "image/webp"}},
+			},
+			Supports: copilot.ModelSupports{ToolCalls: true, ParallelToolCalls: true, Streaming: true, Vision: true},
+		},
+		Policy: &copilot.ModelPolicy{State: "enabled"},
+	},
+	{
+		ID: "gpt-3.5-turbo", Name: "GPT 3.5 Turbo", Object: "model", Vendor: "Azure OpenAI", Version: "gpt-3.5-turbo-0613",
+		Capabilities: copilot.ModelCapabilities{
+			Family: "gpt-3.5-turbo", Type: "chat", Tokenizer: "cl100k_base", Object: "model_capabilities",
+			Limits:   copilot.ModelLimits{MaxContextWindowTokens: 16384, MaxOutputTokens: 4096, MaxPromptTokens: 12288},
+			Supports: copilot.ModelSupports{Streaming: true},
+		},
+	},
+	{
+		ID: "text-embedding-3-small", Name: "Embedding V3 small", Object: "model", Vendor: "Azure OpenAI", Version: "text-embedding-3-small",
+		Capabilities: copilot.ModelCapabilities{
+			Family: "text-embedding-3-small", Type: "embeddings", Tokenizer: "cl100k_base", Object: "model_capabilities",
+			Limits:   copilot.ModelLimits{MaxInputs: 512},
+			Supports: copilot.ModelSupports{Dimensions: true},
+		},
+	},
+}
@@ -0,0 +1,456 @@
+// Package mockupstream is a stand-in for GitHub and the Copilot API. It
+// implements the device flow, the Copilot token exchange and quotas, /models
+// and /chat/completions with scripted delays, errors and disconnects, so the
+// proxy can be run and tested without network access or a Copilot seat.
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/openai"
+)
+
+// Credentials handed out by the mock.
+const (
+	DeviceCode  = "mock-device-code"
+	UserCode    = "MOCK-0000"
+	GitHubToken = "gho_mock"
+)
+
+// Options configures a Server.
+type Options struct {
+	// BaseURL is the URL the server is reachable at. It is advertised as
+	// the Copilot API endpoint and device verification URI.
+	BaseURL string
+	// TokenTTL is the lifetime of issued Copilot tokens.
+	TokenTTL time.Duration
+	// PendingPolls is how many access token polls answer
+	// "authorization_pending" before the token is issued.
+	PendingPolls int
+	// Default applies to every chat completion unless overridden.
+	Default Behavior
+}
+
+// Server is the mock upstream. It is an http.Handler.
+type Server struct {
+	opts   Options
+	logger *slog.Logger
+	mux    *http.ServeMux
+
+	mu         sync.Mutex
+	polls      int
+	tokens     map[string]time.Time
+	issued     int
+	completion int
+	queue      []Behavior
+}
+
+// New creates a mock upstream.
+func New(opts Options, logger *slog.Logger) *Server {
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = 30 * time.Minute
+	}
+	s := &Server{opts: opts, logger: logger, mux: http.NewServeMux(), tokens: make(map[string]time.Time)}
+
+	s.mux.HandleFunc("POST /login/device/code", s.deviceCode)
+	s.mux.HandleFunc("POST /login/oauth/access_token", s.accessToken)
+	// GitHub Enterprise Server serves the API under /api/v3, which is where
+	// the proxy looks when given a plain host.
+	for _, prefix := range []string{"", "/api/v3"} {
+		s.mux.HandleFunc("GET "+prefix+"/copilot_internal/v2/token", s.exchangeToken)
+		s.mux.HandleFunc("GET "+prefix+"/copilot_internal/user", s.user)
+	}
+	s.mux.HandleFunc("GET /models", s.models)
+	s.mux.HandleFunc("POST /chat/completions", s.chatCompletions)
+	s.mux.HandleFunc("POST /_mock/behaviors", s.enqueueBehaviors)
+	s.mux.HandleFunc("POST /_mock/revoke", s.revokeTokens)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.logger.Debug("Mock upstream request", "method", r.Method, "path", r.URL.Path)
+	s.mux.ServeHTTP(w, r)
+}
+
+// Enqueue schedules one-shot behaviors, each used by the next matching
+// request.
+func (s *Server) Enqueue(behaviors ...Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, behaviors...)
+}
+
+// RevokeTokens invalidates every issued Copilot token, so the next request
+// gets a 401 and the client has to exchange its GitHub token again.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.tokens)
+}
+
+// behaviorFor combines the default, the first queued behavior for the
+// request path and the request's BehaviorHeader.
+func (s *Server) behaviorFor(r *http.Request) (Behavior, error) {
+	b := s.opts.Default
+
+	s.mu.Lock()
+	for i, queued := range s.queue {
+		path := queued.Path
+		if path == "" {
+			path = "/chat/completions"
+		}
+		if strings.HasSuffix(r.URL.Path, path) {
+			b = b.merge(queued)
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if header := r.Header.Get(BehaviorHeader); header != "" {
+		override, err := ParseBehavior(header)
+		if err != nil {
+			return Behavior{}, err
+		}
+		b = b.merge(override)
+	}
+	return b, nil
+}
+
+// apply waits out the behavior's delay and writes its error status, if
+// any. It reports whether the request has been answered.
+func (s *Server) apply(w http.ResponseWriter, r *http.Request) (Behavior, bool) {
+	b, err := s.behaviorFor(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return b, true
+	}
+	if !sleep(r, time.Duration(b.Delay)) {
+		return b, true
+	}
+	if b.Status != 0 {
+		if b.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(b.RetryAfter))
+		}
+		writeError(w, b.Status, fmt.Sprintf("mock upstream scripted status %d", b.Status))
+		return b, true
+	}
+	return b, false
+}
+
+func (s *Server) deviceCode(w http.ResponseWriter, r *http.Request) {
+	if _, done := s.apply(w, r); done {
+		return
+	}
+	s.mu.Lock()
+	s.polls = 0
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, copilot.DeviceCodeResponse{
+		DeviceCode:      DeviceCode,
+		UserCode:        UserCode,
+		VerificationURI: s.opts.BaseURL + "/login/device",
+		ExpiresIn:       900,
+		Interval:        1,
+	})
+}
+
+func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
+	if _, done := s.apply(w, r); done {
+		return
+	}
+	s.mu.Lock()
+	s.polls++
+	pending := s.polls <= s.opts.PendingPolls
+	s.mu.Unlock()
+
+	if pending {
+		writeJSON(w, http.StatusOK, copilot.AccessTokenResponse{Error: "authorization_pending"})
+		return
+	}
+	writeJSON(w, http.StatusOK, copilot.AccessTokenResponse{AccessToken: GitHubToken, TokenType: "bearer", Scope: "read:user"})
+}
+
+func (s *Server) exchangeToken(w http.ResponseWriter, r *http.Request) {
+	if _, done := s.apply(w, r); done {
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "token ") {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.opts.TokenTTL)
+	s.mu.Lock()
+	s.issued++
+	token := fmt.Sprintf("mock-copilot-token-%d", s.issued)
+	s.tokens[token] = expiresAt
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, copilot.ExchangeTokenResponse{
+		Token:       token,
+		ExpiresAt:   expiresAt.Unix(),
+		RefreshIn:   int64(s.opts.TokenTTL.Seconds() * 0.8),
+		Endpoints:   copilot.Endpoints{API: s.opts.BaseURL},
+		SKU:         "mock_monthly_subscriber",
+		ChatEnabled: true,
+		Individual:  true,
+	})
+}
+
+// premiumEntitlement is the monthly premium request allowance of the mock
+// user. Each chat completion served uses one.
+const premiumEntitlement = 300
+
+func (s *Server) user(w http.ResponseWriter, r *http.Request) {
+	if _, done := s.apply(w, r); done {
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "token ") {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	s.mu.Lock()
+	remaining := float64(max(0, premiumEntitlement-s.completion))
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	writeJSON(w, http.StatusOK, copilot.UserInfo{
+		Login:          "mock",
+		Plan:           "individual",
+		AccessTypeSKU:  "mock_monthly_subscriber",
+		ChatEnabled:    true,
+		QuotaResetDate: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC).Format(time.DateOnly),
+		QuotaSnapshots: map[string]copilot.QuotaSnapshot{
+			copilot.QuotaChat:        {Unlimited: true, PercentRemaining: 100},
+			copilot.QuotaCompletions: {Unlimited: true, PercentRemaining: 100},
+			copilot.QuotaPremiumInteractions: {
+				Entitlement:      premiumEntitlement,
+				Remaining:        remaining,
+				PercentRemaining: remaining / premiumEntitlement * 100,
+			},
+		},
+	})
+}
+
+// authorized checks the Copilot token of a request, answering 401 if it
+// was not issued by this server or has expired or been revoked.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	expiresAt, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok || time.Now().After(expiresAt) {
+		writeError(w, http.StatusUnauthorized, "unauthorized: token expired")
+		return false
+	}
+	return true
+}
+
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	if _, done := s.apply(w, r); done {
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, copilot.ModelsResponse{Object: "list", Data: mockModels})
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	b, done := s.apply(w, r)
+	if done {
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	s.mu.Lock()
+	s.completion++
+	id := fmt.Sprintf("chatcmpl-mock-%d", s.completion)
+	s.mu.Unlock()
+
+	words := replyWords(req, b.Chunks)
+	usage := &openai.Usage{PromptTokens: promptTokens(req), CompletionTokens: len(words)}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	if !req.Stream {
+		writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+			Choices: []openai.Choice{{Message: openai.ResponseMessage{Role: "assistant", Content: strings.Join(words, "")}, FinishReason: "stop"}},
+			Usage:   usage,
+		})
+		return
+	}
+	s.stream(w, r, b, id, req, words, usage)
+}
+
+// stream writes the reply as server-sent events, one word per chunk.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, b Behavior, id string, req openai.ChatCompletionRequest, words []string, usage *openai.Usage) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	chunk := openai.ChatCompletionChunk{ID: id, Object: "chat.completion.chunk", Created: time.Now().Unix(), Model: req.Model}
+	send := func(c openai.ChatCompletionChunk) {
+		data, _ := json.Marshal(c)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for i, word := range words {
+		if b.DisconnectAfter > 0 && i == b.DisconnectAfter {
+			// Drop the connection without finishing the response.
+			panic(http.ErrAbortHandler)
+		}
+		if i > 0 && !sleep(r, time.Duration(b.ChunkDelay)) {
+			return
+		}
+		delta := openai.Delta{Content: word}
+		if i == 0 {
+			delta.Role = "assistant"
+		}
+		chunk.Choices = []openai.ChunkChoice{{Delta: delta}}
+		send(chunk)
+	}
+
+	stop := "stop"
+	chunk.Choices = []openai.ChunkChoice{{Delta: openai.Delta{}, FinishReason: &stop}}
+	send(chunk)
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		chunk.Choices = []openai.ChunkChoice{}
+		chunk.Usage = usage
+		send(chunk)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// enqueueBehaviors accepts a behavior or a list of them as JSON.
+func (s *Server) enqueueBehaviors(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var behaviors []Behavior
+	if err := json.Unmarshal(raw, &behaviors); err != nil {
+		var single Behavior
+		if err := json.Unmarshal(raw, &single); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		behaviors = []Behavior{single}
+	}
+	s.Enqueue(behaviors...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) revokeTokens(w http.ResponseWriter, r *http.Request) {
+	s.RevokeTokens()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replyWords builds the reply: an echo of the last user message, or n
+// numbered words if n is set. Each word is one streamed chunk.
+func replyWords(req openai.ChatCompletionRequest, n int) []string {
+	if n > 0 {
+		words := make([]string, n)
+		for i := range words {
+			words[i] = fmt.Sprintf("word%d ", i+1)
+		}
+		return words
+	}
+	prompt := ""
+	for _, msg := range req.Messages {
+		if msg.Role == "user" {
+			prompt = messageText(msg)
+		}
+	}
+	fields := strings.Fields("Mock reply to: " + prompt)
+	words := make([]string, len(fields))
+	for i, field := range fields {
+		if i > 0 {
+			field = " " + field
+		}
+		words[i] = field
+	}
+	return words
+}
+
+// promptTokens estimates the prompt size as one token per word.
+func promptTokens(req openai.ChatCompletionRequest) int {
+	n := 0
+	for _, msg := range req.Messages {
+		n += len(strings.Fields(messageText(msg)))
+	}
+	return n
+}
+
+func messageText(msg openai.Message) string {
+	switch content := msg.Content.(type) {
+	case string:
+		return content
+	case []any:
+		var parts []string
+		for _, part := range content {
+			if p, ok := part.(map[string]any); ok && p["type"] == "text" {
+				text, _ := p["text"].(string)
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	return ""
+}
+
+// sleep waits for d or until the request is canceled, reporting whether
+// the full duration passed.
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, openai.ErrorResponse{Error: openai.Error{Message: message, Type: "mock_error", Code: status}})
+}
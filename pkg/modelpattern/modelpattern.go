@@ -0,0 +1,26 @@
+// Package modelpattern matches model IDs against configured patterns. A
+// pattern is a model ID or a prefix ending in "*", such as "claude-opus-4*".
+package modelpattern
+
+import "strings"
+
+// Lookup returns the value of the pattern in patterns that matches model.
+// When several match, the longest pattern wins, so "o3-mini*" beats "o3*".
+// ok is false if nothing matches.
+func Lookup[V any](patterns map[string]V, model string) (value V, ok bool) {
+	bestLen := -1
+	for pattern, v := range patterns {
+		if Match(pattern, model) && len(pattern) > bestLen {
+			value, ok, bestLen = v, true, len(pattern)
+		}
+	}
+	return value, ok
+}
+
+// Match reports whether pattern matches model.
+func Match(pattern, model string) bool {
+	if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard {
+		return strings.HasPrefix(model, prefix)
+	}
+	return pattern == model
+}
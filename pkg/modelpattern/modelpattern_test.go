@@ -0,0 +1,33 @@
+package modelpattern
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	patterns := map[string]int{
+		"o3*":      1,
+		"o3-mini*": 2,
+		"o3-pro":   3,
+		"*":        4,
+	}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"o3", 1},
+		{"o3-pro-high", 1},
+		{"o3-mini-high", 2},
+		{"o3-pro", 3},
+		{"gpt-4.1", 4},
+	}
+	for _, tt := range tests {
+		if got, ok := Lookup(patterns, tt.model); !ok || got != tt.want {
+			t.Errorf("Lookup(%q) = %d, %v; want %d", tt.model, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLookupNoMatch(t *testing.T) {
+	if got, ok := Lookup(map[string]int{"o3*": 1, "gpt-4o": 2}, "gpt-4o-mini"); ok {
+		t.Errorf("Lookup matched with value %d, want no match", got)
+	}
+}
@@ -0,0 +1,160 @@
+// Package models keeps track of the models the proxy serves: a cached
+// registry of the Copilot models and the aliases and virtual models that
+// map client model names onto them.
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// Preset is a virtual model: a real model plus request defaults. Defaults
+// only fill in fields the client left out.
+type Preset struct {
+	Model        string
+	Description  string
+	Temperature  *float64
+	MaxTokens    *int
+	SystemPrompt string
+}
+
+// Resolution describes how a requested model was rewritten.
+type Resolution struct {
+	Requested string
+	Model     string
+	Preset    string
+}
+
+// Rewritten reports whether the model name was changed.
+func (r Resolution) Rewritten() bool {
+	return r.Model != r.Requested
+}
+
+// Table holds the alias and preset definitions. It is safe for concurrent
+// use and can be replaced at runtime with Set.
+type Table struct {
+	mu      sync.RWMutex
+	aliases map[string]string
+	presets map[string]Preset
+}
+
+// NewTable creates a table with the given aliases (requested name to
+// Copilot model) and presets (virtual model name to definition).
+func NewTable(aliases map[string]string, presets map[string]Preset) *Table {
+	t := &Table{}
+	t.Set(aliases, presets)
+	return t
+}
+
+// Set replaces all alias and preset definitions.
+func (t *Table) Set(aliases map[string]string, presets map[string]Preset) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.aliases = aliases
+	t.presets = presets
+}
+
+// Resolve returns the Copilot model for name and the preset it names, if
+// any. Presets may point at an alias; alias chains are not followed further.
+func (t *Table) Resolve(name string) (string, *Preset) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if preset, ok := t.presets[name]; ok {
+		model := preset.Model
+		if target, ok := t.aliases[model]; ok {
+			model = target
+		}
+		return model, &preset
+	}
+	if target, ok := t.aliases[name]; ok {
+		return target, nil
+	}
+	return name, nil
+}
+
+// PresetNames returns the names of the virtual models in sorted order.
+func (t *Table) PresetNames() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.presets))
+	for name := range t.presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns the definition of the virtual model name.
+func (t *Table) Preset(name string) (Preset, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	preset, ok := t.presets[name]
+	return preset, ok
+}
+
+// RewriteChatRequest rewrites the model of an OpenAI chat completions
+// request body and applies preset defaults. Fields it does not touch are
+// passed through unchanged. Bodies that are not JSON objects are returned
+// as-is.
+func (t *Table) RewriteChatRequest(body []byte) ([]byte, Resolution) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, Resolution{}
+	}
+	var requested string
+	if err := json.Unmarshal(fields["model"], &requested); err != nil || requested == "" {
+		return body, Resolution{}
+	}
+
+	model, preset := t.Resolve(requested)
+	res := Resolution{Requested: requested, Model: model}
+	if preset == nil && model == requested {
+		return body, res
+	}
+	fields["model"] = rawJSON(model)
+
+	if preset != nil {
+		res.Preset = requested
+		if preset.Temperature != nil && fields["temperature"] == nil {
+			fields["temperature"] = rawJSON(*preset.Temperature)
+		}
+		if preset.MaxTokens != nil && fields["max_tokens"] == nil && fields["max_completion_tokens"] == nil {
+			fields["max_tokens"] = rawJSON(*preset.MaxTokens)
+		}
+		if preset.SystemPrompt != "" {
+			fields["messages"] = withSystemPrompt(fields["messages"], preset.SystemPrompt)
+		}
+	}
+
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body, Resolution{}
+	}
+	return rewritten, res
+}
+
+// withSystemPrompt prepends a system message unless the conversation
+// already has one.
+func withSystemPrompt(raw json.RawMessage, prompt string) json.RawMessage {
+	var messages []json.RawMessage
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return raw
+	}
+	for _, message := range messages {
+		var m struct {
+			Role string `json:"role"`
+		}
+		if json.Unmarshal(message, &m) == nil && (m.Role == "system" || m.Role == "developer") {
+			return raw
+		}
+	}
+	system := rawJSON(map[string]string{"role": "system", "content": prompt})
+	return rawJSON(append([]json.RawMessage{system}, messages...))
+}
+
+// rawJSON encodes values that cannot fail to marshal.
+func rawJSON(v any) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTableResolve(t *testing.T) {
+	table := NewTable(
+		map[string]string{
+			"gpt-4":  "gpt-4.1",
+			"fast":   "gpt-4",
+			"ping":   "pong",
+			"pong":   "ping",
+			"sonnet": "claude-sonnet-4",
+		},
+		map[string]Preset{
+			"reviewer": {Model: "sonnet"},
+			"gpt-4":    {Model: "gpt-4o"},
+		},
+	)
+	tests := []struct {
+		name      string
+		requested string
+		model     string
+		preset    bool
+	}{
+		{"unknown name passes through", "o3", "o3", false},
+		{"alias", "sonnet", "claude-sonnet-4", false},
+		{"chains stop after one hop", "fast", "gpt-4", false},
+		{"cycles stop after one hop", "ping", "pong", false},
+		{"preset through an alias", "reviewer", "claude-sonnet-4", true},
+		{"preset wins over an alias of the same name", "gpt-4", "gpt-4o", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, preset := table.Resolve(tt.requested)
+			if model != tt.model || (preset != nil) != tt.preset {
+				t.Errorf("Resolve(%q) = %q, preset %v; want %q, preset %v", tt.requested, model, preset != nil, tt.model, tt.preset)
+			}
+		})
+	}
+}
+
+func TestRewriteChatRequest(t *testing.T) {
+	temperature, maxTokens := 0.2, 512
+	table := NewTable(
+		map[string]string{"sonnet": "claude-sonnet-4"},
+		map[string]Preset{"reviewer": {Model: "sonnet", Temperature: &temperature, MaxTokens: &maxTokens, SystemPrompt: "Review the code."}},
+	)
+	tests := []struct {
+		name   string
+		body   string
+		want   string
+		result Resolution
+	}{
+		{
+			"unchanged model",
+			`{"model":"gpt-4.1","messages":[]}`,
+			`{"model":"gpt-4.1","messages":[]}`,
+			Resolution{Requested: "gpt-4.1", Model: "gpt-4.1"},
+		},
+		{
+			"alias keeps other fields",
+			`{"model":"sonnet","stream":true,"temperature":1}`,
+			`{"model":"claude-sonnet-4","stream":true,"temperature":1}`,
+			Resolution{Requested: "sonnet", Model: "claude-sonnet-4"},
+		},
+		{
+			"preset fills in defaults",
+			`{"model":"reviewer","messages":[{"role":"user","content":"diff"}]}`,
+			`{"max_tokens":512,"messages":[{"content":"Review the code.","role":"system"},{"role":"user","content":"diff"}],"model":"claude-sonnet-4","temperature":0.2}`,
+			Resolution{Requested: "reviewer", Model: "claude-sonnet-4", Preset: "reviewer"},
+		},
+		{
+			"explicit fields win over preset defaults",
+			`{"model":"reviewer","temperature":0.9,"max_completion_tokens":64,"messages":[{"role":"developer","content":"Be terse."}]}`,
+			`{"max_completion_tokens":64,"messages":[{"role":"developer","content":"Be terse."}],"model":"claude-sonnet-4","temperature":0.9}`,
+			Resolution{Requested: "reviewer", Model: "claude-sonnet-4", Preset: "reviewer"},
+		},
+		{
+			"explicit null temperature is kept",
+			`{"model":"reviewer","temperature":null,"max_tokens":10,"messages":[{"role":"system","content":"Mine."}]}`,
+			`{"max_tokens":10,"messages":[{"role":"system","content":"Mine."}],"model":"claude-sonnet-4","temperature":null}`,
+			Resolution{Requested: "reviewer", Model: "claude-sonnet-4", Preset: "reviewer"},
+		},
+		{
+			"not JSON",
+			`model=reviewer`,
+			`model=reviewer`,
+			Resolution{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, res := table.RewriteChatRequest([]byte(tt.body))
+			if res != tt.result {
+				t.Errorf("resolution = %+v, want %+v", res, tt.result)
+			}
+			if !sameJSON(got, []byte(tt.want)) {
+				t.Errorf("body = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// sameJSON reports whether a and b are equal JSON documents, or equal bytes
+// if either is not JSON.
+func sameJSON(a, b []byte) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(x, y)
+}
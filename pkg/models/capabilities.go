@@ -0,0 +1,75 @@
+package models
+
+import (
+	"strings"
+
+	"copilot-api-proxy/pkg/copilot"
+)
+
+// Capabilities is the extended description of a model, flattened from the
+// Copilot model metadata.
+type Capabilities struct {
+	ID              string              `json:"id"`
+	Object          string              `json:"object"`
+	Name            string              `json:"name,omitempty"`
+	Vendor          string              `json:"vendor,omitempty"`
+	Version         string              `json:"version,omitempty"`
+	Family          string              `json:"family,omitempty"`
+	Type            string              `json:"type,omitempty"`
+	Preview         bool                `json:"preview"`
+	ContextWindow   int                 `json:"context_window,omitempty"`
+	MaxPromptTokens int                 `json:"max_prompt_tokens,omitempty"`
+	MaxOutputTokens int                 `json:"max_output_tokens,omitempty"`
+	Supports        Supports            `json:"supports"`
+	Vision          *copilot.VisionInfo `json:"vision,omitempty"`
+	PolicyState     string              `json:"policy_state,omitempty"`
+	VirtualModelFor string              `json:"virtual_model_for,omitempty"`
+}
+
+// Supports lists the optional features of a model. Unlike the Copilot
+// shape, unsupported features are reported as false rather than omitted.
+type Supports struct {
+	ToolCalls         bool `json:"tool_calls"`
+	ParallelToolCalls bool `json:"parallel_tool_calls"`
+	Streaming         bool `json:"streaming"`
+	StructuredOutputs bool `json:"structured_outputs"`
+	Vision            bool `json:"vision"`
+}
+
+// Describe flattens the Copilot metadata of model.
+func Describe(model copilot.Model) Capabilities {
+	caps := model.Capabilities
+	c := Capabilities{
+		ID:              model.ID,
+		Object:          "model",
+		Name:            model.Name,
+		Vendor:          model.Vendor,
+		Version:         model.Version,
+		Family:          caps.Family,
+		Type:            caps.Type,
+		Preview:         model.Preview,
+		ContextWindow:   caps.Limits.MaxContextWindowTokens,
+		MaxPromptTokens: caps.Limits.MaxPromptTokens,
+		MaxOutputTokens: caps.Limits.MaxOutputTokens,
+		Supports: Supports{
+			ToolCalls:         caps.Supports.ToolCalls,
+			ParallelToolCalls: caps.Supports.ParallelToolCalls,
+			Streaming:         caps.Supports.Streaming,
+			StructuredOutputs: caps.Supports.StructuredOutputs,
+			Vision:            caps.Supports.Vision || caps.Limits.Vision != nil,
+		},
+		Vision: caps.Limits.Vision,
+	}
+	if model.Policy != nil {
+		c.PolicyState = model.Policy.State
+	}
+	return c
+}
+
+// OwnedBy returns the owned_by value reported for model in OpenAI lists.
+func OwnedBy(model copilot.Model) string {
+	if model.Vendor == "" {
+		return "github-copilot"
+	}
+	return strings.ToLower(strings.ReplaceAll(model.Vendor, " ", "-"))
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+)
+
+const (
+	// DefaultCacheTTL is how long a fetched model list is served before it
+	// is refreshed.
+	DefaultCacheTTL = 10 * time.Minute
+
+	// fetchTimeout bounds a single refresh of the model list.
+	fetchTimeout = 30 * time.Second
+
+	// failedRefreshRetry is how long a stale list is served after a failed
+	// refresh before trying again.
+	failedRefreshRetry = 30 * time.Second
+)
+
+// Lister fetches the model list from Copilot.
+type Lister interface {
+	ListModels(ctx context.Context) (*copilot.ModelsResponse, error)
+}
+
+// Registry caches the Copilot model list. Concurrent callers share a
+// single refresh, and a stale list is served if a refresh fails.
+type Registry struct {
+	lister Lister
+	ttl    time.Duration
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	models      []copilot.Model
+	byID        map[string]copilot.Model
+	fetchedAt   time.Time
+	nextRefresh time.Time
+	inflight    *fetch
+}
+
+// fetch is a refresh in progress; done is closed once err is set.
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRegistry creates a registry that refreshes the model list from lister
+// once it is older than ttl.
+func NewRegistry(lister Lister, ttl time.Duration, logger *slog.Logger) *Registry {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Registry{lister: lister, ttl: ttl, logger: logger}
+}
+
+// List returns the models available to the proxy, without duplicates and
+// in the order Copilot reports them.
+func (r *Registry) List(ctx context.Context) ([]copilot.Model, error) {
+	r.mu.Lock()
+	if r.models != nil && time.Now().Before(r.nextRefresh) {
+		models := r.models
+		r.mu.Unlock()
+		return models, nil
+	}
+	f := r.inflight
+	if f == nil {
+		f = &fetch{done: make(chan struct{})}
+		r.inflight = f
+		go r.refresh(f)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f.err != nil && r.models == nil {
+		return nil, f.err
+	}
+	return r.models, nil
+}
+
+// Lookup returns the model with the given ID.
+func (r *Registry) Lookup(ctx context.Context, id string) (copilot.Model, bool, error) {
+	if _, err := r.List(ctx); err != nil {
+		return copilot.Model{}, false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	model, ok := r.byID[id]
+	return model, ok, nil
+}
+
+// Cached returns the model with the given ID from the list fetched last,
+// without fetching. It reports false for unknown models and before the
+// first fetch.
+func (r *Registry) Cached(id string) (copilot.Model, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	model, ok := r.byID[id]
+	return model, ok
+}
+
+// Invalidate forces the next List call to refresh the model list.
+func (r *Registry) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextRefresh = time.Time{}
+}
+
+// refresh fetches the model list on behalf of every caller waiting on f. It
+// does not use a caller's context, so one client going away does not fail
+// the others.
+func (r *Registry) refresh(f *fetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	resp, err := r.lister.ListModels(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer close(f.done)
+	r.inflight = nil
+
+	if err != nil {
+		f.err = err
+		if r.models != nil {
+			r.nextRefresh = time.Now().Add(failedRefreshRetry)
+			r.logger.Warn("Failed to refresh model list, serving cached models", "error", err, "age", time.Since(r.fetchedAt).Round(time.Second))
+		}
+		return
+	}
+
+	models := make([]copilot.Model, 0, len(resp.Data))
+	byID := make(map[string]copilot.Model, len(resp.Data))
+	for _, model := range resp.Data {
+		if _, ok := byID[model.ID]; ok {
+			continue
+		}
+		byID[model.ID] = model
+		models = append(models, model)
+	}
+	r.models = models
+	r.byID = byID
+	r.fetchedAt = time.Now()
+	r.nextRefresh = r.fetchedAt.Add(r.ttl)
+	r.logger.Debug("Model list refreshed", "models", len(models))
+}
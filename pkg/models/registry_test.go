@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+)
+
+// listerFunc adapts a function to the Lister interface.
+type listerFunc func(ctx context.Context) (*copilot.ModelsResponse, error)
+
+func (f listerFunc) ListModels(ctx context.Context) (*copilot.ModelsResponse, error) {
+	return f(ctx)
+}
+
+func TestRegistryCachedDoesNotFetch(t *testing.T) {
+	fetches := 0
+	lister := listerFunc(func(context.Context) (*copilot.ModelsResponse, error) {
+		fetches++
+		return &copilot.ModelsResponse{Object: "list", Data: []copilot.Model{{ID: "gpt-4.1"}}}, nil
+	})
+	r := NewRegistry(lister, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, ok := r.Cached("gpt-4.1"); ok || fetches != 0 {
+		t.Fatalf("Cached before a fetch: found=%v fetches=%d, want not found and no fetch", ok, fetches)
+	}
+	if _, err := r.List(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Cached("gpt-4.1"); !ok {
+		t.Fatal("Cached did not find a fetched model")
+	}
+	if fetches != 1 {
+		t.Fatalf("fetches = %d, want 1", fetches)
+	}
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"copilot-api-proxy/pkg/copilot"
+)
+
+// ValidationMode selects what happens to chat requests that the target
+// model cannot serve.
+type ValidationMode string
+
+const (
+	// ValidationReject rejects such requests with an error.
+	ValidationReject ValidationMode = "reject"
+	// ValidationFixup adjusts requests where possible: max_tokens is clamped
+	// and unsupported parameters are removed. Requests that cannot be
+	// adjusted are rejected.
+	ValidationFixup ValidationMode = "fixup"
+	// ValidationOff forwards requests unchecked.
+	ValidationOff ValidationMode = "off"
+)
+
+// ParseValidationMode parses a validation mode name. An empty name selects
+// ValidationReject.
+func ParseValidationMode(name string) (ValidationMode, error) {
+	switch mode := ValidationMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return ValidationReject, nil
+	case ValidationReject, ValidationFixup, ValidationOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown validation mode %q (want reject, fixup or off)", name)
+	}
+}
+
+// Issue is a reason a request cannot be sent to a model, described the way
+// the OpenAI API reports invalid requests.
+type Issue struct {
+	Param   string
+	Code    string
+	Message string
+}
+
+// Validator checks chat requests against the capabilities in the registry.
+type Validator struct {
+	registry *Registry
+	mode     atomic.Value
+}
+
+// NewValidator creates a validator using the model metadata in registry.
+func NewValidator(registry *Registry, mode ValidationMode) *Validator {
+	v := &Validator{registry: registry}
+	v.SetMode(mode)
+	return v
+}
+
+// SetMode changes the validation mode.
+func (v *Validator) SetMode(mode ValidationMode) {
+	v.mode.Store(mode)
+}
+
+// Mode returns the current validation mode.
+func (v *Validator) Mode() ValidationMode {
+	return v.mode.Load().(ValidationMode)
+}
+
+// Check validates a chat completions request body. In fix-up mode it
+// returns the adjusted body and a description of each change. Requests for
+// models that are not in the registry, or when the registry cannot be
+// fetched, are passed through for Copilot to judge.
+func (v *Validator) Check(ctx context.Context, body []byte) ([]byte, []string, *Issue) {
+	mode := v.Mode()
+	if mode == ValidationOff {
+		return body, nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, nil, nil
+	}
+	var modelID string
+	if err := json.Unmarshal(fields["model"], &modelID); err != nil || modelID == "" {
+		return body, nil, nil
+	}
+	model, found, err := v.registry.Lookup(ctx, modelID)
+	if err != nil || !found {
+		return body, nil, nil
+	}
+
+	c := &check{fields: fields, model: model, fixup: mode == ValidationFixup}
+	if issue := c.run(); issue != nil {
+		return body, nil, issue
+	}
+	if len(c.fixes) == 0 {
+		return body, nil, nil
+	}
+	adjusted, err := json.Marshal(fields)
+	if err != nil {
+		return body, nil, nil
+	}
+	return adjusted, c.fixes, nil
+}
+
+// check holds the state of validating one request.
+type check struct {
+	fields map[string]json.RawMessage
+	model  copilot.Model
+	fixup  bool
+	fixes  []string
+}
+
+func (c *check) run() *Issue {
+	caps := c.model.Capabilities
+	id := c.model.ID
+
+	if caps.Type != "" && caps.Type != "chat" {
+		return &Issue{Param: "model", Code: "model_not_supported",
+			Message: fmt.Sprintf("The model '%s' is a %s model and does not support chat completions.", id, caps.Type)}
+	}
+
+	if c.present("tools") && !caps.Supports.ToolCalls {
+		if issue := c.strip(fmt.Sprintf("The model '%s' does not support tools.", id), "tools", "tool_choice", "parallel_tool_calls"); issue != nil {
+			return issue
+		}
+	}
+	// Turning parallel tool calls off is always fine.
+	if c.isTrue("parallel_tool_calls") && !caps.Supports.ParallelToolCalls {
+		if issue := c.strip(fmt.Sprintf("The model '%s' does not support parallel tool calls.", id), "parallel_tool_calls"); issue != nil {
+			return issue
+		}
+	}
+	if c.usesJSONSchema() && !caps.Supports.StructuredOutputs {
+		return &Issue{Param: "response_format", Code: "unsupported_parameter",
+			Message: fmt.Sprintf("The model '%s' does not support structured outputs (response_format json_schema).", id)}
+	}
+
+	if issue := c.checkImages(); issue != nil {
+		return issue
+	}
+
+	if isReasoningModel(c.model) {
+		for _, param := range []string{"temperature", "top_p"} {
+			if c.present(param) && !c.equals(param, 1) {
+				if issue := c.strip(fmt.Sprintf("The model '%s' does not support '%s' other than the default (1).", id, param), param); issue != nil {
+					return issue
+				}
+			}
+		}
+	}
+
+	if limit := caps.Limits.MaxOutputTokens; limit > 0 {
+		for _, param := range []string{"max_tokens", "max_completion_tokens"} {
+			if issue := c.clamp(param, limit); issue != nil {
+				return issue
+			}
+		}
+	}
+	return nil
+}
+
+// checkImages rejects image inputs for models without vision, or more
+// images than the model accepts. In fix-up mode images sent to a model
+// without vision are removed.
+func (c *check) checkImages() *Issue {
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(c.fields["messages"], &messages); err != nil {
+		return nil
+	}
+
+	vision := c.model.Capabilities.Limits.Vision
+	supported := c.model.Capabilities.Supports.Vision || vision != nil
+	images := 0
+	for i, message := range messages {
+		var parts []map[string]json.RawMessage
+		if err := json.Unmarshal(message["content"], &parts); err != nil {
+			continue
+		}
+		kept := parts[:0]
+		for _, part := range parts {
+			var partType string
+			json.Unmarshal(part["type"], &partType)
+			if partType != "image_url" {
+				kept = append(kept, part)
+				continue
+			}
+			images++
+			if supported {
+				kept = append(kept, part)
+			}
+		}
+		if !supported && len(kept) != len(parts) {
+			if !c.fixup {
+				return &Issue{Param: fmt.Sprintf("messages[%d].content", i), Code: "unsupported_content",
+					Message: fmt.Sprintf("The model '%s' does not support image inputs.", c.model.ID)}
+			}
+			messages[i]["content"] = rawJSON(kept)
+		}
+	}
+
+	if !supported && images > 0 {
+		c.fields["messages"] = rawJSON(messages)
+		c.fixes = append(c.fixes, fmt.Sprintf("removed %d image(s)", images))
+	}
+	if supported && vision != nil && vision.MaxPromptImages > 0 && images > vision.MaxPromptImages {
+		return &Issue{Param: "messages", Code: "too_many_images",
+			Message: fmt.Sprintf("The model '%s' accepts at most %d images per request, got %d.", c.model.ID, vision.MaxPromptImages, images)}
+	}
+	return nil
+}
+
+// strip removes params in fix-up mode, or reports message as an issue
+// against the first of them.
+func (c *check) strip(message string, params ...string) *Issue {
+	if !c.fixup {
+		return &Issue{Param: params[0], Code: "unsupported_parameter", Message: message}
+	}
+	for _, param := range params {
+		if c.present(param) {
+			delete(c.fields, param)
+			c.fixes = append(c.fixes, "removed "+param)
+		}
+	}
+	return nil
+}
+
+// clamp limits an integer param to limit in fix-up mode, or reports it as
+// an issue if it exceeds the limit.
+func (c *check) clamp(param string, limit int) *Issue {
+	var value int
+	if !c.present(param) || json.Unmarshal(c.fields[param], &value) != nil || value <= limit {
+		return nil
+	}
+	if !c.fixup {
+		return &Issue{Param: param, Code: "invalid_value",
+			Message: fmt.Sprintf("'%s' is too large: %d. The model '%s' supports at most %d output tokens.", param, value, c.model.ID, limit)}
+	}
+	c.fields[param] = rawJSON(limit)
+	c.fixes = append(c.fixes, fmt.Sprintf("clamped %s from %d to %d", param, value, limit))
+	return nil
+}
+
+// present reports whether param is set to something other than null.
+func (c *check) present(param string) bool {
+	raw, ok := c.fields[param]
+	return ok && string(raw) != "null"
+}
+
+func (c *check) isTrue(param string) bool {
+	var value bool
+	return json.Unmarshal(c.fields[param], &value) == nil && value
+}
+
+func (c *check) equals(param string, want float64) bool {
+	var value float64
+	return json.Unmarshal(c.fields[param], &value) == nil && value == want
+}
+
+func (c *check) usesJSONSchema() bool {
+	var format struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(c.fields["response_format"], &format) == nil && format.Type == "json_schema"
+}
+
+// isReasoningModel reports whether model is an OpenAI o-series reasoning
+// model, which only accepts the default sampling parameters.
+func isReasoningModel(model copilot.Model) bool {
+	for _, name := range []string{model.Capabilities.Family, model.ID} {
+		if len(name) >= 2 && name[0] == 'o' && name[1] >= '1' && name[1] <= '9' {
+			return true
+		}
+	}
+	return false
+}
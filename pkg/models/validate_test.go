@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+)
+
+func newTestValidator(mode ValidationMode, models ...copilot.Model) *Validator {
+	lister := listerFunc(func(context.Context) (*copilot.ModelsResponse, error) {
+		return &copilot.ModelsResponse{Object: "list", Data: models}, nil
+	})
+	return NewValidator(NewRegistry(lister, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))), mode)
+}
+
+func TestValidatorParallelToolCalls(t *testing.T) {
+	model := copilot.Model{ID: "no-parallel"}
+	model.Capabilities.Type = "chat"
+	model.Capabilities.Supports.ToolCalls = true
+
+	tests := []struct {
+		name      string
+		mode      ValidationMode
+		body      string
+		wantIssue bool
+		wantFixes int
+	}{
+		{"false is accepted", ValidationReject, `{"model":"no-parallel","tools":[],"parallel_tool_calls":false}`, false, 0},
+		{"null is accepted", ValidationReject, `{"model":"no-parallel","tools":[],"parallel_tool_calls":null}`, false, 0},
+		{"true is rejected", ValidationReject, `{"model":"no-parallel","tools":[],"parallel_tool_calls":true}`, true, 0},
+		{"false is kept", ValidationFixup, `{"model":"no-parallel","tools":[],"parallel_tool_calls":false}`, false, 0},
+		{"true is removed", ValidationFixup, `{"model":"no-parallel","tools":[],"parallel_tool_calls":true}`, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, fixes, issue := newTestValidator(tt.mode, model).Check(context.Background(), []byte(tt.body))
+			if (issue != nil) != tt.wantIssue {
+				t.Fatalf("issue = %+v, want issue: %v", issue, tt.wantIssue)
+			}
+			if len(fixes) != tt.wantFixes {
+				t.Fatalf("fixes = %q, want %d", fixes, tt.wantFixes)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package ollama
+
+import (
+	"sort"
+	"time"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// Converter turns chat completions output into Ollama records. Streamed
+// chunks become one NDJSON record each; tool calls are buffered and emitted
+// whole on the final record, as Ollama clients expect complete arguments.
+type Converter struct {
+	model    string
+	generate bool
+	start    time.Time
+
+	firstToken   time.Time
+	toolCalls    map[int]*openai.ToolCall
+	finishReason string
+	usage        *openai.Usage
+}
+
+// NewChatConverter creates a converter producing /api/chat records.
+func NewChatConverter(model string, start time.Time) *Converter {
+	return &Converter{model: model, start: start, toolCalls: make(map[int]*openai.ToolCall)}
+}
+
+// NewGenerateConverter creates a converter producing /api/generate records.
+func NewGenerateConverter(model string, start time.Time) *Converter {
+	c := NewChatConverter(model, start)
+	c.generate = true
+	return c
+}
+
+// HandleChunk returns the records produced by one upstream chunk.
+func (c *Converter) HandleChunk(chunk *openai.ChatCompletionChunk) []any {
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	var records []any
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if c.firstToken.IsZero() {
+				c.firstToken = time.Now()
+			}
+			records = append(records, c.record(choice.Delta.Content, nil, false))
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			index := 0
+			if call.Index != nil {
+				index = *call.Index
+			}
+			existing, ok := c.toolCalls[index]
+			if !ok {
+				existing = &openai.ToolCall{ID: call.ID}
+				c.toolCalls[index] = existing
+			}
+			if call.Function.Name != "" {
+				existing.Function.Name = call.Function.Name
+			}
+			existing.Function.Arguments += call.Function.Arguments
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+	}
+	return records
+}
+
+// Finish returns the final record once the upstream stream has ended.
+func (c *Converter) Finish() any {
+	indexes := make([]int, 0, len(c.toolCalls))
+	for index := range c.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var calls []ToolCall
+	for _, index := range indexes {
+		call := c.toolCalls[index]
+		calls = append(calls, ToolCall{Function: ToolCallFunction{
+			Name:      call.Function.Name,
+			Arguments: argumentsObject(call.Function.Arguments),
+		}})
+	}
+	return c.record("", calls, true)
+}
+
+// Complete converts a non-streamed response into a single final record.
+func (c *Converter) Complete(resp *openai.ChatCompletionResponse) any {
+	c.usage = resp.Usage
+	c.firstToken = time.Now()
+
+	var content string
+	var calls []ToolCall
+	for _, choice := range resp.Choices {
+		content += choice.Message.Content
+		for _, call := range choice.Message.ToolCalls {
+			calls = append(calls, ToolCall{Function: ToolCallFunction{
+				Name:      call.Function.Name,
+				Arguments: argumentsObject(call.Function.Arguments),
+			}})
+		}
+		if choice.FinishReason != "" {
+			c.finishReason = choice.FinishReason
+		}
+	}
+	return c.record(content, calls, true)
+}
+
+func (c *Converter) record(content string, calls []ToolCall, done bool) any {
+	createdAt := Timestamp(time.Now())
+	var metrics Metrics
+	if done {
+		metrics = c.metrics()
+	}
+
+	if c.generate {
+		return GenerateResponse{
+			Model:     c.model,
+			CreatedAt: createdAt,
+			Response:  content,
+			Done:      done,
+			Metrics:   metrics,
+		}
+	}
+	return ChatResponse{
+		Model:     c.model,
+		CreatedAt: createdAt,
+		Message:   Message{Role: "assistant", Content: content, ToolCalls: calls},
+		Done:      done,
+		Metrics:   metrics,
+	}
+}
+
+func (c *Converter) metrics() Metrics {
+	now := time.Now()
+	firstToken := c.firstToken
+	if firstToken.IsZero() {
+		firstToken = now
+	}
+
+	metrics := Metrics{
+		DoneReason:         doneReason(c.finishReason),
+		TotalDuration:      now.Sub(c.start).Nanoseconds(),
+		PromptEvalDuration: firstToken.Sub(c.start).Nanoseconds(),
+		EvalDuration:       now.Sub(firstToken).Nanoseconds(),
+	}
+	if c.usage != nil {
+		metrics.PromptEvalCount = c.usage.PromptTokens
+		metrics.EvalCount = c.usage.CompletionTokens
+	}
+	return metrics
+}
+
+func doneReason(finishReason string) string {
+	if finishReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
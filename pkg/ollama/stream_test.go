@@ -0,0 +1,118 @@
+package ollama
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+func contentChunk(text string) *openai.ChatCompletionChunk {
+	return &openai.ChatCompletionChunk{Choices: []openai.ChunkChoice{{Delta: openai.Delta{Content: text}}}}
+}
+
+func toolCallChunk(index int, id, name, arguments string) *openai.ChatCompletionChunk {
+	return &openai.ChatCompletionChunk{Choices: []openai.ChunkChoice{{Delta: openai.Delta{ToolCalls: []openai.ToolCall{{
+		Index:    &index,
+		ID:       id,
+		Function: openai.FunctionCall{Name: name, Arguments: arguments},
+	}}}}}}
+}
+
+func finishChunk(reason string) *openai.ChatCompletionChunk {
+	return &openai.ChatCompletionChunk{
+		Choices: []openai.ChunkChoice{{FinishReason: &reason}},
+		Usage:   &openai.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+	}
+}
+
+func TestConverterStreamsContent(t *testing.T) {
+	c := NewChatConverter("llama3", time.Now())
+
+	var records []any
+	for _, chunk := range []*openai.ChatCompletionChunk{contentChunk("Hel"), contentChunk("lo"), finishChunk("stop")} {
+		records = append(records, c.HandleChunk(chunk)...)
+	}
+	records = append(records, c.Finish())
+
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want two content records and a final one", len(records))
+	}
+	for i, want := range []string{"Hel", "lo", ""} {
+		record := records[i].(ChatResponse)
+		if record.Model != "llama3" || record.Message.Role != "assistant" || record.Message.Content != want {
+			t.Errorf("record %d = %+v, want assistant content %q", i, record, want)
+		}
+		if record.Done != (i == 2) {
+			t.Errorf("record %d done = %v", i, record.Done)
+		}
+	}
+	final := records[2].(ChatResponse)
+	if final.DoneReason != "stop" || final.PromptEvalCount != 12 || final.EvalCount != 3 || final.TotalDuration <= 0 {
+		t.Errorf("final metrics = %+v", final.Metrics)
+	}
+	if records[0].(ChatResponse).DoneReason != "" {
+		t.Error("metrics reported before the final record")
+	}
+}
+
+func TestConverterAccumulatesToolCalls(t *testing.T) {
+	c := NewChatConverter("llama3", time.Now())
+
+	for _, chunk := range []*openai.ChatCompletionChunk{
+		toolCallChunk(1, "call_2", "time", `{"zone":`),
+		toolCallChunk(0, "call_1", "weather", `{"city":`),
+		toolCallChunk(0, "", "", `"Paris"}`),
+		toolCallChunk(1, "", "", `"CET"}`),
+		finishChunk("tool_calls"),
+	} {
+		if records := c.HandleChunk(chunk); len(records) != 0 {
+			t.Fatalf("tool call fragments produced records %+v before the stream ended", records)
+		}
+	}
+
+	final := c.Finish().(ChatResponse)
+	got, _ := json.Marshal(final.Message.ToolCalls)
+	want := `[{"function":{"name":"weather","arguments":{"city":"Paris"}}},{"function":{"name":"time","arguments":{"zone":"CET"}}}]`
+	if string(got) != want {
+		t.Errorf("tool calls = %s\nwant %s", got, want)
+	}
+	if !final.Done || final.DoneReason != "stop" {
+		t.Errorf("final record done=%v reason=%q, want done with stop", final.Done, final.DoneReason)
+	}
+}
+
+func TestConverterDoneReason(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		want         string
+	}{
+		{"stop", "stop"},
+		{"length", "length"},
+		{"tool_calls", "stop"},
+		{"content_filter", "stop"},
+		{"", "stop"},
+	}
+	for _, tt := range tests {
+		c := NewGenerateConverter("llama3", time.Now())
+		if tt.finishReason != "" {
+			c.HandleChunk(finishChunk(tt.finishReason))
+		}
+		if got := c.Finish().(GenerateResponse).DoneReason; got != tt.want {
+			t.Errorf("finish_reason %q: done_reason = %q, want %q", tt.finishReason, got, tt.want)
+		}
+	}
+}
+
+func TestConverterComplete(t *testing.T) {
+	c := NewGenerateConverter("llama3", time.Now())
+	record := c.Complete(&openai.ChatCompletionResponse{
+		Choices: []openai.Choice{{Message: openai.ResponseMessage{Role: "assistant", Content: "Hi"}, FinishReason: "length"}},
+		Usage:   &openai.Usage{PromptTokens: 4, CompletionTokens: 1},
+	}).(GenerateResponse)
+
+	if record.Response != "Hi" || !record.Done || record.DoneReason != "length" || record.EvalCount != 1 {
+		t.Errorf("record = %+v, want the whole reply as one done record", record)
+	}
+}
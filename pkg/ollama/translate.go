@@ -0,0 +1,248 @@
+package ollama
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"copilot-api-proxy/pkg/copilot"
+	"copilot-api-proxy/pkg/openai"
+)
+
+// DecodeChatRequest parses and minimally validates an /api/chat body.
+func DecodeChatRequest(body []byte) (*ChatRequest, error) {
+	var req ChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	return &req, nil
+}
+
+// DecodeGenerateRequest parses and minimally validates an /api/generate body.
+func DecodeGenerateRequest(body []byte) (*GenerateRequest, error) {
+	var req GenerateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	return &req, nil
+}
+
+// IsStreaming reports whether a request wants a streamed response. Ollama
+// streams unless told otherwise.
+func IsStreaming(stream *bool) bool {
+	return stream == nil || *stream
+}
+
+// ChatToCompletion converts an /api/chat request into a chat completions
+// request.
+func ChatToCompletion(req *ChatRequest) (*openai.ChatCompletionRequest, error) {
+	out := newCompletionRequest(req.Model, req.Options, IsStreaming(req.Stream))
+
+	// Ollama tool results carry no call id, so ids are generated for
+	// assistant tool calls and handed out to the following tool messages
+	// in order.
+	var pendingIDs []string
+	nextID := 0
+	for i, msg := range req.Messages {
+		converted := openai.Message{Role: msg.Role}
+		switch msg.Role {
+		case "system", "user":
+			converted.Content = messageContent(msg.Content, msg.Images)
+		case "assistant":
+			if msg.Content != "" {
+				converted.Content = msg.Content
+			}
+			pendingIDs = nil
+			for _, call := range msg.ToolCalls {
+				id := fmt.Sprintf("call_%d", nextID)
+				nextID++
+				pendingIDs = append(pendingIDs, id)
+				converted.ToolCalls = append(converted.ToolCalls, openai.ToolCall{
+					ID:   id,
+					Type: "function",
+					Function: openai.FunctionCall{
+						Name:      call.Function.Name,
+						Arguments: argumentsString(call.Function.Arguments),
+					},
+				})
+			}
+		case "tool":
+			if len(pendingIDs) == 0 {
+				return nil, fmt.Errorf("messages[%d]: tool message without a preceding tool call", i)
+			}
+			converted.ToolCallID = pendingIDs[0]
+			pendingIDs = pendingIDs[1:]
+			converted.Content = msg.Content
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+		out.Messages = append(out.Messages, converted)
+	}
+
+	if len(req.Tools) > 0 {
+		if err := json.Unmarshal(req.Tools, &out.Tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+	}
+
+	format, err := responseFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+	out.ResponseFormat = format
+	return out, nil
+}
+
+// GenerateToCompletion converts an /api/generate request into a chat
+// completions request with a single user turn.
+func GenerateToCompletion(req *GenerateRequest) (*openai.ChatCompletionRequest, error) {
+	out := newCompletionRequest(req.Model, req.Options, IsStreaming(req.Stream))
+	if req.System != "" {
+		out.Messages = append(out.Messages, openai.Message{Role: "system", Content: req.System})
+	}
+	prompt := req.Prompt
+	if req.Suffix != "" {
+		prompt += "\n\nContinue so that the text ends with:\n" + req.Suffix
+	}
+	out.Messages = append(out.Messages, openai.Message{Role: "user", Content: messageContent(prompt, req.Images)})
+
+	format, err := responseFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+	out.ResponseFormat = format
+	return out, nil
+}
+
+func newCompletionRequest(model string, options *Options, stream bool) *openai.ChatCompletionRequest {
+	out := &openai.ChatCompletionRequest{Model: model, Stream: stream}
+	if stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if options != nil {
+		out.Temperature = options.Temperature
+		out.TopP = options.TopP
+		out.Stop = options.Stop
+		out.Seed = options.Seed
+		if options.NumPredict != nil && *options.NumPredict > 0 {
+			out.MaxTokens = *options.NumPredict
+		}
+	}
+	return out
+}
+
+// messageContent builds the OpenAI content for text plus base64 images.
+func messageContent(text string, images []string) any {
+	if len(images) == 0 {
+		return text
+	}
+	parts := []openai.ContentPart{{Type: "text", Text: text}}
+	for _, image := range images {
+		parts = append(parts, openai.ContentPart{
+			Type:     "image_url",
+			ImageURL: &openai.ImageURL{URL: "data:" + imageMediaType(image) + ";base64," + image},
+		})
+	}
+	return parts
+}
+
+// imageMediaType guesses an image's media type from its base64 prefix, as
+// Ollama sends bare base64 without one.
+func imageMediaType(data string) string {
+	switch {
+	case strings.HasPrefix(data, "/9j/"):
+		return "image/jpeg"
+	case strings.HasPrefix(data, "R0lG"):
+		return "image/gif"
+	case strings.HasPrefix(data, "UklG"):
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
+
+// responseFormat maps Ollama's format field ("json" or a JSON schema) onto
+// the chat completions response_format.
+func responseFormat(format json.RawMessage) (json.RawMessage, error) {
+	if len(format) == 0 || string(format) == "null" || string(format) == `""` {
+		return nil, nil
+	}
+	var mode string
+	if err := json.Unmarshal(format, &mode); err == nil {
+		if mode != "json" {
+			return nil, fmt.Errorf("unsupported format %q", mode)
+		}
+		return json.RawMessage(`{"type":"json_object"}`), nil
+	}
+	return json.Marshal(map[string]any{
+		"type": "json_schema",
+		"json_schema": map[string]any{
+			"name":   "response",
+			"schema": format,
+		},
+	})
+}
+
+func argumentsString(arguments json.RawMessage) string {
+	if len(arguments) == 0 {
+		return "{}"
+	}
+	var s string
+	if err := json.Unmarshal(arguments, &s); err == nil {
+		return s
+	}
+	return string(arguments)
+}
+
+// argumentsObject converts OpenAI's string arguments into the JSON object
+// Ollama clients expect.
+func argumentsObject(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// Tags builds the /api/tags listing from the Copilot models.
+func Tags(models []copilot.Model) *TagsResponse {
+	out := &TagsResponse{Models: []ModelInfo{}}
+	seen := make(map[string]bool)
+	for _, model := range models {
+		if model.Capabilities.Type != "" && model.Capabilities.Type != "chat" {
+			continue
+		}
+		if seen[model.ID] {
+			continue
+		}
+		seen[model.ID] = true
+
+		digest := sha256.Sum256([]byte(model.ID + model.Version))
+		family := model.Capabilities.Family
+		out.Models = append(out.Models, ModelInfo{
+			Name:       model.ID,
+			Model:      model.ID,
+			ModifiedAt: time.Now().UTC().Format(time.RFC3339),
+			Digest:     hex.EncodeToString(digest[:]),
+			Details: ModelDetails{
+				Format:   "copilot",
+				Family:   family,
+				Families: []string{family},
+			},
+		})
+	}
+	return out
+}
+
+// Timestamp formats t the way Ollama reports created_at.
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
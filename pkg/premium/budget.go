@@ -0,0 +1,264 @@
+package premium
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/fsutil"
+)
+
+// persistInterval is how often consumption is written to the state file.
+const persistInterval = 30 * time.Second
+
+// ErrBudgetExhausted is returned by Check when a request would take the
+// month's consumption past the blocking threshold.
+var ErrBudgetExhausted = errors.New("premium request budget exhausted")
+
+// Policy configures the budget. WarnAt and BlockAt are fractions of
+// MonthlyBudget; zero disables them, and a zero MonthlyBudget only tracks
+// consumption.
+type Policy struct {
+	MonthlyBudget float64
+	WarnAt        float64
+	BlockAt       float64
+	Multipliers   Multipliers
+}
+
+// Status is the consumption of the current month.
+type Status struct {
+	Month  string  `json:"month"`
+	Used   float64 `json:"used"`
+	Budget float64 `json:"budget,omitempty"`
+}
+
+type stateFile struct {
+	Month string  `json:"month"`
+	Used  float64 `json:"used"`
+}
+
+// Budget counts the premium requests of the current month. Like Copilot's
+// own allowance, the count resets at the start of each month in UTC.
+type Budget struct {
+	mu        sync.Mutex
+	policy    Policy
+	month     string
+	used      float64
+	warned    bool
+	statePath string
+	logger    *slog.Logger
+	now       func() time.Time
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	// dirty is set when consumption changed since the last save.
+	dirty bool
+}
+
+// New creates a budget. If statePath is set, consumption is restored from
+// it and periodically saved back until Close is called.
+func New(policy Policy, statePath string, logger *slog.Logger) (*Budget, error) {
+	b := &Budget{
+		policy:    policy,
+		statePath: statePath,
+		logger:    logger,
+		now:       time.Now,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	b.month = b.currentMonth()
+
+	if statePath == "" {
+		close(b.doneCh)
+		return b, nil
+	}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	go b.persistLoop()
+	return b, nil
+}
+
+// SetPolicy replaces the policy. The consumption so far is kept.
+func (b *Budget) SetPolicy(policy Policy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.policy = policy
+	b.warned = b.policy.warnLimit() > 0 && b.used >= b.policy.warnLimit()
+}
+
+// Reservation is the cost of one request, counted against the budget
+// until the request turns out to have failed.
+type Reservation struct {
+	budget *Budget
+	month  string
+	cost   float64
+	once   sync.Once
+}
+
+// Check reserves the cost of a request to model and returns the
+// reservation, which must be refunded if the request fails. Checking and
+// counting under one lock keeps concurrent requests from overrunning the
+// budget together. If the request would take consumption past the blocking
+// threshold, nothing is reserved and an error wrapping ErrBudgetExhausted
+// is returned. Requests that cost nothing are always allowed. Crossing the
+// warning threshold or the whole budget is logged once.
+func (b *Budget) Check(model string) (*Reservation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	cost := b.policy.Multipliers.For(model)
+	r := &Reservation{budget: b, month: b.month, cost: cost}
+	if cost == 0 {
+		return r, nil
+	}
+	budget := b.policy.MonthlyBudget
+	if limit := budget * b.policy.BlockAt; limit > 0 && b.used+cost > limit {
+		return nil, fmt.Errorf("%w: %.2f of %.2f premium requests used in %s and %s costs %.2f",
+			ErrBudgetExhausted, b.used, limit, b.month, model, cost)
+	}
+
+	before := b.used
+	b.used += cost
+	b.dirty = true
+	if warn := b.policy.warnLimit(); warn > 0 && !b.warned && b.used >= warn {
+		b.warned = true
+		b.logger.Warn("Premium request budget warning threshold crossed",
+			"used", b.used, "budget", budget, "month", b.month)
+	}
+	if budget > 0 && before < budget && b.used >= budget {
+		b.logger.Warn("Premium request budget used up", "used", b.used, "budget", budget, "month", b.month)
+	}
+	return r, nil
+}
+
+// Refund gives the reserved cost back. Only the first call has an effect,
+// and a reservation from a previous month is not refunded.
+func (r *Reservation) Refund() {
+	r.once.Do(func() {
+		if r.cost == 0 {
+			return
+		}
+		b := r.budget
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.rollover()
+		if b.month != r.month {
+			return
+		}
+		b.used = max(b.used-r.cost, 0)
+		b.dirty = true
+	})
+}
+
+// Status returns the consumption of the current month.
+func (b *Budget) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	return Status{Month: b.month, Used: b.used, Budget: b.policy.MonthlyBudget}
+}
+
+func (p Policy) warnLimit() float64 {
+	return p.MonthlyBudget * p.WarnAt
+}
+
+func (b *Budget) currentMonth() string {
+	return b.now().UTC().Format("2006-01")
+}
+
+// rollover starts a new count when the month has changed.
+func (b *Budget) rollover() {
+	if month := b.currentMonth(); month != b.month {
+		b.month, b.used, b.warned = month, 0, false
+	}
+}
+
+// Close stops the persistence loop and saves the consumption one last time.
+func (b *Budget) Close() {
+	select {
+	case <-b.stopCh:
+	default:
+		close(b.stopCh)
+	}
+	<-b.doneCh
+}
+
+func (b *Budget) persistLoop() {
+	defer close(b.doneCh)
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.save(); err != nil {
+				b.logger.Error("Failed to save premium request state", "error", err)
+			}
+		case <-b.stopCh:
+			if err := b.save(); err != nil {
+				b.logger.Error("Failed to save premium request state", "error", err)
+			}
+			return
+		}
+	}
+}
+
+func (b *Budget) load() error {
+	data, err := os.ReadFile(b.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read premium request state: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		// A corrupt state file should not keep the proxy from starting.
+		b.logger.Warn("Ignoring unreadable premium request state", "path", b.statePath, "error", err)
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state.Month == b.month {
+		b.used = state.Used
+		b.warned = b.policy.warnLimit() > 0 && b.used >= b.policy.warnLimit()
+	}
+	return nil
+}
+
+// save writes the consumption to the state file if it changed since the
+// last save.
+func (b *Budget) save() error {
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return nil
+	}
+	b.dirty = false
+	b.rollover()
+	state := stateFile{Month: b.month, Used: b.used}
+	b.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal premium request state: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(b.statePath, data); err != nil {
+		b.markDirty()
+		return err
+	}
+	return nil
+}
+
+// markDirty schedules another save after a failed one.
+func (b *Budget) markDirty() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dirty = true
+}
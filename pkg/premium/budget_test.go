@@ -0,0 +1,91 @@
+package premium
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestBudgetSavesOnlyWhenCharged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "premium_state.json")
+	b, err := New(Policy{Multipliers: DefaultMultipliers}, path, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Check("gpt-4.1")
+	if err := b.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state file written without any consumption (stat error: %v)", err)
+	}
+
+	b.Check("claude-opus-4")
+	b.Close()
+
+	restored, err := New(Policy{Multipliers: DefaultMultipliers}, path, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if used := restored.Status().Used; used != 10 {
+		t.Fatalf("restored used = %v, want 10", used)
+	}
+}
+
+func TestBudgetCheckReservesAtomically(t *testing.T) {
+	b, err := New(Policy{MonthlyBudget: 10, BlockAt: 1, Multipliers: DefaultMultipliers}, "", discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.Check("claude-sonnet-4"); err == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 10 {
+		t.Errorf("%d concurrent requests allowed, want 10", n)
+	}
+	if used := b.Status().Used; used != 10 {
+		t.Errorf("used = %v, want 10", used)
+	}
+}
+
+func TestReservationRefund(t *testing.T) {
+	b, err := New(Policy{MonthlyBudget: 1, BlockAt: 1, Multipliers: DefaultMultipliers}, "", discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := b.Check("claude-sonnet-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Check("claude-sonnet-4"); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("second Check: %v, want ErrBudgetExhausted", err)
+	}
+
+	r.Refund()
+	r.Refund()
+	if used := b.Status().Used; used != 0 {
+		t.Fatalf("used after refund = %v, want 0", used)
+	}
+	if _, err := b.Check("claude-sonnet-4"); err != nil {
+		t.Fatalf("Check after refund: %v", err)
+	}
+}
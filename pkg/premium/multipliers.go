@@ -0,0 +1,43 @@
+// Package premium tracks Copilot premium request consumption against a
+// monthly budget. Each user-initiated request to a model costs that model's
+// multiplier; agent-initiated requests are not billed.
+package premium
+
+import "copilot-api-proxy/pkg/modelpattern"
+
+// Multipliers maps model patterns to the number of premium requests one
+// request to a matching model costs. Patterns are matched as described in
+// package modelpattern.
+type Multipliers map[string]float64
+
+// DefaultMultipliers are the published multipliers of the models on paid
+// Copilot plans. Configured multipliers are merged over them.
+var DefaultMultipliers = Multipliers{
+	"gpt-4.1*":                  0,
+	"gpt-4o*":                   0,
+	"gpt-5-mini*":               0,
+	"gpt-5*":                    1,
+	"gpt-4.5*":                  50,
+	"o1*":                       10,
+	"o3*":                       1,
+	"o3-mini*":                  0.33,
+	"o4-mini*":                  0.33,
+	"claude-3.5-sonnet*":        1,
+	"claude-3.7-sonnet*":        1,
+	"claude-3.7-sonnet-thought": 1.25,
+	"claude-sonnet-4*":          1,
+	"claude-opus-4*":            10,
+	"gemini-2.0-flash*":         0.25,
+	"gemini-2.5-pro*":           1,
+}
+
+// defaultMultiplier is the cost of a model no pattern matches.
+const defaultMultiplier = 1
+
+// For returns the multiplier of model.
+func (m Multipliers) For(model string) float64 {
+	if multiplier, ok := modelpattern.Lookup(m, model); ok {
+		return multiplier
+	}
+	return defaultMultiplier
+}
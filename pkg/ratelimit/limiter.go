@@ -0,0 +1,343 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/fsutil"
+)
+
+// persistInterval is how often counters are written to the state file.
+const persistInterval = 30 * time.Second
+
+// Limits configures one set of limits. A zero value disables that limit.
+type Limits struct {
+	RequestsPerMinute int
+	RequestsPerDay    int
+	ConcurrentStreams int
+}
+
+// Enabled reports whether any limit is set.
+func (l Limits) Enabled() bool {
+	return l.RequestsPerMinute > 0 || l.RequestsPerDay > 0 || l.ConcurrentStreams > 0
+}
+
+// Decision is the outcome of an admission check. The limit fields describe
+// the per-minute bucket that applies to the caller and are meant for
+// x-ratelimit-* response headers.
+type Decision struct {
+	Allowed    bool
+	Scope      string
+	Reason     string
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// counter is the state tracked for one client or for the global scope.
+type counter struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+	Day     string    `json:"day"`
+	Daily   int       `json:"daily"`
+
+	inFlight int
+}
+
+type stateFile struct {
+	Global  *counter            `json:"global"`
+	Clients map[string]*counter `json:"clients"`
+}
+
+// Limiter enforces per-client and global token-bucket rate limits, daily
+// quotas and concurrent stream limits.
+type Limiter struct {
+	mu        sync.Mutex
+	perClient Limits
+	global    Limits
+	globalCtr *counter
+	clients   map[string]*counter
+	statePath string
+	logger    *slog.Logger
+	now       func() time.Time
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	// dirty is set when counters changed since the last save.
+	dirty bool
+}
+
+// New creates a limiter. If statePath is set, counters are restored from it
+// and periodically saved back until Close is called.
+func New(perClient, global Limits, statePath string, logger *slog.Logger) (*Limiter, error) {
+	l := &Limiter{
+		perClient: perClient,
+		global:    global,
+		clients:   make(map[string]*counter),
+		statePath: statePath,
+		logger:    logger,
+		now:       time.Now,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	l.globalCtr = l.newCounter(global)
+
+	if statePath == "" {
+		close(l.doneCh)
+		return l, nil
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	go l.persistLoop()
+	return l, nil
+}
+
+// SetLimits replaces the configured limits. Existing counters are kept.
+func (l *Limiter) SetLimits(perClient, global Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perClient = perClient
+	l.global = global
+}
+
+// Acquire checks whether client may start a request. If it may, the
+// request is counted and the returned release function must be called when
+// the request finishes. If not, release is a no-op.
+func (l *Limiter) Acquire(client string) (Decision, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	clientCtr, ok := l.clients[client]
+	if !ok {
+		clientCtr = l.newCounter(l.perClient)
+		l.clients[client] = clientCtr
+	}
+	l.refill(l.globalCtr, l.global, now)
+	l.refill(clientCtr, l.perClient, now)
+
+	if d, ok := l.check(l.globalCtr, l.global, "global", now); !ok {
+		return d, func() {}
+	}
+	if d, ok := l.check(clientCtr, l.perClient, "client", now); !ok {
+		return d, func() {}
+	}
+
+	for _, scoped := range []struct {
+		c      *counter
+		limits Limits
+	}{{l.globalCtr, l.global}, {clientCtr, l.perClient}} {
+		if scoped.limits.RequestsPerMinute > 0 {
+			scoped.c.Tokens--
+		}
+		scoped.c.Daily++
+		scoped.c.inFlight++
+	}
+	// Without limits the counters only feed the response headers, so there
+	// is nothing worth persisting.
+	if l.perClient.Enabled() || l.global.Enabled() {
+		l.dirty = true
+	}
+
+	decision := l.describe(clientCtr, l.perClient)
+	if l.perClient.RequestsPerMinute == 0 {
+		decision = l.describe(l.globalCtr, l.global)
+	}
+	decision.Allowed = true
+
+	var once sync.Once
+	return decision, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.globalCtr.inFlight--
+			clientCtr.inFlight--
+		})
+	}
+}
+
+// check returns a rejection decision if c has exhausted any of limits.
+func (l *Limiter) check(c *counter, limits Limits, scope string, now time.Time) (Decision, bool) {
+	reject := func(reason string, retryAfter time.Duration) (Decision, bool) {
+		d := l.describe(c, limits)
+		d.Scope = scope
+		d.Reason = reason
+		d.RetryAfter = retryAfter
+		return d, false
+	}
+
+	if limits.ConcurrentStreams > 0 && c.inFlight >= limits.ConcurrentStreams {
+		return reject(fmt.Sprintf("%s concurrent stream limit of %d reached", scope, limits.ConcurrentStreams), time.Second)
+	}
+	if limits.RequestsPerDay > 0 && c.Daily >= limits.RequestsPerDay {
+		return reject(fmt.Sprintf("%s daily request quota of %d reached", scope, limits.RequestsPerDay), untilMidnight(now))
+	}
+	if limits.RequestsPerMinute > 0 && c.Tokens < 1 {
+		rate := float64(limits.RequestsPerMinute) / 60
+		wait := time.Duration((1 - c.Tokens) / rate * float64(time.Second))
+		return reject(fmt.Sprintf("%s rate limit of %d requests per minute reached", scope, limits.RequestsPerMinute), wait)
+	}
+	return Decision{}, true
+}
+
+// describe fills the per-minute header fields from c.
+func (l *Limiter) describe(c *counter, limits Limits) Decision {
+	if limits.RequestsPerMinute == 0 {
+		return Decision{}
+	}
+	rate := float64(limits.RequestsPerMinute) / 60
+	missing := float64(limits.RequestsPerMinute) - c.Tokens
+	return Decision{
+		Limit:     limits.RequestsPerMinute,
+		Remaining: max(0, int(math.Floor(c.Tokens))),
+		Reset:     time.Duration(missing / rate * float64(time.Second)),
+	}
+}
+
+// refill tops up c's bucket for the time elapsed and rolls the daily counter
+// over at local midnight.
+func (l *Limiter) refill(c *counter, limits Limits, now time.Time) {
+	if day := now.Format(time.DateOnly); c.Day != day {
+		c.Day = day
+		c.Daily = 0
+	}
+
+	capacity := float64(limits.RequestsPerMinute)
+	if !c.Updated.IsZero() && now.After(c.Updated) {
+		c.Tokens += now.Sub(c.Updated).Seconds() * capacity / 60
+	}
+	c.Tokens = math.Min(c.Tokens, capacity)
+	c.Updated = now
+}
+
+func (l *Limiter) newCounter(limits Limits) *counter {
+	now := l.now()
+	return &counter{
+		Tokens:  float64(limits.RequestsPerMinute),
+		Updated: now,
+		Day:     now.Format(time.DateOnly),
+	}
+}
+
+func untilMidnight(now time.Time) time.Duration {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+// Close stops the persistence loop and saves the counters one last time.
+func (l *Limiter) Close() {
+	select {
+	case <-l.stopCh:
+	default:
+		close(l.stopCh)
+	}
+	<-l.doneCh
+}
+
+func (l *Limiter) persistLoop() {
+	defer close(l.doneCh)
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.save(); err != nil {
+				l.logger.Error("Failed to save rate limit state", "error", err)
+			}
+		case <-l.stopCh:
+			if err := l.save(); err != nil {
+				l.logger.Error("Failed to save rate limit state", "error", err)
+			}
+			return
+		}
+	}
+}
+
+func (l *Limiter) load() error {
+	data, err := os.ReadFile(l.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read rate limit state: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		// A corrupt state file should not keep the proxy from starting.
+		l.logger.Warn("Ignoring unreadable rate limit state", "path", l.statePath, "error", err)
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if state.Global != nil {
+		l.globalCtr = state.Global
+	}
+	for name, c := range state.Clients {
+		l.clients[name] = c
+	}
+	return nil
+}
+
+// save prunes idle clients and writes the counters to the state file if
+// they changed since the last save. Pruning runs on every call, so clients
+// seen while no limits are set do not pile up.
+func (l *Limiter) save() error {
+	l.mu.Lock()
+	l.prune(l.now())
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	l.dirty = false
+	state := stateFile{Clients: make(map[string]*counter, len(l.clients))}
+	g := *l.globalCtr
+	state.Global = &g
+	for name, c := range l.clients {
+		copied := *c
+		state.Clients[name] = &copied
+	}
+	l.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rate limit state: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(l.statePath, data); err != nil {
+		l.markDirty()
+		return err
+	}
+	return nil
+}
+
+// prune drops idle clients whose counters no longer hold anything back
+// under the current per-client limits: a full bucket, and no requests today
+// unless a daily quota applies. Their state is identical to a fresh counter.
+func (l *Limiter) prune(now time.Time) {
+	for name, c := range l.clients {
+		l.refill(c, l.perClient, now)
+		if c.inFlight > 0 || c.Tokens < float64(l.perClient.RequestsPerMinute) {
+			continue
+		}
+		if l.perClient.RequestsPerDay > 0 && c.Daily > 0 {
+			continue
+		}
+		delete(l.clients, name)
+	}
+}
+
+// markDirty schedules another save after a failed one.
+func (l *Limiter) markDirty() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dirty = true
+}
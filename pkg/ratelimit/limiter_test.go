@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, perClient Limits) (*Limiter, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ratelimit_state.json")
+	l, err := New(perClient, Limits{}, path, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, path
+}
+
+func TestLimiterSkipsSaveWithoutLimits(t *testing.T) {
+	l, path := newTestLimiter(t, Limits{})
+	_, release := l.Acquire("client")
+	release()
+	l.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state file written without limits configured (stat error: %v)", err)
+	}
+}
+
+func TestLimiterSavesOnlyWhenDirty(t *testing.T) {
+	l, path := newTestLimiter(t, Limits{RequestsPerDay: 10})
+	if err := l.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state file written before any request (stat error: %v)", err)
+	}
+
+	_, release := l.Acquire("client")
+	release()
+	l.Close()
+
+	restored, _ := New(Limits{RequestsPerDay: 10}, Limits{}, path, l.logger)
+	defer restored.Close()
+	if c := restored.clients["client"]; c == nil || c.Daily != 1 {
+		t.Fatalf("restored counter = %+v, want one request counted", c)
+	}
+}
+
+// fakeClock is a settable time source for the limiter.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newClockedLimiter(t *testing.T, perClient, global Limits) (*Limiter, *fakeClock) {
+	t.Helper()
+	l, err := New(perClient, global, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local)}
+	l.now = clock.Now
+	l.globalCtr = l.newCounter(global)
+	return l, clock
+}
+
+func TestLimiterRefillsTokenBucket(t *testing.T) {
+	l, clock := newClockedLimiter(t, Limits{RequestsPerMinute: 60}, Limits{})
+
+	for i := range 60 {
+		if d, _ := l.Acquire("client"); !d.Allowed {
+			t.Fatalf("request %d rejected: %s", i+1, d.Reason)
+		}
+	}
+	d, _ := l.Acquire("client")
+	if d.Allowed || d.Scope != "client" {
+		t.Fatalf("decision = %+v, want the 61st request rejected by the client bucket", d)
+	}
+	if d.RetryAfter != time.Second || d.Limit != 60 || d.Remaining != 0 || d.Reset != time.Minute {
+		t.Errorf("decision = %+v, want retry after 1s, limit 60, none remaining, full reset in 1m", d)
+	}
+
+	clock.Advance(time.Second)
+	d, _ = l.Acquire("client")
+	if !d.Allowed {
+		t.Fatalf("request rejected after a token refilled: %s", d.Reason)
+	}
+	if d, _ := l.Acquire("client"); d.Allowed {
+		t.Error("second request allowed with only one token refilled")
+	}
+
+	clock.Advance(time.Hour)
+	if d, _ := l.Acquire("client"); !d.Allowed || d.Remaining != 59 {
+		t.Errorf("decision = %+v, want a full bucket capped at 60 after an hour", d)
+	}
+}
+
+func TestLimiterRollsDailyQuotaOverAtMidnight(t *testing.T) {
+	l, clock := newClockedLimiter(t, Limits{RequestsPerDay: 2}, Limits{})
+
+	for range 2 {
+		if d, _ := l.Acquire("client"); !d.Allowed {
+			t.Fatalf("request rejected within quota: %s", d.Reason)
+		}
+	}
+	d, _ := l.Acquire("client")
+	if d.Allowed {
+		t.Fatal("third request allowed over a daily quota of 2")
+	}
+	if d.RetryAfter != 14*time.Hour {
+		t.Errorf("retry after %v, want the 14h until midnight", d.RetryAfter)
+	}
+
+	clock.Advance(14 * time.Hour)
+	if d, _ := l.Acquire("client"); !d.Allowed {
+		t.Fatalf("request rejected after midnight: %s", d.Reason)
+	}
+}
+
+func TestLimiterReleasesConcurrentStreams(t *testing.T) {
+	l, _ := newClockedLimiter(t, Limits{ConcurrentStreams: 1}, Limits{})
+
+	d, release := l.Acquire("client")
+	if !d.Allowed {
+		t.Fatalf("first stream rejected: %s", d.Reason)
+	}
+	if d, _ := l.Acquire("client"); d.Allowed {
+		t.Fatal("second concurrent stream allowed with a limit of 1")
+	}
+	if d, release := l.Acquire("other"); !d.Allowed {
+		t.Errorf("another client was rejected: %s", d.Reason)
+	} else {
+		release()
+	}
+
+	release()
+	release()
+	d, release = l.Acquire("client")
+	if !d.Allowed {
+		t.Fatalf("stream rejected after release: %s", d.Reason)
+	}
+	release()
+	if n := l.clients["client"].inFlight; n != 0 {
+		t.Errorf("in flight = %d after releasing twice, want 0", n)
+	}
+}
+
+func TestLimiterScopes(t *testing.T) {
+	t.Run("global", func(t *testing.T) {
+		l, _ := newClockedLimiter(t, Limits{}, Limits{RequestsPerDay: 2})
+		for _, client := range []string{"a", "b"} {
+			if d, _ := l.Acquire(client); !d.Allowed {
+				t.Fatalf("client %s rejected: %s", client, d.Reason)
+			}
+		}
+		if d, _ := l.Acquire("c"); d.Allowed || d.Scope != "global" {
+			t.Errorf("decision = %+v, want client c rejected by the global quota", d)
+		}
+	})
+	t.Run("client", func(t *testing.T) {
+		l, _ := newClockedLimiter(t, Limits{RequestsPerDay: 1}, Limits{RequestsPerDay: 10})
+		if d, _ := l.Acquire("a"); !d.Allowed {
+			t.Fatalf("client a rejected: %s", d.Reason)
+		}
+		if d, _ := l.Acquire("a"); d.Allowed || d.Scope != "client" {
+			t.Errorf("decision = %+v, want client a rejected by its own quota", d)
+		}
+		if d, _ := l.Acquire("b"); !d.Allowed {
+			t.Errorf("client b rejected by client a's quota: %s", d.Reason)
+		}
+	})
+}
+
+func TestLimiterPrunesClientsWithoutLimits(t *testing.T) {
+	l, _ := newTestLimiter(t, Limits{})
+	defer l.Close()
+	for i := range 100 {
+		_, release := l.Acquire(fmt.Sprintf("addr:10.0.0.%d", i))
+		release()
+	}
+	_, release := l.Acquire("busy")
+	defer release()
+
+	if err := l.save(); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.clients) != 1 || l.clients["busy"] == nil {
+		t.Errorf("%d clients kept, want only the one with a request in flight", len(l.clients))
+	}
+}
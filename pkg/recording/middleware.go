@@ -0,0 +1,106 @@
+package recording
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Middleware records the exchanges between clients and the proxy: each
+// request as the client sent it and the response as the client received
+// it, after translation. The request is given an ID that the upstream
+// exchanges it leads to are recorded under.
+type Middleware struct {
+	Recorder *Recorder
+	Logger   *slog.Logger
+}
+
+// Wrap returns next with its exchanges recorded. A response is written
+// once next returns.
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchange := &Exchange{
+			Time:           time.Now(),
+			Boundary:       BoundaryClient,
+			Request:        newRequestID(),
+			Method:         r.Method,
+			URL:            r.URL.String(),
+			Path:           r.URL.Path,
+			RequestHeaders: redactHeaders(r.Header),
+		}
+		if r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				exchange.Error = err.Error()
+			}
+			exchange.RequestBody = string(body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, exchange: exchange}
+		next.ServeHTTP(rec, r.WithContext(WithRequestID(r.Context(), exchange.Request)))
+
+		if !rec.wroteHeader {
+			// net/http answers 200 to a handler that wrote nothing.
+			exchange.Status = http.StatusOK
+			exchange.ResponseHeaders = redactHeaders(w.Header())
+		}
+		exchange.Chunks = rec.chunks.finish()
+		exchange.DurationMS = time.Since(exchange.Time).Milliseconds()
+		if err := m.Recorder.Write(exchange); err != nil && m.Logger != nil {
+			m.Logger.Warn("Failed to record exchange", "path", exchange.Path, "error", err)
+		}
+	})
+}
+
+// newRequestID returns a random client request ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// responseRecorder captures the status, headers and body written to a
+// client.
+type responseRecorder struct {
+	http.ResponseWriter
+	exchange    *Exchange
+	chunks      chunker
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.exchange.Status = status
+	rec.exchange.ResponseHeaders = redactHeaders(rec.Header())
+	rec.chunks.start = time.Now()
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	n, err := rec.ResponseWriter.Write(p)
+	rec.chunks.write(p[:n])
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer does.
+func (rec *responseRecorder) Flush() {
+	rec.WriteHeader(http.StatusOK)
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,271 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// currentFile is the file being written; full files are renamed to
+	// traffic-<time>.jsonl.
+	currentFile   = "traffic.jsonl"
+	rotatedPrefix = "traffic-"
+	rotatedSuffix = ".jsonl"
+)
+
+// Recorder appends exchanges to a JSONL file in a directory, starting a new
+// file once the current one reaches maxBytes and keeping at most maxFiles
+// full ones.
+type Recorder struct {
+	dir      string
+	maxBytes int64
+	maxFiles int
+	logger   *slog.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRecorder creates a recorder writing to dir.
+func NewRecorder(dir string, maxBytes int64, maxFiles int, logger *slog.Logger) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	r := &Recorder{dir: dir, maxBytes: maxBytes, maxFiles: maxFiles, logger: logger}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) open() error {
+	f, err := os.OpenFile(filepath.Join(r.dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open recording file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends e as one line.
+func (r *Recorder) Write(e *Exchange) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return errors.New("recorder is closed")
+	}
+	if r.size > 0 && r.size+int64(len(line)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+// rotate renames the current file and prunes the oldest rotated files.
+// r.mu must be held.
+func (r *Recorder) rotate() error {
+	r.file.Close()
+	r.file = nil
+	rotated := rotatedPrefix + time.Now().UTC().Format("20060102T150405.000000000") + rotatedSuffix
+	if err := os.Rename(filepath.Join(r.dir, currentFile), filepath.Join(r.dir, rotated)); err != nil {
+		return fmt.Errorf("failed to rotate recording file: %w", err)
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+	var old []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, rotatedPrefix) && strings.HasSuffix(name, rotatedSuffix) {
+			old = append(old, name)
+		}
+	}
+	sort.Strings(old)
+	for len(old) > r.maxFiles {
+		if err := os.Remove(filepath.Join(r.dir, old[0])); err != nil {
+			r.logger.Warn("Failed to remove old recording", "file", old[0], "error", err)
+		}
+		old = old[1:]
+	}
+	return r.open()
+}
+
+// Close closes the current file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Transport is an http.RoundTripper that records every exchange it carries.
+// A response is written once its body has been read to the end or closed.
+type Transport struct {
+	Base     http.RoundTripper
+	Recorder *Recorder
+	Logger   *slog.Logger
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := &Exchange{
+		Time:           time.Now(),
+		Boundary:       BoundaryUpstream,
+		Request:        RequestIDFrom(req.Context()),
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		Path:           req.URL.Path,
+		RequestHeaders: redactHeaders(req.Header),
+	}
+	if req.Body != nil {
+		body, err := requestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		exchange.RequestBody = string(body)
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		exchange.DurationMS = time.Since(exchange.Time).Milliseconds()
+		t.write(exchange)
+		return nil, err
+	}
+
+	exchange.Status = resp.StatusCode
+	exchange.ResponseHeaders = redactHeaders(resp.Header)
+	resp.Body = &recordingBody{ReadCloser: resp.Body, transport: t, exchange: exchange, chunks: chunker{start: time.Now()}}
+	return resp, nil
+}
+
+func (t *Transport) write(e *Exchange) {
+	if err := t.Recorder.Write(e); err != nil && t.Logger != nil {
+		t.Logger.Warn("Failed to record exchange", "path", e.Path, "error", err)
+	}
+}
+
+// requestBody reads the body of req without consuming it when possible.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	return io.ReadAll(req.Body)
+}
+
+// recordingBody splits a response body into chunks as it is read and
+// writes the exchange when the body ends.
+type recordingBody struct {
+	io.ReadCloser
+	transport *Transport
+	exchange  *Exchange
+	chunks    chunker
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.chunks.write(p[:n])
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			b.exchange.Error = err.Error()
+		}
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.exchange.Chunks = b.chunks.finish()
+		b.exchange.DurationMS = time.Since(b.exchange.Time).Milliseconds()
+		b.transport.write(b.exchange)
+	})
+}
+
+// chunker splits a body into one chunk per complete server-sent event as
+// it arrives, timed from start. The rest becomes the last chunk.
+type chunker struct {
+	start   time.Time
+	pending []byte
+	chunks  []Chunk
+}
+
+func (c *chunker) write(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	c.pending = append(c.pending, p...)
+	for {
+		i := bytes.Index(c.pending, []byte("\n\n"))
+		if i < 0 {
+			return
+		}
+		c.add(c.pending[:i+2])
+		c.pending = c.pending[i+2:]
+	}
+}
+
+func (c *chunker) add(data []byte) {
+	c.chunks = append(c.chunks, Chunk{
+		OffsetMS: time.Since(c.start).Milliseconds(),
+		Data:     string(data),
+	})
+}
+
+// finish returns the chunks, including any incomplete rest.
+func (c *chunker) finish() []Chunk {
+	if len(c.pending) > 0 {
+		c.add(c.pending)
+		c.pending = nil
+	}
+	return c.chunks
+}
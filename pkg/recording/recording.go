@@ -0,0 +1,89 @@
+// Package recording captures the exchanges between the proxy and Copilot in
+// JSONL files and replays them in place of the network. Both sides are
+// http.RoundTrippers, so they plug into any http.Client. The exchanges with
+// clients can be captured alongside, by wrapping the proxy's handlers, to
+// see how a client request was translated.
+package recording
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of headers that carry credentials.
+const redacted = "[REDACTED]"
+
+// Boundaries an exchange can be recorded at.
+const (
+	// BoundaryUpstream is an exchange between the proxy and Copilot.
+	// Recordings without a boundary are upstream exchanges.
+	BoundaryUpstream = "upstream"
+	// BoundaryClient is an exchange between a client and the proxy.
+	BoundaryClient = "client"
+)
+
+// Exchange is one recorded request and its response. Request identifies
+// the client request an exchange belongs to, so that a client exchange can
+// be matched with the upstream exchanges it led to.
+type Exchange struct {
+	Time            time.Time   `json:"time"`
+	Boundary        string      `json:"boundary,omitempty"`
+	Request         string      `json:"request,omitempty"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Path            string      `json:"path"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	Status          int         `json:"status,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	Chunks          []Chunk     `json:"chunks,omitempty"`
+	DurationMS      int64       `json:"duration_ms"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// Chunk is a piece of the response body. For server-sent events each chunk
+// is one event; other bodies are a single chunk.
+type Chunk struct {
+	// OffsetMS is when the chunk arrived, in milliseconds after the
+	// response headers.
+	OffsetMS int64  `json:"offset_ms"`
+	Data     string `json:"data"`
+}
+
+// redactHeaders returns a copy of h with credentials replaced.
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for name := range out {
+		if isSecretHeader(name) {
+			out[name] = []string{redacted}
+		}
+	}
+	return out
+}
+
+// isSecretHeader reports whether a header may carry a credential.
+func isSecretHeader(name string) bool {
+	lower := strings.ToLower(name)
+	switch lower {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key":
+		return true
+	}
+	return strings.Contains(lower, "token") || strings.Contains(lower, "secret") ||
+		strings.Contains(lower, "password") || strings.HasSuffix(lower, "-key")
+}
+
+type requestIDKey struct{}
+
+// WithRequestID attaches the ID of the client request being served to ctx.
+// Upstream exchanges made with ctx are recorded under it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the client request ID attached to ctx, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,199 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+const sseBody = "data: {\"n\":1}\n\ndata: {\"n\":2}\n\ndata: [DONE]\n\n"
+
+// upstream serves a JSON body on /json and an event stream elsewhere.
+func upstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for event := range strings.SplitAfterSeq(sseBody, "\n\n") {
+			io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type result struct {
+	status      int
+	contentType string
+	body        string
+}
+
+func do(t *testing.T, client *http.Client, method, url, body string) result {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result{resp.StatusCode, resp.Header.Get("Content-Type"), string(data)}
+}
+
+func newRecorder(t *testing.T) (*Recorder, string) {
+	t.Helper()
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, 1<<20, 2, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder, dir
+}
+
+func readExchanges(t *testing.T, dir string) []Exchange {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, currentFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	srv := upstream(t)
+	recorder, dir := newRecorder(t)
+	recordClient := &http.Client{Transport: &Transport{Recorder: recorder, Logger: discard}}
+
+	requests := []struct{ method, path, body string }{
+		{http.MethodPost, "/json", `{"b":2,"a":1}`},
+		{http.MethodPost, "/stream", `{"stream":true}`},
+	}
+	var recorded []result
+	for _, r := range requests {
+		recorded = append(recorded, do(t, recordClient, r.method, srv.URL+r.path, r.body))
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range readExchanges(t, dir) {
+		if e.Boundary != BoundaryUpstream {
+			t.Errorf("boundary = %q, want %q", e.Boundary, BoundaryUpstream)
+		}
+		if got := e.RequestHeaders.Get("Authorization"); got != redacted {
+			t.Errorf("Authorization recorded as %q", got)
+		}
+	}
+
+	player, err := LoadPlayer(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayClient := &http.Client{Transport: player}
+	for i, r := range requests {
+		// Key order does not matter when matching JSON bodies.
+		body := r.body
+		if i == 0 {
+			body = `{"a":1,"b":2}`
+		}
+		if got := do(t, replayClient, r.method, "http://replay.invalid"+r.path, body); got != recorded[i] {
+			t.Errorf("%s: replayed %+v, recorded %+v", r.path, got, recorded[i])
+		}
+	}
+	if recorded[1].body != sseBody {
+		t.Errorf("recorded stream = %q, want %q", recorded[1].body, sseBody)
+	}
+}
+
+func TestMiddlewareRecordsClientExchanges(t *testing.T) {
+	srv := upstream(t)
+	recorder, dir := newRecorder(t)
+	upstreamClient := &http.Client{Transport: &Transport{Recorder: recorder, Logger: discard}}
+
+	// The handler translates the upstream stream, as the Anthropic
+	// endpoint does, so the two boundaries differ.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, srv.URL+"/stream", r.Body)
+		resp, err := upstreamClient.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.ReplaceAll(string(data), "data: ", "event: translated\ndata: "))
+	})
+	proxy := httptest.NewServer((&Middleware{Recorder: recorder, Logger: discard}).Wrap(handler))
+	defer proxy.Close()
+
+	got := do(t, proxy.Client(), http.MethodPost, proxy.URL+"/v1/messages", `{"stream":true}`)
+	recorder.Close()
+
+	exchanges := readExchanges(t, dir)
+	if len(exchanges) != 2 {
+		t.Fatalf("recorded %d exchanges, want 2", len(exchanges))
+	}
+	up, client := exchanges[0], exchanges[1]
+	if up.Boundary != BoundaryUpstream || client.Boundary != BoundaryClient {
+		t.Fatalf("boundaries = %q, %q", up.Boundary, client.Boundary)
+	}
+	if client.Request == "" || up.Request != client.Request {
+		t.Errorf("request IDs = %q (upstream) and %q (client), want the same", up.Request, client.Request)
+	}
+	if client.Path != "/v1/messages" || client.RequestBody != `{"stream":true}` || client.Status != http.StatusOK {
+		t.Errorf("client exchange = %+v", client)
+	}
+	if client.RequestHeaders.Get("Authorization") != redacted {
+		t.Errorf("client Authorization recorded as %q", client.RequestHeaders.Get("Authorization"))
+	}
+	var body strings.Builder
+	for _, chunk := range client.Chunks {
+		body.WriteString(chunk.Data)
+	}
+	if body.String() != got.body || !strings.Contains(got.body, "event: translated") {
+		t.Errorf("client body recorded as %q, client received %q", body.String(), got.body)
+	}
+
+	// Replay only answers from upstream exchanges.
+	player, err := LoadPlayer(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := player.RoundTrip(httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"stream":true}`))); err == nil {
+		t.Error("replayed a client exchange")
+	}
+}
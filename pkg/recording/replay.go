@@ -0,0 +1,211 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineSize bounds one recorded exchange when loading recordings.
+const maxLineSize = 64 << 20
+
+// Player is an http.RoundTripper that answers requests from the recorded
+// upstream exchanges instead of the network. A request matches a recording with the same
+// method, path and body, compared as JSON when both are JSON. Recordings
+// that match the same request are served in order, the last one repeatedly.
+type Player struct {
+	timing bool
+
+	mu        sync.Mutex
+	exchanges map[string][]*Exchange
+	served    map[string]int
+}
+
+// LoadPlayer loads the recordings at path, a JSONL file or a directory of
+// them. With timing set, response chunks are delivered with their recorded
+// delays; otherwise all at once.
+func LoadPlayer(path string, timing bool) (*Player, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		if files, err = recordingFiles(path); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &Player{timing: timing, exchanges: make(map[string][]*Exchange), served: make(map[string]int)}
+	for _, file := range files {
+		if err := p.load(file); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.exchanges) == 0 {
+		return nil, fmt.Errorf("no recorded exchanges in %s", path)
+	}
+	return p, nil
+}
+
+// recordingFiles lists the JSONL files in dir, oldest first: the rotated
+// files by name, then the current one.
+func recordingFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	hasCurrent := false
+	for _, entry := range entries {
+		switch name := entry.Name(); {
+		case entry.IsDir() || !strings.HasSuffix(name, ".jsonl"):
+		case name == currentFile:
+			hasCurrent = true
+		default:
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	if hasCurrent {
+		files = append(files, filepath.Join(dir, currentFile))
+	}
+	return files, nil
+}
+
+func (p *Player) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if e.Boundary == BoundaryClient {
+			// Client exchanges document the proxy's side; only upstream
+			// exchanges are replayed.
+			continue
+		}
+		key := matchKey(e.Method, e.Path, []byte(e.RequestBody))
+		p.exchanges[key] = append(p.exchanges[key], &e)
+	}
+	return scanner.Err()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := matchKey(req.Method, req.URL.Path, body)
+	p.mu.Lock()
+	candidates := p.exchanges[key]
+	var e *Exchange
+	if len(candidates) > 0 {
+		i := min(p.served[key], len(candidates)-1)
+		p.served[key]++
+		e = candidates[i]
+	}
+	p.mu.Unlock()
+
+	if e == nil {
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL.Path)
+	}
+	if e.Status == 0 {
+		return nil, errors.New(e.Error)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.ResponseHeaders.Clone(),
+		Body:          &replayBody{req: req, chunks: e.Chunks, timing: p.timing, start: time.Now()},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// matchKey identifies the requests a recording answers.
+func matchKey(method, path string, body []byte) string {
+	return method + " " + path + "\n" + canonicalBody(body)
+}
+
+// canonicalBody re-encodes a JSON body so that key order and whitespace do
+// not affect matching. Other bodies are used as they are.
+func canonicalBody(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return string(body)
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(canonical)
+}
+
+// replayBody serves recorded chunks, optionally at their recorded pace.
+type replayBody struct {
+	req    *http.Request
+	chunks []Chunk
+	timing bool
+	start  time.Time
+	buf    []byte
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if b.timing {
+			if wait := time.Until(b.start.Add(time.Duration(chunk.OffsetMS) * time.Millisecond)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-b.req.Context().Done():
+					timer.Stop()
+					return 0, b.req.Context().Err()
+				}
+			}
+		}
+		b.buf = []byte(chunk.Data)
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
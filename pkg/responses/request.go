@@ -0,0 +1,210 @@
+package responses
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// DecodeRequest parses and minimally validates a Responses API request body.
+func DecodeRequest(body []byte) (*Request, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("model: field required")
+	}
+	if len(req.Input) == 0 && req.PreviousResponseID == "" {
+		return nil, fmt.Errorf("input: field required")
+	}
+	return &req, nil
+}
+
+// ToChatCompletion converts a Responses request into a chat completions
+// request. history holds the conversation of the response referenced by
+// previous_response_id, if any. The returned conversation is history plus
+// the new input, without instructions, and is what should be stored for
+// later chaining.
+func ToChatCompletion(req *Request, history []openai.Message) (*openai.ChatCompletionRequest, []openai.Message, error) {
+	conversation := append([]openai.Message(nil), history...)
+	for i, item := range req.Input {
+		msg, err := convertInputItem(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("input[%d]: %w", i, err)
+		}
+		conversation = appendMessage(conversation, msg)
+	}
+
+	out := &openai.ChatCompletionRequest{
+		Model:             req.Model,
+		MaxTokens:         req.MaxOutputTokens,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		ParallelToolCalls: req.ParallelToolCalls,
+		User:              req.User,
+	}
+	if req.Stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.Instructions != "" {
+		out.Messages = append(out.Messages, openai.Message{Role: "system", Content: req.Instructions})
+	}
+	out.Messages = append(out.Messages, conversation...)
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, nil, fmt.Errorf("tools: unsupported tool type %q", tool.Type)
+		}
+		out.Tools = append(out.Tools, openai.Tool{
+			Type: "function",
+			Function: openai.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	if len(req.ToolChoice) > 0 && len(out.Tools) > 0 {
+		choice, err := convertToolChoice(req.ToolChoice)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.ToolChoice = choice
+	}
+
+	if req.Text != nil && len(req.Text.Format) > 0 {
+		format, err := convertTextFormat(req.Text.Format)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.ResponseFormat = format
+	}
+
+	return out, conversation, nil
+}
+
+func convertInputItem(item InputItem) (openai.Message, error) {
+	switch item.Type {
+	case "", "message":
+		return convertMessage(item)
+	case "function_call":
+		return openai.Message{
+			Role: "assistant",
+			ToolCalls: []openai.ToolCall{{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: openai.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}},
+		}, nil
+	case "function_call_output":
+		return openai.Message{Role: "tool", ToolCallID: item.CallID, Content: item.Output}, nil
+	default:
+		return openai.Message{}, fmt.Errorf("unsupported item type %q", item.Type)
+	}
+}
+
+func convertMessage(item InputItem) (openai.Message, error) {
+	role := item.Role
+	switch role {
+	case "user", "assistant", "system":
+	case "developer":
+		role = "system"
+	default:
+		return openai.Message{}, fmt.Errorf("unsupported role %q", item.Role)
+	}
+
+	var parts []openai.ContentPart
+	hasImage := false
+	for _, part := range item.Content {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			parts = append(parts, openai.ContentPart{Type: "text", Text: part.Text})
+		case "input_image":
+			if part.ImageURL == "" {
+				return openai.Message{}, fmt.Errorf("input_image without image_url is not supported")
+			}
+			parts = append(parts, openai.ContentPart{
+				Type:     "image_url",
+				ImageURL: &openai.ImageURL{URL: part.ImageURL, Detail: part.Detail},
+			})
+			hasImage = true
+		case "refusal":
+		default:
+			return openai.Message{}, fmt.Errorf("unsupported content type %q", part.Type)
+		}
+	}
+
+	msg := openai.Message{Role: role}
+	if hasImage {
+		msg.Content = parts
+	} else {
+		text := make([]string, 0, len(parts))
+		for _, part := range parts {
+			text = append(text, part.Text)
+		}
+		msg.Content = strings.Join(text, "\n\n")
+	}
+	return msg, nil
+}
+
+// appendMessage adds msg to messages, folding consecutive function calls
+// into a single assistant message as chat completions expects.
+func appendMessage(messages []openai.Message, msg openai.Message) []openai.Message {
+	if n := len(messages); n > 0 && len(msg.ToolCalls) > 0 && msg.Content == nil {
+		last := &messages[n-1]
+		if last.Role == "assistant" && len(last.ToolCalls) > 0 {
+			last.ToolCalls = append(last.ToolCalls, msg.ToolCalls...)
+			return messages
+		}
+		if last.Role == "assistant" && last.ToolCalls == nil {
+			last.ToolCalls = msg.ToolCalls
+			return messages
+		}
+	}
+	return append(messages, msg)
+}
+
+func convertToolChoice(raw json.RawMessage) (any, error) {
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		return mode, nil
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil {
+		return nil, fmt.Errorf("tool_choice: %w", err)
+	}
+	if choice.Type != "function" {
+		return nil, fmt.Errorf("tool_choice: unsupported type %q", choice.Type)
+	}
+	return map[string]any{
+		"type":     "function",
+		"function": map[string]string{"name": choice.Name},
+	}, nil
+}
+
+// convertTextFormat maps the Responses text.format object onto the chat
+// completions response_format, which nests json_schema options differently.
+func convertTextFormat(raw json.RawMessage) (json.RawMessage, error) {
+	var format map[string]any
+	if err := json.Unmarshal(raw, &format); err != nil {
+		return nil, fmt.Errorf("text.format: %w", err)
+	}
+	if format["type"] != "json_schema" {
+		return raw, nil
+	}
+	schema := map[string]any{}
+	for key, value := range format {
+		if key != "type" {
+			schema[key] = value
+		}
+	}
+	return json.Marshal(map[string]any{"type": "json_schema", "json_schema": schema})
+}
@@ -0,0 +1,127 @@
+package responses
+
+import (
+	"encoding/json"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+func messagesJSON(t *testing.T, messages []openai.Message) string {
+	t.Helper()
+	data, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestToChatCompletionInput(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			"string input",
+			`{"model":"m","input":"hello"}`,
+			`[{"role":"user","content":"hello"}]`,
+		},
+		{
+			"message list with string and part content",
+			`{"model":"m","input":[
+				{"role":"developer","content":"be brief"},
+				{"type":"message","role":"user","content":[{"type":"input_text","text":"one"},{"type":"input_text","text":"two"}]}
+			]}`,
+			`[{"role":"system","content":"be brief"},{"role":"user","content":"one\n\ntwo"}]`,
+		},
+		{
+			"image content",
+			`{"model":"m","input":[{"role":"user","content":[{"type":"input_text","text":"what is this"},{"type":"input_image","image_url":"https://example.com/a.png"}]}]}`,
+			`[{"role":"user","content":[{"type":"text","text":"what is this"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]`,
+		},
+		{
+			"function calls folded into one assistant message",
+			`{"model":"m","input":[
+				{"role":"user","content":"weather in Paris and Rome?"},
+				{"type":"function_call","call_id":"call_1","name":"weather","arguments":"{\"city\":\"Paris\"}"},
+				{"type":"function_call","call_id":"call_2","name":"weather","arguments":"{\"city\":\"Rome\"}"},
+				{"type":"function_call_output","call_id":"call_1","output":"sunny"},
+				{"type":"function_call_output","call_id":"call_2","output":"rain"}
+			]}`,
+			`[{"role":"user","content":"weather in Paris and Rome?"},` +
+				`{"role":"assistant","tool_calls":[` +
+				`{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}},` +
+				`{"id":"call_2","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Rome\"}"}}]},` +
+				`{"role":"tool","content":"sunny","tool_call_id":"call_1"},` +
+				`{"role":"tool","content":"rain","tool_call_id":"call_2"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := DecodeRequest([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chatReq, conversation, err := ToChatCompletion(req, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := messagesJSON(t, chatReq.Messages); got != tt.want {
+				t.Errorf("messages = %s\nwant %s", got, tt.want)
+			}
+			if got := messagesJSON(t, conversation); got != tt.want {
+				t.Errorf("conversation = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToChatCompletionChainsHistory(t *testing.T) {
+	history := []openai.Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "hi there"},
+	}
+	req, err := DecodeRequest([]byte(`{"model":"m","instructions":"be brief","previous_response_id":"resp_1","input":"again"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatReq, conversation, err := ToChatCompletion(req, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"role":"system","content":"be brief"},{"role":"user","content":"hello"},{"role":"assistant","content":"hi there"},{"role":"user","content":"again"}]`
+	if got := messagesJSON(t, chatReq.Messages); got != want {
+		t.Errorf("messages = %s\nwant %s", got, want)
+	}
+	// Instructions apply to one request only and are not carried forward.
+	want = `[{"role":"user","content":"hello"},{"role":"assistant","content":"hi there"},{"role":"user","content":"again"}]`
+	if got := messagesJSON(t, conversation); got != want {
+		t.Errorf("conversation = %s\nwant %s", got, want)
+	}
+	if len(history) != 2 {
+		t.Errorf("history grew to %d messages", len(history))
+	}
+}
+
+func TestDecodeRequestValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"input", `{"model":"m","input":"hi"}`, true},
+		{"previous response without input", `{"model":"m","previous_response_id":"resp_1"}`, true},
+		{"missing model", `{"input":"hi"}`, false},
+		{"missing input", `{"model":"m"}`, false},
+		{"malformed input", `{"model":"m","input":42}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeRequest([]byte(tt.body)); (err == nil) != tt.ok {
+				t.Errorf("DecodeRequest error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
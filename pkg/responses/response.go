@@ -0,0 +1,157 @@
+package responses
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// NewID returns a random identifier with the given prefix, e.g. "resp".
+func NewID(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return prefix + "_" + hex.EncodeToString(b)
+}
+
+// newResponse builds the response skeleton echoing the request parameters.
+func newResponse(id string, req *Request) *Response {
+	resp := &Response{
+		ID:                id,
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Status:            "in_progress",
+		Model:             req.Model,
+		Output:            []OutputItem{},
+		Tools:             req.Tools,
+		ToolChoice:        req.ToolChoice,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		ParallelToolCalls: req.ParallelToolCalls == nil || *req.ParallelToolCalls,
+		Metadata:          req.Metadata,
+	}
+	if resp.Tools == nil {
+		resp.Tools = []Tool{}
+	}
+	if len(resp.ToolChoice) == 0 {
+		resp.ToolChoice = json.RawMessage(`"auto"`)
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]any{}
+	}
+	if req.Instructions != "" {
+		resp.Instructions = &req.Instructions
+	}
+	if req.PreviousResponseID != "" {
+		resp.PreviousResponseID = &req.PreviousResponseID
+	}
+	if req.MaxOutputTokens > 0 {
+		resp.MaxOutputTokens = &req.MaxOutputTokens
+	}
+	return resp
+}
+
+// FromChatCompletion converts a non-streamed chat completions response into
+// a completed Responses API response with the given id.
+func FromChatCompletion(id string, req *Request, chatResp *openai.ChatCompletionResponse) *Response {
+	resp := newResponse(id, req)
+
+	finishReason := ""
+	for _, choice := range chatResp.Choices {
+		if choice.Message.Content != "" {
+			resp.Output = append(resp.Output, messageItem(NewID("msg"), choice.Message.Content))
+		}
+		for _, call := range choice.Message.ToolCalls {
+			resp.Output = append(resp.Output, functionCallItem(call.ID, call.Function.Name, call.Function.Arguments))
+		}
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+	}
+
+	complete(resp, finishReason, chatResp.Usage)
+	return resp
+}
+
+// complete marks resp as finished according to the upstream finish reason.
+func complete(resp *Response, finishReason string, usage *openai.Usage) {
+	resp.Status = "completed"
+	if finishReason == "length" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &IncompleteDetails{Reason: "max_output_tokens"}
+	}
+	if finishReason == "content_filter" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &IncompleteDetails{Reason: "content_filter"}
+	}
+	if usage != nil {
+		resp.Usage = usageFrom(usage)
+	}
+}
+
+func messageItem(id, text string) OutputItem {
+	return OutputItem{
+		Type:    "message",
+		ID:      id,
+		Status:  "completed",
+		Role:    "assistant",
+		Content: []OutputContent{{Type: "output_text", Text: text, Annotations: []any{}}},
+	}
+}
+
+func functionCallItem(callID, name, arguments string) OutputItem {
+	return OutputItem{
+		Type:      "function_call",
+		ID:        "fc_" + callID,
+		Status:    "completed",
+		CallID:    callID,
+		Name:      name,
+		Arguments: arguments,
+	}
+}
+
+func usageFrom(u *openai.Usage) *Usage {
+	usage := &Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		TotalTokens:  u.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	if u.PromptTokensDetails != nil {
+		usage.InputTokensDetails.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		usage.OutputTokensDetails.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+// OutputMessages converts a response's output into the chat messages that
+// continue the conversation when the response is chained.
+func OutputMessages(output []OutputItem) []openai.Message {
+	var messages []openai.Message
+	for _, item := range output {
+		switch item.Type {
+		case "message":
+			var text string
+			for _, part := range item.Content {
+				text += part.Text
+			}
+			messages = appendMessage(messages, openai.Message{Role: "assistant", Content: text})
+		case "function_call":
+			messages = appendMessage(messages, openai.Message{
+				Role: "assistant",
+				ToolCalls: []openai.ToolCall{{
+					ID:       item.CallID,
+					Type:     "function",
+					Function: openai.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+				}},
+			})
+		}
+	}
+	return messages
+}
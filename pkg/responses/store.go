@@ -0,0 +1,81 @@
+package responses
+
+import (
+	"sync"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// storedResponse is what the store keeps for each response.
+type storedResponse struct {
+	response     *Response
+	conversation []openai.Message
+}
+
+// Store keeps recent responses in memory so that requests can chain onto
+// them with previous_response_id. Once full, the oldest entry is evicted.
+type Store struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]storedResponse
+	order      []string
+}
+
+// NewStore creates a store that holds at most maxEntries responses.
+func NewStore(maxEntries int) *Store {
+	return &Store{
+		maxEntries: maxEntries,
+		entries:    make(map[string]storedResponse),
+	}
+}
+
+// Put records resp together with the full conversation that produced it,
+// including the response's own output.
+func (s *Store) Put(resp *Response, conversation []openai.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[resp.ID]; !exists {
+		s.order = append(s.order, resp.ID)
+	}
+	s.entries[resp.ID] = storedResponse{response: resp, conversation: conversation}
+
+	for len(s.order) > s.maxEntries {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a stored response by id.
+func (s *Store) Get(id string) (*Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[id]
+	return entry.response, ok
+}
+
+// Conversation returns the chat history to continue from when a request
+// names id as its previous_response_id.
+func (s *Store) Conversation(id string) ([]openai.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[id]
+	return entry.conversation, ok
+}
+
+// Delete removes a stored response.
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		return false
+	}
+	delete(s.entries, id)
+	for i, entry := range s.order {
+		if entry == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
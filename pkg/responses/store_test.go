@@ -0,0 +1,49 @@
+package responses
+
+import (
+	"fmt"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+func TestStoreEvictsOldest(t *testing.T) {
+	const capacity = 1000
+	store := NewStore(capacity)
+	for i := range capacity + 1 {
+		store.Put(&Response{ID: fmt.Sprintf("resp_%d", i)}, []openai.Message{{Role: "user", Content: "hi"}})
+	}
+
+	if _, ok := store.Get("resp_0"); ok {
+		t.Error("oldest response kept beyond capacity")
+	}
+	if _, ok := store.Conversation("resp_0"); ok {
+		t.Error("oldest conversation kept beyond capacity")
+	}
+	for _, id := range []string{"resp_1", fmt.Sprintf("resp_%d", capacity)} {
+		if _, ok := store.Get(id); !ok {
+			t.Errorf("%s evicted, want it kept", id)
+		}
+	}
+	if n := len(store.order); n != capacity {
+		t.Errorf("store tracks %d entries, want %d", n, capacity)
+	}
+}
+
+func TestStoreReplaceAndDelete(t *testing.T) {
+	store := NewStore(2)
+	store.Put(&Response{ID: "a", Status: "in_progress"}, nil)
+	store.Put(&Response{ID: "a", Status: "completed"}, nil)
+	store.Put(&Response{ID: "b"}, nil)
+
+	if resp, ok := store.Get("a"); !ok || resp.Status != "completed" {
+		t.Errorf("Get(a) = %+v, %v; want the replacement kept without evicting it", resp, ok)
+	}
+	if !store.Delete("a") || store.Delete("a") {
+		t.Error("Delete should succeed once")
+	}
+	store.Put(&Response{ID: "c"}, nil)
+	if _, ok := store.Get("b"); !ok {
+		t.Error("b evicted although a deletion made room")
+	}
+}
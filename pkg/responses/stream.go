@@ -0,0 +1,231 @@
+package responses
+
+import (
+	"strings"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// Event is a single Responses API streaming event. Data always carries the
+// event type and a sequence number.
+type Event struct {
+	Name string
+	Data map[string]any
+}
+
+// streamItem tracks one output item while it is being streamed.
+type streamItem struct {
+	item        OutputItem
+	outputIndex int
+	text        strings.Builder
+	done        bool
+}
+
+// StreamTranslator converts chat completion chunks into Responses streaming
+// events such as response.output_text.delta and response.completed.
+type StreamTranslator struct {
+	resp         *Response
+	sequence     int
+	started      bool
+	items        []*streamItem
+	textItem     *streamItem
+	toolItems    map[int]*streamItem
+	finishReason string
+	usage        *openai.Usage
+}
+
+// NewStreamTranslator creates a translator for a response with the given id.
+func NewStreamTranslator(id string, req *Request) *StreamTranslator {
+	return &StreamTranslator{
+		resp:      newResponse(id, req),
+		toolItems: make(map[int]*streamItem),
+	}
+}
+
+// Start returns the events announcing the response.
+func (t *StreamTranslator) Start() []Event {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	snapshot := *t.resp
+	return []Event{
+		t.event("response.created", map[string]any{"response": &snapshot}),
+		t.event("response.in_progress", map[string]any{"response": &snapshot}),
+	}
+}
+
+// HandleChunk returns the events produced by one upstream chunk.
+func (t *StreamTranslator) HandleChunk(chunk *openai.ChatCompletionChunk) []Event {
+	events := t.Start()
+
+	if chunk.Usage != nil {
+		t.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if t.textItem == nil {
+				events = append(events, t.openText()...)
+			}
+			t.textItem.text.WriteString(choice.Delta.Content)
+			events = append(events, t.event("response.output_text.delta", map[string]any{
+				"item_id":       t.textItem.item.ID,
+				"output_index":  t.textItem.outputIndex,
+				"content_index": 0,
+				"delta":         choice.Delta.Content,
+			}))
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			index := 0
+			if call.Index != nil {
+				index = *call.Index
+			}
+			item, ok := t.toolItems[index]
+			if !ok {
+				events = append(events, t.closeText()...)
+				item = t.addItem(OutputItem{
+					Type:   "function_call",
+					ID:     "fc_" + call.ID,
+					Status: "in_progress",
+					CallID: call.ID,
+					Name:   call.Function.Name,
+				})
+				t.toolItems[index] = item
+				events = append(events, t.itemAdded(item))
+			}
+			if call.Function.Arguments != "" {
+				item.text.WriteString(call.Function.Arguments)
+				events = append(events, t.event("response.function_call_arguments.delta", map[string]any{
+					"item_id":      item.item.ID,
+					"output_index": item.outputIndex,
+					"delta":        call.Function.Arguments,
+				}))
+			}
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+// Finish closes all open items and returns the final events together with
+// the completed response.
+func (t *StreamTranslator) Finish() ([]Event, *Response) {
+	events := t.Start()
+	events = append(events, t.closeText()...)
+	for _, item := range t.items {
+		if item.done {
+			continue
+		}
+		item.done = true
+		item.item.Status = "completed"
+		item.item.Arguments = item.text.String()
+		events = append(events,
+			t.event("response.function_call_arguments.done", map[string]any{
+				"item_id":      item.item.ID,
+				"output_index": item.outputIndex,
+				"arguments":    item.item.Arguments,
+			}),
+			t.event("response.output_item.done", map[string]any{
+				"output_index": item.outputIndex,
+				"item":         item.item,
+			}),
+		)
+	}
+
+	for _, item := range t.items {
+		t.resp.Output = append(t.resp.Output, item.item)
+	}
+	complete(t.resp, t.finishReason, t.usage)
+
+	name := "response.completed"
+	if t.resp.Status == "incomplete" {
+		name = "response.incomplete"
+	}
+	events = append(events, t.event(name, map[string]any{"response": t.resp}))
+	return events, t.resp
+}
+
+// Fail returns the events reporting that the stream broke part-way through.
+func (t *StreamTranslator) Fail(message string) []Event {
+	events := t.Start()
+	t.resp.Status = "failed"
+	t.resp.Error = &Error{Code: "server_error", Message: message}
+	return append(events, t.event("response.failed", map[string]any{"response": t.resp}))
+}
+
+func (t *StreamTranslator) openText() []Event {
+	item := t.addItem(OutputItem{
+		Type:    "message",
+		ID:      NewID("msg"),
+		Status:  "in_progress",
+		Role:    "assistant",
+		Content: []OutputContent{},
+	})
+	t.textItem = item
+	return []Event{
+		t.itemAdded(item),
+		t.event("response.content_part.added", map[string]any{
+			"item_id":       item.item.ID,
+			"output_index":  item.outputIndex,
+			"content_index": 0,
+			"part":          OutputContent{Type: "output_text", Text: "", Annotations: []any{}},
+		}),
+	}
+}
+
+func (t *StreamTranslator) closeText() []Event {
+	item := t.textItem
+	if item == nil {
+		return nil
+	}
+	t.textItem = nil
+	item.done = true
+
+	text := item.text.String()
+	part := OutputContent{Type: "output_text", Text: text, Annotations: []any{}}
+	item.item.Status = "completed"
+	item.item.Content = []OutputContent{part}
+	return []Event{
+		t.event("response.output_text.done", map[string]any{
+			"item_id":       item.item.ID,
+			"output_index":  item.outputIndex,
+			"content_index": 0,
+			"text":          text,
+		}),
+		t.event("response.content_part.done", map[string]any{
+			"item_id":       item.item.ID,
+			"output_index":  item.outputIndex,
+			"content_index": 0,
+			"part":          part,
+		}),
+		t.event("response.output_item.done", map[string]any{
+			"output_index": item.outputIndex,
+			"item":         item.item,
+		}),
+	}
+}
+
+func (t *StreamTranslator) addItem(item OutputItem) *streamItem {
+	s := &streamItem{item: item, outputIndex: len(t.items)}
+	t.items = append(t.items, s)
+	return s
+}
+
+func (t *StreamTranslator) itemAdded(item *streamItem) Event {
+	return t.event("response.output_item.added", map[string]any{
+		"output_index": item.outputIndex,
+		"item":         item.item,
+	})
+}
+
+func (t *StreamTranslator) event(name string, data map[string]any) Event {
+	data["type"] = name
+	data["sequence_number"] = t.sequence
+	t.sequence++
+	return Event{Name: name, Data: data}
+}
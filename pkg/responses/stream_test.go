@@ -0,0 +1,103 @@
+package responses
+
+import (
+	"slices"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+func textChunk(text string) *openai.ChatCompletionChunk {
+	return &openai.ChatCompletionChunk{Choices: []openai.ChunkChoice{{Delta: openai.Delta{Content: text}}}}
+}
+
+func toolChunk(index int, id, name, arguments string) *openai.ChatCompletionChunk {
+	return &openai.ChatCompletionChunk{Choices: []openai.ChunkChoice{{Delta: openai.Delta{ToolCalls: []openai.ToolCall{{
+		Index:    &index,
+		ID:       id,
+		Function: openai.FunctionCall{Name: name, Arguments: arguments},
+	}}}}}}
+}
+
+func TestStreamTranslatorEventSequence(t *testing.T) {
+	translator := NewStreamTranslator("resp_1", &Request{Model: "m"})
+	stop := "tool_calls"
+
+	var events []Event
+	events = append(events, translator.Start()...)
+	events = append(events, translator.HandleChunk(textChunk("Let me "))...)
+	events = append(events, translator.HandleChunk(textChunk("check."))...)
+	events = append(events, translator.HandleChunk(toolChunk(0, "call_1", "weather", `{"city":`))...)
+	events = append(events, translator.HandleChunk(toolChunk(0, "", "", `"Paris"}`))...)
+	events = append(events, translator.HandleChunk(&openai.ChatCompletionChunk{
+		Choices: []openai.ChunkChoice{{FinishReason: &stop}},
+		Usage:   &openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})...)
+	final, resp := translator.Finish()
+	events = append(events, final...)
+
+	var names []string
+	for i, event := range events {
+		names = append(names, event.Name)
+		if event.Data["type"] != event.Name || event.Data["sequence_number"] != i {
+			t.Errorf("event %d %s: type %v, sequence_number %v", i, event.Name, event.Data["type"], event.Data["sequence_number"])
+		}
+	}
+	want := []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}
+	if !slices.Equal(names, want) {
+		t.Fatalf("events:\n%v\nwant:\n%v", names, want)
+	}
+	if text := events[6].Data["text"]; text != "Let me check." {
+		t.Errorf("output_text.done text = %q", text)
+	}
+	if args := events[12].Data["arguments"]; args != `{"city":"Paris"}` {
+		t.Errorf("function_call_arguments.done arguments = %q", args)
+	}
+
+	if resp.Status != "completed" || len(resp.Output) != 2 {
+		t.Fatalf("response = %+v, want completed with a message and a function call", resp)
+	}
+	if msg := resp.Output[0]; msg.Type != "message" || msg.Content[0].Text != "Let me check." {
+		t.Errorf("output[0] = %+v", msg)
+	}
+	if call := resp.Output[1]; call.Type != "function_call" || call.CallID != "call_1" || call.Name != "weather" || call.Arguments != `{"city":"Paris"}` || call.Status != "completed" {
+		t.Errorf("output[1] = %+v", call)
+	}
+	if resp.Usage == nil || resp.Usage.InputTokens != 10 || resp.Usage.OutputTokens != 5 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestStreamTranslatorIncompleteAndFailed(t *testing.T) {
+	length := "length"
+	translator := NewStreamTranslator("resp_1", &Request{Model: "m"})
+	translator.HandleChunk(textChunk("cut"))
+	translator.HandleChunk(&openai.ChatCompletionChunk{Choices: []openai.ChunkChoice{{FinishReason: &length}}})
+	events, resp := translator.Finish()
+	if last := events[len(events)-1].Name; last != "response.incomplete" || resp.IncompleteDetails == nil || resp.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("last event %s, response %+v; want incomplete for max_output_tokens", last, resp)
+	}
+
+	translator = NewStreamTranslator("resp_2", &Request{Model: "m"})
+	translator.HandleChunk(textChunk("partial"))
+	events = translator.Fail("upstream went away")
+	if last := events[len(events)-1]; last.Name != "response.failed" || last.Data["response"].(*Response).Error.Message != "upstream went away" {
+		t.Errorf("last event = %+v, want response.failed with the message", last)
+	}
+}
@@ -0,0 +1,176 @@
+package responses
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Request is an OpenAI Responses API request.
+type Request struct {
+	Model              string          `json:"model"`
+	Input              Input           `json:"input"`
+	Instructions       string          `json:"instructions,omitempty"`
+	Tools              []Tool          `json:"tools,omitempty"`
+	ToolChoice         json.RawMessage `json:"tool_choice,omitempty"`
+	PreviousResponseID string          `json:"previous_response_id,omitempty"`
+	Stream             bool            `json:"stream,omitempty"`
+	Store              *bool           `json:"store,omitempty"`
+	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"top_p,omitempty"`
+	MaxOutputTokens    int             `json:"max_output_tokens,omitempty"`
+	ParallelToolCalls  *bool           `json:"parallel_tool_calls,omitempty"`
+	Metadata           map[string]any  `json:"metadata,omitempty"`
+	User               string          `json:"user,omitempty"`
+	Text               *TextConfig     `json:"text,omitempty"`
+}
+
+// TextConfig configures the format of text output.
+type TextConfig struct {
+	Format json.RawMessage `json:"format,omitempty"`
+}
+
+// Input is the request input, which is either a plain string or a list of
+// input items.
+type Input []InputItem
+
+// UnmarshalJSON accepts both the string and the item list form.
+func (in *Input) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*in = []InputItem{{Role: "user", Content: InputContent{{Type: "input_text", Text: text}}}}
+		return nil
+	}
+	var items []InputItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("invalid input: %w", err)
+	}
+	*in = items
+	return nil
+}
+
+// InputItem is a message, a function call, or a function call output.
+type InputItem struct {
+	Type string `json:"type,omitempty"`
+
+	// message
+	Role    string       `json:"role,omitempty"`
+	Content InputContent `json:"content,omitempty"`
+
+	// function_call and function_call_output
+	ID        string `json:"id,omitempty"`
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// InputContent is a message's content, which is either a plain string or a
+// list of content parts.
+type InputContent []ContentPart
+
+// UnmarshalJSON accepts both the string and the part list form.
+func (c *InputContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = []ContentPart{{Type: "input_text", Text: text}}
+		return nil
+	}
+	var parts []ContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("invalid content: %w", err)
+	}
+	*c = parts
+	return nil
+}
+
+// ContentPart is one element of an input or output message.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// OutputContent is one element of an output message.
+type OutputContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// Tool is a tool definition. Only function tools are supported.
+type Tool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// Response is a Responses API response object.
+type Response struct {
+	ID                 string             `json:"id"`
+	Object             string             `json:"object"`
+	CreatedAt          int64              `json:"created_at"`
+	Status             string             `json:"status"`
+	Model              string             `json:"model"`
+	Output             []OutputItem       `json:"output"`
+	Instructions       *string            `json:"instructions"`
+	PreviousResponseID *string            `json:"previous_response_id"`
+	Tools              []Tool             `json:"tools"`
+	ToolChoice         json.RawMessage    `json:"tool_choice,omitempty"`
+	Temperature        *float64           `json:"temperature"`
+	TopP               *float64           `json:"top_p"`
+	MaxOutputTokens    *int               `json:"max_output_tokens"`
+	ParallelToolCalls  bool               `json:"parallel_tool_calls"`
+	Metadata           map[string]any     `json:"metadata"`
+	Usage              *Usage             `json:"usage"`
+	IncompleteDetails  *IncompleteDetails `json:"incomplete_details"`
+	Error              *Error             `json:"error"`
+}
+
+// OutputItem is one item of a response's output.
+type OutputItem struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+
+	// message
+	Role    string          `json:"role,omitempty"`
+	Content []OutputContent `json:"content,omitempty"`
+
+	// function_call
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Usage reports token counts in Responses API terms.
+type Usage struct {
+	InputTokens         int                 `json:"input_tokens"`
+	OutputTokens        int                 `json:"output_tokens"`
+	TotalTokens         int                 `json:"total_tokens"`
+	InputTokensDetails  InputTokensDetails  `json:"input_tokens_details"`
+	OutputTokensDetails OutputTokensDetails `json:"output_tokens_details"`
+}
+
+// InputTokensDetails breaks down input token usage.
+type InputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// OutputTokensDetails breaks down output token usage.
+type OutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// IncompleteDetails explains why a response is incomplete.
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// Error describes a failure while generating a response.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,343 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; further spans are
+	// dropped.
+	queueSize = 2048
+	// batchSize is the largest number of spans sent in one export.
+	batchSize = 512
+	// flushInterval is how often queued spans are exported.
+	flushInterval = 5 * time.Second
+	// exportTimeout bounds a single export.
+	exportTimeout = 10 * time.Second
+)
+
+// Exporter sends a batch of encoded spans somewhere. payload is an OTLP
+// ExportTraceServiceRequest in JSON.
+type Exporter interface {
+	Export(ctx context.Context, payload []byte) error
+	Close() error
+}
+
+// Tracer batches finished spans and hands them to an exporter.
+type Tracer struct {
+	exporter Exporter
+	service  string
+	logger   *slog.Logger
+
+	queue  chan *Span
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewTracer creates a tracer that exports spans on behalf of service.
+func NewTracer(exporter Exporter, service string, logger *slog.Logger) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		service:  service,
+		logger:   logger,
+		queue:    make(chan *Span, queueSize),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		t.mu.Lock()
+		t.dropped++
+		t.mu.Unlock()
+	}
+}
+
+// Shutdown exports the remaining spans and closes the exporter.
+func (t *Tracer) Shutdown() error {
+	close(t.stopCh)
+	<-t.doneCh
+	return t.exporter.Close()
+}
+
+func (t *Tracer) loop() {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		for len(batch) > 0 {
+			n := min(len(batch), batchSize)
+			t.export(batch[:n])
+			batch = batch[n:]
+		}
+		batch = nil
+
+		t.mu.Lock()
+		dropped := t.dropped
+		t.dropped = 0
+		t.mu.Unlock()
+		if dropped > 0 {
+			t.logger.Warn("Trace export queue full, spans dropped", "dropped", dropped)
+		}
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stopCh:
+		drain:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					break drain
+				}
+			}
+			flush()
+			return
+		}
+	}
+}
+
+func (t *Tracer) export(spans []*Span) {
+	payload, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		t.logger.Error("Failed to encode spans", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	if err := t.exporter.Export(ctx, payload); err != nil {
+		t.logger.Warn("Failed to export spans", "spans", len(spans), "error", err)
+	}
+}
+
+// OTLP/JSON encoding. IDs are hex strings and 64-bit integers are decimal
+// strings, as the OTLP JSON mapping requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr  `json:"attributes,omitempty"`
+	Events            []otlpEvent `json:"events,omitempty"`
+	Status            otlpStatus  `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func (t *Tracer) encode(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        encodeAttrs(s.attrs),
+			Status:            otlpStatus{Code: s.statusCode, Message: s.statusMessage},
+		}
+		if s.parent != (SpanID{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for _, e := range s.events {
+			span.Events = append(span.Events, otlpEvent{TimeUnixNano: unixNano(e.Time), Name: e.Name, Attributes: encodeAttrs(e.Attrs)})
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttrs([]Attr{String("service.name", t.service)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: t.service}, Spans: out}},
+	}}}
+}
+
+func encodeAttrs(attrs []Attr) []otlpAttr {
+	out := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var value map[string]any
+		switch v := a.Value.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, otlpAttr{Key: a.Key, Value: value})
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector using the JSON
+// encoding.
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPExporter creates an exporter that posts spans to url as given, as
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used. Use TracesURL to derive the
+// URL from a collector base endpoint.
+func NewOTLPExporter(url string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{url: url, headers: headers, client: &http.Client{Timeout: exportTimeout}}
+}
+
+// TracesURL returns the traces URL of the collector at the base endpoint,
+// as OTEL_EXPORTER_OTLP_ENDPOINT is used: the standard /v1/traces path is
+// appended unless the endpoint already ends with it.
+func TracesURL(endpoint string) string {
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return url
+}
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Close implements Exporter.
+func (e *OTLPExporter) Close() error {
+	return nil
+}
+
+// WriterExporter writes each batch as one line of OTLP/JSON, the format of
+// the OpenTelemetry file exporter.
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewStdoutExporter creates an exporter that writes to standard output.
+func NewStdoutExporter() *WriterExporter {
+	return &WriterExporter{w: os.Stdout}
+}
+
+// NewFileExporter creates an exporter that appends to the file at path.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+// Export implements Exporter.
+func (e *WriterExporter) Export(ctx context.Context, payload []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(append(payload, '\n'))
+	return err
+}
+
+// Close implements Exporter.
+func (e *WriterExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTracerEncode(t *testing.T) {
+	start := time.Unix(1700000000, 123456789)
+	root := &Span{
+		sc:    SpanContext{TraceID: TraceID{0x4b, 0xf9, 15: 0x36}, SpanID: SpanID{0x00, 0xf0, 7: 0xb7}},
+		name:  "POST /v1/chat/completions",
+		kind:  KindServer,
+		start: start,
+		end:   start.Add(250 * time.Millisecond),
+		attrs: []Attr{
+			String("http.method", "POST"),
+			Int("http.status_code", 200),
+			Bool("stream", true),
+			{Key: "ratio", Value: 0.5},
+		},
+		events: []Event{{Time: start.Add(time.Millisecond), Name: "first chunk"}},
+	}
+	child := &Span{
+		sc:     SpanContext{TraceID: root.sc.TraceID, SpanID: SpanID{7: 0x01}},
+		parent: root.sc.SpanID,
+		name:   "upstream",
+		kind:   KindClient,
+		start:  start,
+		end:    start.Add(time.Second),
+	}
+	child.SetError(errors.New("boom"))
+
+	tracer := &Tracer{service: "copilot-api-proxy"}
+	got, err := json.MarshalIndent(tracer.encode([]*Span{root, child}), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{
+  "resourceSpans": [
+    {
+      "resource": {
+        "attributes": [
+          {
+            "key": "service.name",
+            "value": {
+              "stringValue": "copilot-api-proxy"
+            }
+          }
+        ]
+      },
+      "scopeSpans": [
+        {
+          "scope": {
+            "name": "copilot-api-proxy"
+          },
+          "spans": [
+            {
+              "traceId": "4bf90000000000000000000000000036",
+              "spanId": "00f00000000000b7",
+              "name": "POST /v1/chat/completions",
+              "kind": 2,
+              "startTimeUnixNano": "1700000000123456789",
+              "endTimeUnixNano": "1700000000373456789",
+              "attributes": [
+                {
+                  "key": "http.method",
+                  "value": {
+                    "stringValue": "POST"
+                  }
+                },
+                {
+                  "key": "http.status_code",
+                  "value": {
+                    "intValue": "200"
+                  }
+                },
+                {
+                  "key": "stream",
+                  "value": {
+                    "boolValue": true
+                  }
+                },
+                {
+                  "key": "ratio",
+                  "value": {
+                    "doubleValue": 0.5
+                  }
+                }
+              ],
+              "events": [
+                {
+                  "timeUnixNano": "1700000000124456789",
+                  "name": "first chunk"
+                }
+              ],
+              "status": {}
+            },
+            {
+              "traceId": "4bf90000000000000000000000000036",
+              "spanId": "0000000000000001",
+              "parentSpanId": "00f00000000000b7",
+              "name": "upstream",
+              "kind": 3,
+              "startTimeUnixNano": "1700000000123456789",
+              "endTimeUnixNano": "1700000001123456789",
+              "status": {
+                "code": 2,
+                "message": "boom"
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}`
+	if string(got) != want {
+		t.Errorf("encoded spans:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTracesURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"http://localhost:4318", "http://localhost:4318/v1/traces"},
+		{"http://localhost:4318/", "http://localhost:4318/v1/traces"},
+		{"https://collector.example.com/otlp", "https://collector.example.com/otlp/v1/traces"},
+		{"http://localhost:4318/v1/traces", "http://localhost:4318/v1/traces"},
+	}
+	for _, tt := range tests {
+		if got := TracesURL(tt.endpoint); got != tt.want {
+			t.Errorf("TracesURL(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", true, false},
+		{"surrounding space", " 00-" + traceID + "-" + spanID + "-01 ", true, true},
+		{"later version with extra fields", "cc-" + traceID + "-" + spanID + "-01-future", true, true},
+		{"empty", "", false, false},
+		{"invalid version ff", "ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"long version", "000-" + traceID + "-" + spanID + "-01", false, false},
+		{"version 00 with extra fields", "00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"too few fields", "00-" + traceID + "-" + spanID, false, false},
+		{"all-zero trace ID", "00-00000000000000000000000000000000-" + spanID + "-01", false, false},
+		{"all-zero span ID", "00-" + traceID + "-0000000000000000-01", false, false},
+		{"short trace ID", "00-" + traceID[:30] + "-" + spanID + "-01", false, false},
+		{"long span ID", "00-" + traceID + "-" + spanID + "00-01", false, false},
+		{"long flags", "00-" + traceID + "-" + spanID + "-001", false, false},
+		{"non-hex trace ID", "00-" + traceID[:31] + "g-" + spanID + "-01", false, false},
+		{"non-hex flags", "00-" + traceID + "-" + spanID + "-zz", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := parseTraceparent(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("parseTraceparent(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if !ok {
+				if sc != (SpanContext{}) {
+					t.Errorf("rejected value returned %+v", sc)
+				}
+				return
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("sampled = %v, want %v", sc.Sampled, tt.sampled)
+			}
+			if got := sc.TraceID; got != (TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}) {
+				t.Errorf("trace ID = %x", got)
+			}
+			if got := sc.SpanID; got != (SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}) {
+				t.Errorf("span ID = %x", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package usage meters the tokens each request consumes and keeps them in an
+// append-only ledger file, one JSON record per line, for later reports.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+// Record is the usage of one request.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Client           string    `json:"client"`
+	Model            string    `json:"model"`
+	Endpoint         string    `json:"endpoint"`
+	Stream           bool      `json:"stream,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	ReasoningTokens  int       `json:"reasoning_tokens,omitempty"`
+	CachedTokens     int       `json:"cached_tokens,omitempty"`
+}
+
+// NewRecord creates a record of u for a request made now.
+func NewRecord(client, model, endpoint string, stream bool, u *openai.Usage) Record {
+	rec := Record{
+		Time:             time.Now().UTC(),
+		Client:           client,
+		Model:            model,
+		Endpoint:         endpoint,
+		Stream:           stream,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+	}
+	if u.CompletionTokensDetails != nil {
+		rec.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	if u.PromptTokensDetails != nil {
+		rec.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return rec
+}
+
+// Ledger appends usage records to a file.
+type Ledger struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open opens the ledger at path for appending, creating it if needed.
+func Open(path string) (*Ledger, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	return &Ledger{path: path, file: file}, nil
+}
+
+// Add appends rec to the ledger.
+func (l *Ledger) Add(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// Report summarises the records in the ledger that match q.
+func (l *Ledger) Report(q Query) (*Report, error) {
+	// The scan reads the file through its own descriptor and skips a
+	// half-written last line, so it does not hold up Add.
+	return ReadReport(l.path, q)
+}
+
+// Close closes the ledger file.
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// ReadReport summarises the records in the ledger file at path that match
+// q. A missing file yields an empty report. A truncated last line, as left
+// by a crash or a concurrent write, is ignored.
+func ReadReport(path string, q Query) (*Report, error) {
+	report := newReport(q.Period)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return report.finish(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	if err := scan(file, func(rec Record) {
+		if q.Matches(rec) {
+			report.add(rec)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger %s: %w", path, err)
+	}
+	return report.finish(), nil
+}
+
+// scan calls fn with each record read from r, skipping lines that do not
+// parse.
+func scan(r io.Reader, fn func(Record)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var rec Record
+			if json.Unmarshal(line, &rec) == nil {
+				fn(rec)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
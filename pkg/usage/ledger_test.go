@@ -0,0 +1,67 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"copilot-api-proxy/pkg/openai"
+)
+
+func TestLedgerReportWhileAdding(t *testing.T) {
+	ledger, err := Open(filepath.Join(t.TempDir(), "usage.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	const records = 200
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range records {
+			if err := ledger.Add(NewRecord("client", "gpt-4.1", "/v1/chat/completions", false, &openai.Usage{PromptTokens: 3, CompletionTokens: 2})); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	previous := 0
+	for range 50 {
+		report, err := ledger.Report(Query{Period: PeriodDay})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Total.Requests < previous {
+			t.Fatalf("report went from %d to %d requests", previous, report.Total.Requests)
+		}
+		previous = report.Total.Requests
+	}
+	wg.Wait()
+
+	report, err := ledger.Report(Query{Period: PeriodDay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Requests != records || report.Total.PromptTokens != 3*records {
+		t.Fatalf("total = %+v, want %d requests", report.Total, records)
+	}
+}
+
+func TestReadReportIgnoresTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	data := `{"time":"2026-10-01T12:00:00Z","client":"a","model":"m","prompt_tokens":1}` + "\n" +
+		`{"time":"2026-10-01T12:00:01Z","client":"a","mo`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	report, err := ReadReport(path, Query{Period: PeriodDay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Requests != 1 {
+		t.Fatalf("requests = %d, want 1", report.Total.Requests)
+	}
+}
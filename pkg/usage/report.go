@@ -0,0 +1,137 @@
+package usage
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Rollup periods.
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// dateLayout is the format of the dates in queries and daily rollups.
+const dateLayout = "2006-01-02"
+
+// Query selects the records of a report and how they are rolled up. Zero
+// fields match everything.
+type Query struct {
+	// From and To bound the record times; To is exclusive.
+	From, To time.Time
+	Client   string
+	Model    string
+	// Period is PeriodDay or PeriodMonth.
+	Period string
+}
+
+// ParseQuery builds a query from the textual parameters of the API and the
+// CLI. from and to are dates in local time; both are inclusive.
+func ParseQuery(period, from, to, client, model string) (Query, error) {
+	q := Query{Period: period, Client: client, Model: model}
+	switch period {
+	case "":
+		q.Period = PeriodDay
+	case PeriodDay, PeriodMonth:
+	default:
+		return Query{}, fmt.Errorf("unknown period %q (want day or month)", period)
+	}
+	if from != "" {
+		t, err := time.ParseInLocation(dateLayout, from, time.Local)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid from date %q (want YYYY-MM-DD)", from)
+		}
+		q.From = t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation(dateLayout, to, time.Local)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid to date %q (want YYYY-MM-DD)", to)
+		}
+		q.To = t.AddDate(0, 0, 1)
+	}
+	return q, nil
+}
+
+// Matches reports whether rec is selected by q.
+func (q Query) Matches(rec Record) bool {
+	switch {
+	case !q.From.IsZero() && rec.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && !rec.Time.Before(q.To):
+		return false
+	case q.Client != "" && rec.Client != q.Client:
+		return false
+	case q.Model != "" && rec.Model != q.Model:
+		return false
+	}
+	return true
+}
+
+// Totals adds up the usage of a set of requests.
+type Totals struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	ReasoningTokens  int `json:"reasoning_tokens"`
+	CachedTokens     int `json:"cached_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (t *Totals) add(rec Record) {
+	t.Requests++
+	t.PromptTokens += rec.PromptTokens
+	t.CompletionTokens += rec.CompletionTokens
+	t.ReasoningTokens += rec.ReasoningTokens
+	t.CachedTokens += rec.CachedTokens
+	t.TotalTokens += rec.PromptTokens + rec.CompletionTokens
+}
+
+// Row is the usage of one client and model in one period.
+type Row struct {
+	Period string `json:"period"`
+	Client string `json:"client"`
+	Model  string `json:"model"`
+	Totals
+}
+
+// Report is a rollup of usage records by period, client and model.
+type Report struct {
+	Period string `json:"period"`
+	Rows   []Row  `json:"data"`
+	Total  Totals `json:"total"`
+
+	index map[[3]string]int
+}
+
+func newReport(period string) *Report {
+	return &Report{Period: period, Rows: []Row{}, index: make(map[[3]string]int)}
+}
+
+func (r *Report) add(rec Record) {
+	local := rec.Time.Local()
+	period := local.Format(dateLayout)
+	if r.Period == PeriodMonth {
+		period = local.Format("2006-01")
+	}
+	key := [3]string{period, rec.Client, rec.Model}
+	i, ok := r.index[key]
+	if !ok {
+		i = len(r.Rows)
+		r.index[key] = i
+		r.Rows = append(r.Rows, Row{Period: period, Client: rec.Client, Model: rec.Model})
+	}
+	r.Rows[i].add(rec)
+	r.Total.add(rec)
+}
+
+// finish sorts the rows by period, client and model.
+func (r *Report) finish() *Report {
+	slices.SortFunc(r.Rows, func(a, b Row) int {
+		return cmp.Or(cmp.Compare(a.Period, b.Period), cmp.Compare(a.Client, b.Client), cmp.Compare(a.Model, b.Model))
+	})
+	r.index = nil
+	return r
+}
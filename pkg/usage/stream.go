@@ -0,0 +1,62 @@
+package usage
+
+import (
+	"encoding/json"
+)
+
+// IncludeStreamUsage turns on stream_options.include_usage in a streaming
+// chat completions request body that does not already ask for usage, so
+// the final chunk reports it. It reports whether the body was changed; the
+// client did not ask for the usage chunk then, and StripUsage should hide it.
+func IncludeStreamUsage(body []byte) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, false
+	}
+	var stream bool
+	if json.Unmarshal(fields["stream"], &stream) != nil || !stream {
+		return body, false
+	}
+	options := map[string]json.RawMessage{}
+	if raw, ok := fields["stream_options"]; ok && string(raw) != "null" {
+		if json.Unmarshal(raw, &options) != nil {
+			return body, false
+		}
+	}
+	var include bool
+	if json.Unmarshal(options["include_usage"], &include) == nil && include {
+		return body, false
+	}
+
+	options["include_usage"] = json.RawMessage("true")
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return body, false
+	}
+	fields["stream_options"] = raw
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body, false
+	}
+	return rewritten, true
+}
+
+// StripUsage is an httpstreaming.Transform that removes the usage requested by
+// IncludeStreamUsage: it drops the usage-only chunk and removes the usage
+// field from any other chunk that carries it.
+func StripUsage(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return data, nil
+	}
+	raw, ok := fields["usage"]
+	if !ok || string(raw) == "null" {
+		return data, nil
+	}
+	var choices []json.RawMessage
+	if json.Unmarshal(fields["choices"], &choices) == nil && len(choices) == 0 {
+		return nil, nil
+	}
+	delete(fields, "usage")
+	return json.Marshal(fields)
+}